@@ -9,6 +9,8 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/wagoodman/dive/dive"
+	"github.com/wagoodman/dive/dive/filetree"
+	"github.com/wagoodman/dive/dive/image"
 	"github.com/wagoodman/dive/runtime"
 )
 
@@ -41,20 +43,10 @@ func doAnalyzeCmd(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	var sourceType dive.ImageSource
-	var imageStr string
-
-	sourceType, imageStr = dive.DeriveImageSource(userImage)
-
-	if sourceType == dive.SourceUnknown {
-		sourceStr := viper.GetString("source")
-		sourceType = dive.ParseImageSource(sourceStr)
-		if sourceType == dive.SourceUnknown {
-			fmt.Printf("unable to determine image source: %v\n", sourceStr)
-			os.Exit(1)
-		}
-
-		imageStr = userImage
+	sourceType, imageStr, err := getImageSource(userImage)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
 	ignoreErrors, err := cmd.PersistentFlags().GetBool("ignore-errors")
@@ -62,6 +54,18 @@ func doAnalyzeCmd(cmd *cobra.Command, args []string) {
 		logrus.Error("unable to get 'ignore-errors' option:", err)
 	}
 
+	platform, err := getPlatform(cmd)
+	if err != nil {
+		fmt.Printf("invalid platform: %v\n", err)
+		os.Exit(1)
+	}
+
+	fileDigests, err := filetree.ParseDigestAlgorithm(viper.GetString("file-digests"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	runtime.Run(runtime.Options{
 		Ci:           isCi,
 		Source:       sourceType,
@@ -69,5 +73,45 @@ func doAnalyzeCmd(cmd *cobra.Command, args []string) {
 		ExportFile:   exportFile,
 		CiConfig:     ciConfig,
 		IgnoreErrors: viper.GetBool("ignore-errors") || ignoreErrors,
+		Platform:     platform,
+		AllImages:    ciAllImages,
+		Timeout:      viper.GetDuration("timeout"),
+		Jobs:         viper.GetInt("jobs"),
+		CacheDir:     getLayerCacheDir(),
+		FileDigests:  fileDigests,
+
+		ContainerdCtrAddress: viper.GetString("containerd.ctr-address"),
+		ContainerdRoot:       viper.GetString("containerd.root"),
+
+		ContainersStorageRoot: viper.GetString("podman.storage-root"),
 	})
 }
+
+// getImageSource determines the source of the given image from its "<source>://" prefix, or otherwise from the
+// --source flag (or config)
+func getImageSource(userImage string) (dive.ImageSource, string, error) {
+	sourceType, imageStr := dive.DeriveImageSource(userImage)
+	if sourceType != dive.SourceUnknown {
+		return sourceType, imageStr, nil
+	}
+
+	sourceStr := viper.GetString("source")
+	sourceType = dive.ParseImageSource(sourceStr)
+	if sourceType == dive.SourceUnknown {
+		return sourceType, "", fmt.Errorf("unable to determine image source: %v", sourceStr)
+	}
+	return sourceType, userImage, nil
+}
+
+// getPlatform returns the platform requested with the --platform flag (nil if none was given)
+func getPlatform(cmd *cobra.Command) (*image.Platform, error) {
+	value, err := cmd.Flags().GetString("platform")
+	if err != nil || value == "" {
+		return nil, err
+	}
+	platform, err := image.ParsePlatform(value)
+	if err != nil {
+		return nil, err
+	}
+	return &platform, nil
+}
@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/wagoodman/dive/dive"
+	"github.com/wagoodman/dive/dive/filetree"
 	"github.com/wagoodman/dive/runtime"
 )
 
@@ -28,11 +32,21 @@ func doBuildCmd(cmd *cobra.Command, args []string) {
 	// todo: allow for an engine flag to be passed to dive but not the container engine
 	engine := viper.GetString("container-engine")
 
+	fileDigests, err := filetree.ParseDigestAlgorithm(viper.GetString("file-digests"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	runtime.Run(runtime.Options{
-		Ci:         isCi,
-		Source:     dive.ParseImageSource(engine),
-		BuildArgs:  args,
-		ExportFile: exportFile,
-		CiConfig:   ciConfig,
+		Ci:          isCi,
+		Source:      dive.ParseImageSource(engine),
+		BuildArgs:   args,
+		ExportFile:  exportFile,
+		CiConfig:    ciConfig,
+		Timeout:     viper.GetDuration("timeout"),
+		Jobs:        viper.GetInt("jobs"),
+		CacheDir:    getLayerCacheDir(),
+		FileDigests: fileDigests,
 	})
 }
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+var cachePruneOlderThan time.Duration
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect or prune the cache of parsed layers (see --cache-dir and --no-cache).",
+}
+
+var cacheLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the cached layers, most recently used first.",
+	Args:  cobra.NoArgs,
+	Run:   doCacheLsCmd,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove cached layers (every layer unless --older-than is given), along with layers cached by older versions of dive.",
+	Args:  cobra.NoArgs,
+	Run:   doCachePruneCmd,
+}
+
+func init() {
+	cachePruneCmd.Flags().DurationVar(&cachePruneOlderThan, "older-than", 0, "only remove the layers that have not been used for the given duration (e.g. 720h)")
+	cacheCmd.AddCommand(cacheLsCmd, cachePruneCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+// getCacheDir returns the directory parsed layers are cached in (the user cache directory unless configured)
+func getCacheDir() (string, error) {
+	if dir := viper.GetString("cache.dir"); dir != "" {
+		return dir, nil
+	}
+	return image.DefaultLayerCacheDir()
+}
+
+// getLayerCacheDir returns the directory to cache the parsed layers of analyzed images in (empty when disabled)
+func getLayerCacheDir() string {
+	if !viper.GetBool("cache.enabled") || viper.GetBool("no-cache") {
+		return ""
+	}
+	dir, err := getCacheDir()
+	if err != nil {
+		logrus.Warnf("not caching layers: %v", err)
+		return ""
+	}
+	return dir
+}
+
+func getLayerCache() *image.LayerCache {
+	dir, err := getCacheDir()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return image.NewLayerCache(dir)
+}
+
+// doCacheLsCmd implements the steps taken for the cache ls command
+func doCacheLsCmd(cmd *cobra.Command, args []string) {
+	initLogging()
+
+	cache := getLayerCache()
+	entries, err := cache.Entries()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Cache directory: %s\n", cache.Dir())
+	if len(entries) == 0 {
+		fmt.Println("No cached layers")
+		return
+	}
+
+	var total int64
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "DIFF ID\tFILE DIGESTS\tSIZE\tLAST USED\t")
+	for _, entry := range entries {
+		digests := string(entry.Digests)
+		if digests == "" {
+			digests = "none"
+		}
+		lastUsed := humanize.Time(entry.LastUsed)
+		if entry.Stale {
+			lastUsed += fmt.Sprintf(" (stale, v%d)", entry.Version)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t\n", entry.DiffID, digests, humanize.Bytes(uint64(entry.Size)), lastUsed)
+		total += entry.Size
+	}
+	if err := writer.Flush(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d layers, %s\n", len(entries), humanize.Bytes(uint64(total)))
+}
+
+// doCachePruneCmd implements the steps taken for the cache prune command
+func doCachePruneCmd(cmd *cobra.Command, args []string) {
+	initLogging()
+
+	removed, err := getLayerCache().Prune(cachePruneOlderThan)
+
+	var freed int64
+	for _, entry := range removed {
+		freed += entry.Size
+	}
+	fmt.Printf("Removed %d layers, freed %s\n", len(removed), humanize.Bytes(uint64(freed)))
+
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/wagoodman/dive/dive/filetree"
+	"github.com/wagoodman/dive/runtime"
+)
+
+var diffExportFile string
+var diffInteractive bool
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff IMAGE_A IMAGE_B",
+	Short: "Shows the files added, removed, and modified from one image to another (e.g. between two versions of an application).",
+	Args:  cobra.ExactArgs(2),
+	Run:   doDiffCmd,
+}
+
+func init() {
+	diffCmd.Flags().StringVarP(&diffExportFile, "json", "j", "", "Write the differences to a given file as JSON rather than printing them.")
+	diffCmd.Flags().BoolVar(&diffInteractive, "ui", false, "Explore the differences in the interactive file tree view rather than printing them.")
+	rootCmd.AddCommand(diffCmd)
+}
+
+// doDiffCmd implements the steps taken for the diff command
+func doDiffCmd(cmd *cobra.Command, args []string) {
+	initLogging()
+
+	sourceType, imageStr, err := getImageSource(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	otherSourceType, otherImageStr, err := getImageSource(args[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ignoreErrors, err := cmd.Flags().GetBool("ignore-errors")
+	if err != nil {
+		fmt.Println("unable to get 'ignore-errors' option:", err)
+		os.Exit(1)
+	}
+
+	platform, err := getPlatform(cmd)
+	if err != nil {
+		fmt.Printf("invalid platform: %v\n", err)
+		os.Exit(1)
+	}
+
+	fileDigests, err := filetree.ParseDigestAlgorithm(viper.GetString("file-digests"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	runtime.RunDiff(runtime.DiffOptions{
+		Options: runtime.Options{
+			Source:       sourceType,
+			Image:        imageStr,
+			ExportFile:   diffExportFile,
+			IgnoreErrors: viper.GetBool("ignore-errors") || ignoreErrors,
+			Platform:     platform,
+			Timeout:      viper.GetDuration("timeout"),
+			Jobs:         viper.GetInt("jobs"),
+			CacheDir:     getLayerCacheDir(),
+			FileDigests:  fileDigests,
+
+			ContainerdCtrAddress: viper.GetString("containerd.ctr-address"),
+			ContainerdRoot:       viper.GetString("containerd.root"),
+
+			ContainersStorageRoot: viper.GetString("podman.storage-root"),
+		},
+		OtherSource: otherSourceType,
+		OtherImage:  otherImageStr,
+		Interactive: diffInteractive,
+	})
+}
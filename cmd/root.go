@@ -21,6 +21,7 @@ var exportFile string
 var ciConfigFile string
 var ciConfig = viper.New()
 var isCi bool
+var ciAllImages bool
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -50,9 +51,19 @@ func initCli() {
 	rootCmd.PersistentFlags().String("source", "docker", "The container engine to fetch the image from. Allowed values: "+strings.Join(dive.ImageSources, ", "))
 	rootCmd.PersistentFlags().BoolP("version", "v", false, "display version number")
 	rootCmd.PersistentFlags().BoolP("ignore-errors", "i", false, "ignore image parsing errors and run the analysis anyway")
+	rootCmd.PersistentFlags().String("ctr-address", "", "the containerd socket the ctr CLI reads images through with the containerd source (requires the ctr CLI, default is the ctr default)")
+	rootCmd.PersistentFlags().String("containerd-root", "", "read images from the containerd content store on disk (e.g. /var/lib/containerd) instead of through the ctr CLI")
+	rootCmd.PersistentFlags().String("containers-storage-root", "", "the containers-storage graph root to read images from with the podman source (default is the podman default for the current user)")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "give up fetching and analyzing the image after the given duration (e.g. 5m, default is no timeout)")
+	rootCmd.PersistentFlags().String("file-digests", "", "compute a digest of every regular file, shown in the file details and included in JSON exports (supported: sha256, default is none)")
+	rootCmd.PersistentFlags().Int("jobs", 0, "the number of layers to parse (and hash) concurrently (default is one per CPU)")
+	rootCmd.PersistentFlags().String("cache-dir", "", "the directory parsed layers are cached in (default is dive/layers in the user cache directory, e.g. $XDG_CACHE_HOME)")
+	rootCmd.PersistentFlags().Bool("no-cache", false, "neither use nor populate the cache of parsed layers")
+	rootCmd.PersistentFlags().String("platform", "", "select the image platform (os/arch[/variant]) from a multi-platform image (default is linux on the host architecture)")
 	rootCmd.Flags().BoolVar(&isCi, "ci", false, "Skip the interactive TUI and validate against CI rules (same as env var CI=true)")
 	rootCmd.Flags().StringVarP(&exportFile, "json", "j", "", "Skip the interactive TUI and write the layer analysis statistics to a given file.")
 	rootCmd.Flags().StringVar(&ciConfigFile, "ci-config", ".dive-ci", "If CI=true in the environment, use the given yaml to drive validation rules.")
+	rootCmd.Flags().BoolVar(&ciAllImages, "ci-all-images", false, "(only valid with --ci given) validate every image of a multi-image docker-archive and report a combined result.")
 
 	rootCmd.Flags().String("lowestEfficiency", "0.9", "(only valid with --ci given) lowest allowable image efficiency (as a ratio between 0-1), otherwise CI validation will fail.")
 	rootCmd.Flags().String("highestWastedBytes", "disabled", "(only valid with --ci given) highest allowable bytes wasted, otherwise CI validation will fail.")
@@ -80,9 +91,11 @@ func initConfig() {
 	viper.SetDefault("keybinding.quit", "ctrl+c,q")
 	viper.SetDefault("keybinding.toggle-view", "tab")
 	viper.SetDefault("keybinding.filter-files", "ctrl+f, ctrl+slash")
+	viper.SetDefault("keybinding.toggle-file-details", "ctrl+d")
 	// keybindings: layer view
 	viper.SetDefault("keybinding.compare-all", "ctrl+a")
 	viper.SetDefault("keybinding.compare-layer", "ctrl+l")
+	viper.SetDefault("keybinding.mark-layer", "m")
 	// keybindings: filetree view
 	viper.SetDefault("keybinding.toggle-collapse-dir", "space")
 	viper.SetDefault("keybinding.toggle-collapse-all-dir", "ctrl+space")
@@ -103,6 +116,10 @@ func initConfig() {
 	viper.SetDefault("filetree.collapse-dir", false)
 	viper.SetDefault("filetree.pane-width", 0.5)
 	viper.SetDefault("filetree.show-attributes", true)
+	viper.SetDefault("filetree.compare-attributes", []string{"xattrs", "device"})
+
+	viper.SetDefault("cache.enabled", true)
+	viper.SetDefault("cache.dir", "")
 
 	viper.SetDefault("container-engine", "docker")
 	viper.SetDefault("ignore-errors", false)
@@ -113,6 +130,13 @@ func initConfig() {
 		os.Exit(1)
 	}
 
+	for key, flag := range map[string]string{"containerd.ctr-address": "ctr-address", "containerd.root": "containerd-root", "podman.storage-root": "containers-storage-root", "timeout": "timeout", "file-digests": "file-digests", "jobs": "jobs", "cache.dir": "cache-dir", "no-cache": "no-cache"} {
+		if err = viper.BindPFlag(key, rootCmd.PersistentFlags().Lookup(flag)); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
 	viper.SetEnvPrefix("DIVE")
 	// replace all - with _ when looking for matching environment variables
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
@@ -136,6 +160,11 @@ func initConfig() {
 
 	// set global defaults (for performance)
 	filetree.GlobalFileTreeCollapse = viper.GetBool("filetree.collapse-dir")
+	filetree.GlobalComparePolicy, err = filetree.ParseComparePolicy(viper.GetStringSlice("filetree.compare-attributes"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
 
 // initLogging sets up the logging object with a formatter and location
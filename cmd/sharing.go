@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/wagoodman/dive/runtime"
+)
+
+var sharingExportFile string
+var sharingBase string
+
+// sharingCmd represents the sharing command
+var sharingCmd = &cobra.Command{
+	Use:   "sharing IMAGE IMAGE [IMAGE...]",
+	Short: "Reports the layers shared between several images, the bytes saved by sharing them, and the images that diverge from the expected base.",
+	Args:  cobra.MinimumNArgs(2),
+	Run:   doSharingCmd,
+}
+
+func init() {
+	sharingCmd.Flags().StringVarP(&sharingExportFile, "json", "j", "", "Write the report to a given file as JSON rather than printing it.")
+	sharingCmd.Flags().StringVar(&sharingBase, "base", "", "The base image every image is expected to be built on (default is the layers shared by most of the images).")
+	rootCmd.AddCommand(sharingCmd)
+}
+
+// doSharingCmd implements the steps taken for the sharing command
+func doSharingCmd(cmd *cobra.Command, args []string) {
+	initLogging()
+
+	getReference := func(userImage string) runtime.ImageReference {
+		sourceType, imageStr, err := getImageSource(userImage)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return runtime.ImageReference{Source: sourceType, Image: imageStr}
+	}
+
+	var images []runtime.ImageReference
+	for _, userImage := range args {
+		images = append(images, getReference(userImage))
+	}
+
+	var base *runtime.ImageReference
+	if sharingBase != "" {
+		ref := getReference(sharingBase)
+		base = &ref
+	}
+
+	platform, err := getPlatform(cmd)
+	if err != nil {
+		fmt.Printf("invalid platform: %v\n", err)
+		os.Exit(1)
+	}
+
+	runtime.RunSharing(runtime.SharingOptions{
+		Options: runtime.Options{
+			ExportFile: sharingExportFile,
+			Platform:   platform,
+			Timeout:    viper.GetDuration("timeout"),
+			Jobs:       viper.GetInt("jobs"),
+			CacheDir:   getLayerCacheDir(),
+
+			ContainerdCtrAddress: viper.GetString("containerd.ctr-address"),
+			ContainerdRoot:       viper.GetString("containerd.root"),
+
+			ContainersStorageRoot: viper.GetString("podman.storage-root"),
+		},
+		Images: images,
+		Base:   base,
+	})
+}
@@ -0,0 +1,73 @@
+// Package analysis is the entry point for using dive as a library: it loads an image from any of the supported
+// sources and analyzes its layers for wasted space, without printing anything or starting the UI.
+//
+//	img, err := analysis.Load(ctx, dive.SourceDockerArchive, "app.tar", analysis.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	result, err := analysis.Analyze(img)
+//
+// Diff compares two loaded images, listing the files added, removed, and modified by the second image.
+//
+// Errors describing a malformed image match the errors of the image package (e.g. image.ErrCorruptLayer) with
+// errors.Is. Diagnostics are logged with logrus, which may be configured by the caller.
+package analysis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wagoodman/dive/dive"
+	"github.com/wagoodman/dive/dive/image"
+)
+
+// AnalysisResult describes the layers of an image, its efficiency, and the files that waste space.
+type AnalysisResult = image.AnalysisResult
+
+// Options are the settings for loading an image.
+type Options struct {
+	image.ResolverOptions
+	// Progress receives updates while the image is fetched and parsed (optional). It may be called from several
+	// goroutines.
+	Progress func(image.Progress)
+}
+
+// Load fetches and parses the given image from the source. When the source is dive.SourceUnknown, the source is
+// taken from a "<source>://" prefix of the reference (e.g. "docker-archive://app.tar"), defaulting to the docker
+// engine. Loading stops (returning the context error, wrapped) as soon as the context is done.
+func Load(ctx context.Context, source dive.ImageSource, ref string, opts Options) (*image.Image, error) {
+	if source == dive.SourceUnknown {
+		source, ref = parseReference(ref)
+	}
+
+	resolver, err := dive.GetImageResolver(source, opts.ResolverOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Progress != nil {
+		ctx = image.WithProgressTracker(ctx, image.NewProgressTracker(opts.Progress))
+	}
+
+	img, err := resolver.Fetch(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load %s://%s: %w", source, ref, err)
+	}
+	return img, nil
+}
+
+// Analyze determines the efficiency of the given image and the files that waste space within it.
+func Analyze(img *image.Image) (*AnalysisResult, error) {
+	if img == nil || len(img.Trees) == 0 {
+		return nil, fmt.Errorf("image has no layers to analyze")
+	}
+	return img.Analyze()
+}
+
+func parseReference(ref string) (dive.ImageSource, string) {
+	source, imageRef := dive.DeriveImageSource(ref)
+	if source == dive.SourceUnknown {
+		return dive.SourceDockerEngine, ref
+	}
+	return source, imageRef
+}
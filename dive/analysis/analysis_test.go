@@ -0,0 +1,88 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/wagoodman/dive/dive"
+	"github.com/wagoodman/dive/dive/image"
+	"github.com/wagoodman/dive/dive/image/docker"
+)
+
+const testArchive = "../../.data/test-docker-image.tar"
+
+// captureStdout returns everything written to stdout while running the given function.
+func captureStdout(t *testing.T, fn func()) string {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+
+	writer.Close()
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+func TestLoadAndAnalyze(t *testing.T) {
+	table := map[string]struct {
+		source dive.ImageSource
+		ref    string
+	}{
+		"explicit-source": {source: dive.SourceDockerArchive, ref: testArchive},
+		"derived-source":  {source: dive.SourceUnknown, ref: "docker-archive://" + testArchive},
+	}
+
+	for name, test := range table {
+		var result *AnalysisResult
+		var progress image.Progress
+		output := captureStdout(t, func() {
+			img, err := Load(context.Background(), test.source, test.ref, Options{
+				Progress: func(p image.Progress) { progress = p },
+			})
+			if err != nil {
+				t.Fatalf("%s: unable to load image: %v", name, err)
+			}
+
+			result, err = Analyze(img)
+			if err != nil {
+				t.Fatalf("%s: unable to analyze image: %v", name, err)
+			}
+		})
+
+		if output != "" {
+			t.Errorf("%s: expected no output, got %q", name, output)
+		}
+		docker.TestCheckAnalysis(t, name, result)
+		if progress.Layers != 14 {
+			t.Errorf("%s: expected progress for 14 layers, got %+v", name, progress)
+		}
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Load(ctx, dive.SourceDockerArchive, testArchive, Options{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled error, got %v", err)
+	}
+
+	if _, err := Load(context.Background(), dive.SourceDockerArchive, "does-not-exist.tar", Options{}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+
+	if _, err := Analyze(&image.Image{}); err == nil {
+		t.Errorf("expected an error analyzing an image without layers")
+	}
+}
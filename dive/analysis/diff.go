@@ -0,0 +1,146 @@
+package analysis
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/wagoodman/dive/dive/filetree"
+	"github.com/wagoodman/dive/dive/image"
+)
+
+// FileChange describes a file that differs between two images.
+type FileChange struct {
+	Path   string
+	Change filetree.DiffType
+	// SizeBefore is the size of the file in the first image (zero when the file was added)
+	SizeBefore int64
+	// SizeAfter is the size of the file in the second image (zero when the file was removed)
+	SizeAfter int64
+	// DigestBefore and DigestAfter are the digests of the file in each image (only when file digests are computed)
+	DigestBefore string
+	DigestAfter  string
+}
+
+// SizeDelta is the change in size of the file from the first image to the second.
+func (c FileChange) SizeDelta() int64 {
+	return c.SizeAfter - c.SizeBefore
+}
+
+// DiffResult describes the differences between the filesystems of two images.
+type DiffResult struct {
+	// Lower and Upper are the complete filesystems of the first and second image, where the files missing from the
+	// second image are recorded in Upper as whiteouts (so that Upper can be compared on top of Lower as a layer would be)
+	Lower *filetree.FileTree
+	Upper *filetree.FileTree
+	// Tree is the filesystem of the first image marked with the changes made by the second image
+	Tree *filetree.FileTree
+
+	Added    []FileChange
+	Removed  []FileChange
+	Modified []FileChange
+
+	// PathErrors are the paths that could not be stacked or compared (the listings may be incomplete)
+	PathErrors []filetree.PathError
+}
+
+// SizeDelta is the change in the total size of the files from the first image to the second.
+func (d *DiffResult) SizeDelta() int64 {
+	var delta int64
+	for _, changes := range [][]FileChange{d.Added, d.Removed, d.Modified} {
+		for _, change := range changes {
+			delta += change.SizeDelta()
+		}
+	}
+	return delta
+}
+
+// Diff compares the filesystems of two images (e.g. two versions of an application), listing the files the second
+// image adds, removes, and modifies relative to the first.
+func Diff(a, b *image.Image) (*DiffResult, error) {
+	if len(a.Trees) == 0 || len(b.Trees) == 0 {
+		return nil, fmt.Errorf("cannot compare images without layers")
+	}
+
+	result := &DiffResult{}
+
+	lower, pathErrors, err := filetree.StackTreeRange(a.Trees, 0, len(a.Trees)-1)
+	if err != nil {
+		return nil, fmt.Errorf("unable to stack the first image: %w", err)
+	}
+	result.PathErrors = append(result.PathErrors, pathErrors...)
+
+	upper, pathErrors, err := filetree.StackTreeRange(b.Trees, 0, len(b.Trees)-1)
+	if err != nil {
+		return nil, fmt.Errorf("unable to stack the second image: %w", err)
+	}
+	result.PathErrors = append(result.PathErrors, pathErrors...)
+
+	// unlike a layer, an image does not record the files it does not have, so whiteout the files that are missing
+	// from the second image (only the topmost missing path is needed, its children are removed with it)
+	var missing []string
+	err = lower.VisitDepthParentFirst(func(*filetree.FileNode) error { return nil }, func(node *filetree.FileNode) bool {
+		if node == lower.Root {
+			return true
+		}
+		if _, err := upper.GetNode(node.Path()); err != nil {
+			missing = append(missing, node.Path())
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, missingPath := range missing {
+		whiteout := path.Join(path.Dir(missingPath), ".wh."+path.Base(missingPath))
+		if _, _, err := upper.AddPath(whiteout, filetree.FileInfo{}); err != nil {
+			return nil, err
+		}
+	}
+
+	tree := lower.Copy()
+	pathErrors, err = tree.CompareAndMark(upper)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compare images: %w", err)
+	}
+	result.PathErrors = append(result.PathErrors, pathErrors...)
+
+	result.Lower, result.Upper, result.Tree = lower, upper, tree
+
+	err = tree.VisitDepthParentFirst(func(node *filetree.FileNode) error {
+		diffType := tree.DiffType(node)
+		if diffType == filetree.Unmodified || !node.IsLeaf() {
+			// directories are described by the files within them (only empty directories are listed)
+			return nil
+		}
+
+		change := FileChange{
+			Path:   node.Path(),
+			Change: diffType,
+		}
+		if before, err := lower.GetNode(change.Path); err == nil {
+			change.SizeBefore = before.Data.FileInfo.Size
+			change.DigestBefore = before.Data.FileInfo.Digest
+		}
+		if after, err := upper.GetNode(change.Path); err == nil && !after.IsWhiteout() {
+			change.SizeAfter = after.Data.FileInfo.Size
+			change.DigestAfter = after.Data.FileInfo.Digest
+		}
+
+		switch diffType {
+		case filetree.Added:
+			result.Added = append(result.Added, change)
+		case filetree.Removed:
+			change.SizeAfter = 0
+			result.Removed = append(result.Removed, change)
+		case filetree.Modified:
+			result.Modified = append(result.Modified, change)
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,159 @@
+package analysis
+
+import (
+	"context"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/wagoodman/dive/dive"
+	"github.com/wagoodman/dive/dive/filetree"
+	"github.com/wagoodman/dive/dive/image"
+)
+
+type testFile struct {
+	path string
+	size int64
+	mode os.FileMode
+}
+
+func testImage(t *testing.T, layers ...[]testFile) *image.Image {
+	img := &image.Image{}
+	for _, files := range layers {
+		tree := filetree.NewFileTree()
+		for _, file := range files {
+			info := filetree.FileInfo{Path: file.path, Size: file.size, Mode: file.mode, IsDir: file.mode.IsDir()}
+			if _, _, err := tree.AddPath(file.path, info); err != nil {
+				t.Fatal(err)
+			}
+		}
+		img.Trees = append(img.Trees, tree)
+	}
+	return img
+}
+
+func changedPaths(changes []FileChange) []string {
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func assertPaths(t *testing.T, kind string, changes []FileChange, expected ...string) {
+	t.Helper()
+	actual := changedPaths(changes)
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %s paths %v, got %v", kind, expected, actual)
+	}
+	for idx := range expected {
+		if actual[idx] != expected[idx] {
+			t.Fatalf("expected %s paths %v, got %v", kind, expected, actual)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := testImage(t,
+		[]testFile{
+			{path: "/etc", mode: os.ModeDir | 0755},
+			{path: "/etc/config", size: 100, mode: 0644},
+			{path: "/app", mode: os.ModeDir | 0755},
+			{path: "/app/lib", mode: os.ModeDir | 0755},
+			{path: "/app/lib/old.so", size: 1000, mode: 0644},
+			{path: "/app/lib/dep.so", size: 2000, mode: 0644},
+		},
+		[]testFile{
+			{path: "/app/bin", size: 500, mode: 0755},
+		},
+	)
+	b := testImage(t,
+		[]testFile{
+			{path: "/etc", mode: os.ModeDir | 0755},
+			{path: "/etc/config", size: 100, mode: 0644},
+			{path: "/app", mode: os.ModeDir | 0755},
+		},
+		[]testFile{
+			{path: "/app/bin", size: 800, mode: 0700},
+			{path: "/app/share", mode: os.ModeDir | 0755},
+			{path: "/app/share/readme", size: 50, mode: 0644},
+		},
+	)
+
+	result, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("unable to diff: %v", err)
+	}
+	if len(result.PathErrors) > 0 {
+		t.Fatalf("unexpected path errors: %v", result.PathErrors)
+	}
+
+	assertPaths(t, "added", result.Added, "/app/share/readme")
+	assertPaths(t, "removed", result.Removed, "/app/lib/dep.so", "/app/lib/old.so")
+	assertPaths(t, "modified", result.Modified, "/app/bin")
+
+	bin := result.Modified[0]
+	if bin.SizeBefore != 500 || bin.SizeAfter != 800 || bin.SizeDelta() != 300 {
+		t.Errorf("unexpected sizes for %s: %+v", bin.Path, bin)
+	}
+	for _, removed := range result.Removed {
+		if removed.SizeAfter != 0 || removed.SizeBefore == 0 {
+			t.Errorf("unexpected sizes for %s: %+v", removed.Path, removed)
+		}
+	}
+
+	// readme (+50), bin (+300), old.so (-1000), dep.so (-2000)
+	if delta := result.SizeDelta(); delta != -2650 {
+		t.Errorf("expected a size delta of -2650, got %d", delta)
+	}
+
+	// the removed directory is marked on the combined tree, along with everything within it
+	node, err := result.Tree.GetNode("/app/lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Tree.DiffType(node) != filetree.Removed {
+		t.Errorf("expected /app/lib to be removed, got %v", result.Tree.DiffType(node))
+	}
+}
+
+func TestDiff_Symmetric(t *testing.T) {
+	img, err := Load(context.Background(), dive.SourceDockerArchive, testArchive, Options{})
+	if err != nil {
+		t.Fatalf("unable to load image: %v", err)
+	}
+	base := &image.Image{Trees: img.Trees[:7]}
+
+	same, err := Diff(img, img)
+	if err != nil {
+		t.Fatalf("unable to diff: %v", err)
+	}
+	if len(same.Added)+len(same.Removed)+len(same.Modified) > 0 {
+		t.Errorf("expected no changes between identical images, got %+v", same)
+	}
+
+	forward, err := Diff(base, img)
+	if err != nil {
+		t.Fatalf("unable to diff: %v", err)
+	}
+	backward, err := Diff(img, base)
+	if err != nil {
+		t.Fatalf("unable to diff: %v", err)
+	}
+
+	if len(forward.Added) == 0 {
+		t.Fatalf("expected files to be added by the later layers")
+	}
+	assertPaths(t, "removed", backward.Removed, changedPaths(forward.Added)...)
+	assertPaths(t, "added", backward.Added, changedPaths(forward.Removed)...)
+	assertPaths(t, "modified", backward.Modified, changedPaths(forward.Modified)...)
+
+	if forward.SizeDelta() != -backward.SizeDelta() {
+		t.Errorf("expected opposite size deltas, got %d and %d", forward.SizeDelta(), backward.SizeDelta())
+	}
+
+	if _, err := Diff(&image.Image{}, img); err == nil {
+		t.Errorf("expected an error comparing an image without layers")
+	}
+}
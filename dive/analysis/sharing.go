@@ -0,0 +1,172 @@
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+// SharedLayer is a distinct layer (by digest) and the images that hold it.
+type SharedLayer struct {
+	Digest  string
+	Size    uint64
+	Command string
+	// Images are the names of the images that hold the layer
+	Images []string
+}
+
+// Shared indicates the layer is held by more than one image.
+func (l SharedLayer) Shared() bool {
+	return len(l.Images) > 1
+}
+
+// ImageSharing describes how much of an image is shared with the other images.
+type ImageSharing struct {
+	Name      string
+	Layers    int
+	SizeBytes uint64
+	// SharedBytes is the size of the layers of the image that are also held by another image
+	SharedBytes uint64
+	// BaseLayers is the number of layers of the expected base that the image starts with
+	BaseLayers int
+	// Diverged indicates the image does not start with every layer of the expected base
+	Diverged bool
+}
+
+// SharingResult describes the layers shared between several images.
+type SharingResult struct {
+	Images []ImageSharing
+	// Layers are the distinct layers of all images (in order of first appearance), layers without a digest are not
+	// included since they cannot be matched
+	Layers []SharedLayer
+	// Base are the layer digests that every image is expected to start with
+	Base []string
+	// TotalBytes is the size of the layers of every image, as if no layer were shared
+	TotalBytes uint64
+	// UniqueBytes is the size of the distinct layers (what is stored when layers are shared)
+	UniqueBytes uint64
+}
+
+// DeduplicatedBytes is the size saved by sharing layers between the images.
+func (r *SharingResult) DeduplicatedBytes() uint64 {
+	return r.TotalBytes - r.UniqueBytes
+}
+
+// Divergent are the images that do not start with the expected base.
+func (r *SharingResult) Divergent() []ImageSharing {
+	var divergent []ImageSharing
+	for _, img := range r.Images {
+		if img.Diverged {
+			divergent = append(divergent, img)
+		}
+	}
+	return divergent
+}
+
+// Sharing determines which layers (by image.Layer.Digest) are shared between the given images (named by names, in the
+// same order) and which images diverge from the expected base. The expected base is the layers of the given base
+// image, or when base is nil, the longest layer prefix shared by a majority of the images.
+func Sharing(names []string, images []*image.Image, base *image.Image) (*SharingResult, error) {
+	if len(names) != len(images) {
+		return nil, fmt.Errorf("expected a name for each of the %d images, got %d", len(images), len(names))
+	}
+
+	result := &SharingResult{}
+	layerIndex := make(map[string]int)
+	// lastHolder is the index of the last image found to hold each layer
+	lastHolder := make(map[string]int)
+	digests := make([][]string, len(images))
+
+	for idx, img := range images {
+		sharing := ImageSharing{Name: names[idx], Layers: len(img.Layers)}
+		for _, layer := range img.Layers {
+			sharing.SizeBytes += layer.Size
+			result.TotalBytes += layer.Size
+
+			digest := layerDigest(layer)
+			digests[idx] = append(digests[idx], digest)
+			if digest == "" {
+				result.UniqueBytes += layer.Size
+				continue
+			}
+
+			pos, exists := layerIndex[digest]
+			if !exists {
+				pos = len(result.Layers)
+				layerIndex[digest] = pos
+				result.Layers = append(result.Layers, SharedLayer{Digest: digest, Size: layer.Size, Command: layer.Command})
+				result.UniqueBytes += layer.Size
+			}
+			// a layer may appear more than once within an image (e.g. several empty layers)
+			if holder, held := lastHolder[digest]; !held || holder != idx {
+				lastHolder[digest] = idx
+				result.Layers[pos].Images = append(result.Layers[pos].Images, names[idx])
+			}
+		}
+		result.Images = append(result.Images, sharing)
+	}
+
+	for idx, img := range images {
+		for _, layer := range img.Layers {
+			if digest := layerDigest(layer); digest != "" && result.Layers[layerIndex[digest]].Shared() {
+				result.Images[idx].SharedBytes += layer.Size
+			}
+		}
+	}
+
+	if base != nil {
+		for _, layer := range base.Layers {
+			result.Base = append(result.Base, layerDigest(layer))
+		}
+	} else {
+		result.Base = majorityBase(digests)
+	}
+
+	for idx := range result.Images {
+		matched := commonPrefix(digests[idx], result.Base)
+		result.Images[idx].BaseLayers = matched
+		result.Images[idx].Diverged = matched < len(result.Base)
+	}
+
+	return result, nil
+}
+
+// layerDigest is the digest identifying the contents of the layer (empty when unknown, e.g. for a directory).
+func layerDigest(layer *image.Layer) string {
+	if layer.Digest == "<missing>" {
+		return ""
+	}
+	return layer.Digest
+}
+
+// majorityBase is the longest prefix of layer digests held by more than half of the images.
+func majorityBase(digests [][]string) []string {
+	var base []string
+	for depth := 0; ; depth++ {
+		counts := make(map[string]int)
+		var best string
+		for _, layers := range digests {
+			if len(layers) <= depth || commonPrefix(layers, base) < len(base) || layers[depth] == "" {
+				continue
+			}
+			digest := layers[depth]
+			counts[digest]++
+			if counts[digest] > counts[best] {
+				best = digest
+			}
+		}
+		if counts[best]*2 <= len(digests) {
+			return base
+		}
+		base = append(base, best)
+	}
+}
+
+// commonPrefix is the number of leading digests held by both lists (digests that are unknown never match).
+func commonPrefix(a, b []string) int {
+	var idx int
+	for idx < len(a) && idx < len(b) && a[idx] != "" && a[idx] == b[idx] {
+		idx++
+	}
+	return idx
+}
@@ -0,0 +1,111 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+// testLayers returns an image with a layer of the given size for each digest
+func testLayers(digests ...string) *image.Image {
+	sizes := map[string]uint64{"base-1": 1000, "base-2": 200, "runtime": 50, "empty": 0}
+	img := &image.Image{}
+	for idx, digest := range digests {
+		size, ok := sizes[digest]
+		if !ok {
+			size = 10
+		}
+		img.Layers = append(img.Layers, &image.Layer{Index: idx, Digest: digest, Size: size})
+	}
+	return img
+}
+
+func TestSharing(t *testing.T) {
+	names := []string{"svc-a", "svc-b", "svc-c", "svc-d"}
+	images := []*image.Image{
+		testLayers("base-1", "base-2", "runtime", "app-a"),
+		testLayers("base-1", "base-2", "empty", "app-b", "empty"),
+		testLayers("base-1", "base-2", "runtime", "app-c"),
+		testLayers("other-base", "app-d", ""),
+	}
+
+	result, err := Sharing(names, images, nil)
+	if err != nil {
+		t.Fatalf("unable to determine sharing: %v", err)
+	}
+
+	if expected := []string{"base-1", "base-2"}; !reflect.DeepEqual(result.Base, expected) {
+		t.Errorf("expected base %v, got %v", expected, result.Base)
+	}
+
+	var divergent []string
+	for _, img := range result.Divergent() {
+		divergent = append(divergent, img.Name)
+	}
+	if expected := []string{"svc-d"}; !reflect.DeepEqual(divergent, expected) {
+		t.Errorf("expected divergent images %v, got %v", expected, divergent)
+	}
+
+	// base layers are held three times, the runtime twice, and the remaining layers are 10 bytes each
+	if result.TotalBytes != 3*1200+2*50+6*10 {
+		t.Errorf("unexpected total bytes: %d", result.TotalBytes)
+	}
+	if result.DeduplicatedBytes() != 2*1200+50 {
+		t.Errorf("unexpected deduplicated bytes: %d", result.DeduplicatedBytes())
+	}
+
+	holders := make(map[string][]string)
+	for _, layer := range result.Layers {
+		holders[layer.Digest] = layer.Images
+	}
+	if expected := []string{"svc-a", "svc-b", "svc-c"}; !reflect.DeepEqual(holders["base-1"], expected) {
+		t.Errorf("expected base-1 to be held by %v, got %v", expected, holders["base-1"])
+	}
+	if expected := []string{"svc-b"}; !reflect.DeepEqual(holders["empty"], expected) {
+		t.Errorf("expected the empty layer to be held by %v, got %v", expected, holders["empty"])
+	}
+	if _, exists := holders[""]; exists {
+		t.Errorf("expected layers without a digest to be excluded")
+	}
+
+	if shared := result.Images[0].SharedBytes; shared != 1250 {
+		t.Errorf("expected svc-a to share 1250 bytes, got %d", shared)
+	}
+	if shared := result.Images[3].SharedBytes; shared != 0 {
+		t.Errorf("expected svc-d to share no bytes, got %d", shared)
+	}
+}
+
+func TestSharing_ExplicitBase(t *testing.T) {
+	names := []string{"svc-a", "svc-b"}
+	images := []*image.Image{
+		testLayers("base-1", "base-2", "app-a"),
+		testLayers("base-1", "app-b"),
+	}
+
+	result, err := Sharing(names, images, testLayers("base-1", "base-2"))
+	if err != nil {
+		t.Fatalf("unable to determine sharing: %v", err)
+	}
+
+	if !reflect.DeepEqual(result.Base, []string{"base-1", "base-2"}) {
+		t.Errorf("unexpected base: %v", result.Base)
+	}
+	if result.Images[0].Diverged || !result.Images[1].Diverged || result.Images[1].BaseLayers != 1 {
+		t.Errorf("expected only svc-b to diverge (after 1 base layer), got %+v", result.Images)
+	}
+
+	if _, err := Sharing(names, images[:1], nil); err == nil {
+		t.Errorf("expected an error when the names do not match the images")
+	}
+
+	// without a majority there is no expected base to diverge from
+	result, err = Sharing(names, []*image.Image{testLayers("base-1"), testLayers("other-base")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Base) != 0 || len(result.Divergent()) != 0 {
+		t.Errorf("expected no base and no divergent images, got %v and %+v", result.Base, result.Divergent())
+	}
+}
@@ -0,0 +1,48 @@
+package filetree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ComparePolicy selects the file attributes considered (in addition to the type, contents, mode and owner IDs) when
+// determining if a file has been modified between layers.
+type ComparePolicy uint
+
+const (
+	// CompareXattrs considers the extended attributes of files (e.g. "security.capability")
+	CompareXattrs ComparePolicy = 1 << iota
+	// CompareModTime considers the modification times of files
+	CompareModTime
+	// CompareDevice considers the major and minor numbers of device files
+	CompareDevice
+	// CompareOwnerNames considers the user and group names of file owners
+	CompareOwnerNames
+)
+
+// DefaultComparePolicy does not consider modification times or owner names, which tend to change between builds
+// without changing the files.
+const DefaultComparePolicy = CompareXattrs | CompareDevice
+
+// GlobalComparePolicy is the policy used by FileInfo.Compare (and so when comparing trees).
+var GlobalComparePolicy = DefaultComparePolicy
+
+var comparePolicyNames = map[string]ComparePolicy{
+	"xattrs": CompareXattrs,
+	"mtime":  CompareModTime,
+	"device": CompareDevice,
+	"owner":  CompareOwnerNames,
+}
+
+// ParseComparePolicy builds a policy from the given attribute names ("xattrs", "mtime", "device" and "owner").
+func ParseComparePolicy(names []string) (ComparePolicy, error) {
+	var policy ComparePolicy
+	for _, name := range names {
+		attribute, ok := comparePolicyNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return 0, fmt.Errorf("unknown file attribute to compare: '%s' (expected one of: xattrs, mtime, device, owner)", name)
+		}
+		policy |= attribute
+	}
+	return policy, nil
+}
@@ -1,7 +1,10 @@
 package filetree
 
 import (
+	"container/list"
+	"context"
 	"fmt"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
@@ -30,17 +33,35 @@ func (index TreeIndexKey) String() string {
 	return fmt.Sprintf("Index(%d-%d:%d-%d)", index.bottomTreeStart, index.bottomTreeStop, index.topTreeStart, index.topTreeStop)
 }
 
+// extends indicates if the index compares the same trees as the given index, along with further top trees.
+func (index TreeIndexKey) extends(other TreeIndexKey) bool {
+	return index.bottomTreeStart == other.bottomTreeStart && index.bottomTreeStop == other.bottomTreeStop &&
+		index.topTreeStart == other.topTreeStart && index.topTreeStop > other.topTreeStop
+}
+
+// DefaultComparerCapacity is the number of trees a Comparer holds on to by default (see NewComparerWithCapacity).
+const DefaultComparerCapacity = 8
+
+// Comparer builds the trees comparing a range of layers (the top trees) to the layers stacked beneath them (the
+// bottom trees) on demand. Only the most recently used trees are held on to, so that the memory used does not depend
+// on the number of layers. Stacked bottom trees are built from the stack of the layers beneath them when held (e.g.
+// the stack of layers 0-4 is the stack of layers 0-3 with layer 4 stacked on top).
 type Comparer struct {
-	refTrees   []*FileTree
-	trees      map[TreeIndexKey]*FileTree
-	pathErrors map[TreeIndexKey][]PathError
+	refTrees []*FileTree
+	cache    *comparerCache
 }
 
+// NewComparer creates a comparer of the given layer trees holding on to DefaultComparerCapacity trees.
 func NewComparer(refTrees []*FileTree) Comparer {
+	return NewComparerWithCapacity(refTrees, DefaultComparerCapacity)
+}
+
+// NewComparerWithCapacity creates a comparer of the given layer trees holding on to (at most) the given number of trees,
+// which includes both the comparison trees and the stacked bottom trees they are built from.
+func NewComparerWithCapacity(refTrees []*FileTree, capacity int) Comparer {
 	return Comparer{
-		refTrees:   refTrees,
-		trees:      make(map[TreeIndexKey]*FileTree),
-		pathErrors: make(map[TreeIndexKey][]PathError),
+		refTrees: refTrees,
+		cache:    newComparerCache(capacity),
 	}
 }
 
@@ -53,27 +74,26 @@ func (cmp *Comparer) GetPathErrors(key TreeIndexKey) ([]PathError, error) {
 }
 
 func (cmp *Comparer) GetTree(key TreeIndexKey) (*FileTree, error) {
-	// func (cmp *Comparer) GetTree(bottomTreeStart, bottomTreeStop, topTreeStart, topTreeStop int) (*FileTree, []PathError, error) {
-	// key := TreeIndexKey{bottomTreeStart, bottomTreeStop, topTreeStart, topTreeStop}
-
-	if value, exists := cmp.trees[key]; exists {
-		return value, nil
-	}
-
-	value, pathErrors, err := cmp.get(key)
+	tree, _, err := cmp.get(key)
 	if err != nil {
 		return nil, err
 	}
-	cmp.trees[key] = value
-	cmp.pathErrors[key] = pathErrors
-	return value, nil
+	return tree, nil
 }
 
 func (cmp *Comparer) get(key TreeIndexKey) (*FileTree, []PathError, error) {
-	newTree, pathErrors, err := StackTreeRange(cmp.refTrees, key.bottomTreeStart, key.bottomTreeStop)
+	if entry, exists := cmp.cache.get(comparerKey{index: key}); exists {
+		return entry.tree, entry.pathErrors, nil
+	}
+
+	bottomTree, bottomPathErrors, err := cmp.stack(key.bottomTreeStart, key.bottomTreeStop)
 	if err != nil {
 		return nil, nil, err
 	}
+
+	// the stacked tree is shared with the following stacks, so the comparison is made on a copy
+	newTree := bottomTree.Copy()
+	pathErrors := append([]PathError(nil), bottomPathErrors...)
 	for idx := key.topTreeStart; idx <= key.topTreeStop; idx++ {
 		markPathErrors, err := newTree.CompareAndMark(cmp.refTrees[idx])
 		pathErrors = append(pathErrors, markPathErrors...)
@@ -82,9 +102,47 @@ func (cmp *Comparer) get(key TreeIndexKey) (*FileTree, []PathError, error) {
 			return nil, nil, err
 		}
 	}
+	cmp.cache.add(comparerKey{index: key}, newTree, pathErrors)
 	return newTree, pathErrors, nil
 }
 
+// stack returns the given range of trees stacked on the first tree (as StackTreeRange does), building on the stack of
+// the longest range held that the given range extends. The returned tree must not be altered.
+func (cmp *Comparer) stack(start, stop int) (*FileTree, []PathError, error) {
+	stackKey := func(stop int) comparerKey {
+		return comparerKey{index: TreeIndexKey{bottomTreeStart: start, bottomTreeStop: stop}, stacked: true}
+	}
+	if entry, exists := cmp.cache.get(stackKey(stop)); exists {
+		return entry.tree, entry.pathErrors, nil
+	}
+
+	var tree *FileTree
+	pathErrors := make([]PathError, 0)
+	next := start
+	for prev := stop - 1; prev >= start; prev-- {
+		if entry, exists := cmp.cache.get(stackKey(prev)); exists {
+			tree = entry.tree.Copy()
+			pathErrors = append(pathErrors, entry.pathErrors...)
+			next = prev + 1
+			break
+		}
+	}
+	if tree == nil {
+		tree = cmp.refTrees[0].Copy()
+	}
+
+	for idx := next; idx <= stop; idx++ {
+		failedPaths, err := tree.Stack(cmp.refTrees[idx])
+		pathErrors = append(pathErrors, failedPaths...)
+		if err != nil {
+			logrus.Errorf("could not stack tree range: %v", err)
+			return nil, nil, err
+		}
+	}
+	cmp.cache.add(stackKey(stop), tree, pathErrors)
+	return tree, pathErrors, nil
+}
+
 // case 1: layer compare (top tree SIZE is fixed (BUT floats forward), Bottom tree SIZE changes)
 func (cmp *Comparer) NaturalIndexes() <-chan TreeIndexKey {
 	indexes := make(chan TreeIndexKey)
@@ -148,27 +206,146 @@ func (cmp *Comparer) AggregatedIndexes() <-chan TreeIndexKey {
 	return indexes
 }
 
-func (cmp *Comparer) BuildCache() (errors []error) {
+// CacheProgress is called as the comparison trees are built, with the number of trees built so far out of the total.
+type CacheProgress func(built, total int)
+
+// BuildCache builds the tree of every natural layer comparison in turn (stacking each layer on the stack of the layers
+// beneath it) and then of every aggregated layer comparison (marking each layer on the comparison of the layers
+// beneath it), reporting every path error found along the way, and stopping early (with the context error as the last
+// error) once the given context is done. Only the most recently built natural trees are held on to, the remaining
+// trees (along with every aggregated tree) are built again as they are needed. The progress function is optional.
+func (cmp *Comparer) BuildCache(ctx context.Context, progress CacheProgress) (errors []error) {
+	total := 2 * len(cmp.refTrees)
+	built := 0
+	entryBuilt := func() {
+		built++
+		if progress != nil {
+			progress(built, total)
+		}
+	}
+
+	natural := make(map[TreeIndexKey]bool)
 	for index := range cmp.NaturalIndexes() {
-		pathError, _ := cmp.GetPathErrors(index)
-		if len(pathError) > 0 {
-			for _, path := range pathError {
-				errors = append(errors, fmt.Errorf("path error at layer index %s: %s", index, path))
-			}
+		if err := ctx.Err(); err != nil {
+			return append(errors, err)
 		}
-		_, err := cmp.GetTree(index)
+		pathErrors, err := cmp.GetPathErrors(index)
 		if err != nil {
 			errors = append(errors, err)
 			return errors
 		}
+		for _, path := range pathErrors {
+			errors = append(errors, fmt.Errorf("path error at layer index %s: %s", index, path))
+		}
+		natural[index] = true
+		entryBuilt()
 	}
 
+	// each aggregated comparison is the previous one with the next layer marked, so they are walked with a single tree
+	// (which is not held on to) and only the path errors of the newly marked layer are reported for each of them (the
+	// path errors of the bottom stack are the ones of the first natural comparison)
+	var tree *FileTree
+	var previous TreeIndexKey
 	for index := range cmp.AggregatedIndexes() {
-		_, err := cmp.GetTree(index)
-		if err != nil {
-			errors = append(errors, err)
-			return errors
+		if err := ctx.Err(); err != nil {
+			return append(errors, err)
+		}
+		if natural[index] {
+			entryBuilt()
+			continue
+		}
+
+		next := index.topTreeStart
+		if tree != nil && index.extends(previous) {
+			next = previous.topTreeStop + 1
+		} else {
+			bottomTree, _, err := cmp.stack(index.bottomTreeStart, index.bottomTreeStop)
+			if err != nil {
+				errors = append(errors, err)
+				return errors
+			}
+			tree = bottomTree.Copy()
+		}
+
+		for idx := next; idx <= index.topTreeStop; idx++ {
+			pathErrors, err := tree.CompareAndMark(cmp.refTrees[idx])
+			for _, path := range pathErrors {
+				errors = append(errors, fmt.Errorf("path error at layer index %s: %s", index, path))
+			}
+			if err != nil {
+				logrus.Errorf("error while building tree: %+v", err)
+				errors = append(errors, err)
+				return errors
+			}
 		}
+		previous = index
+		entryBuilt()
 	}
 	return errors
 }
+
+type comparerKey struct {
+	index TreeIndexKey
+	// stacked trees are the bottom trees of a comparison (without comparing the top trees), these are never handed out
+	// so that further stacks may be built from them
+	stacked bool
+}
+
+type comparerEntry struct {
+	key        comparerKey
+	tree       *FileTree
+	pathErrors []PathError
+}
+
+// comparerCache holds on to the most recently used trees of a comparer (and is shared by all copies of the comparer).
+type comparerCache struct {
+	lock     sync.Mutex
+	capacity int
+	// order holds the entries from the most to the least recently used
+	order   *list.List
+	entries map[comparerKey]*list.Element
+}
+
+func newComparerCache(capacity int) *comparerCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &comparerCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[comparerKey]*list.Element),
+	}
+}
+
+func (c *comparerCache) get(key comparerKey) (*comparerEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	element, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*comparerEntry), true
+}
+
+func (c *comparerCache) add(key comparerKey, tree *FileTree, pathErrors []PathError) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if element, exists := c.entries[key]; exists {
+		element.Value = &comparerEntry{key: key, tree: tree, pathErrors: pathErrors}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&comparerEntry{key: key, tree: tree, pathErrors: pathErrors})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*comparerEntry).key)
+	}
+}
+
+func (c *comparerCache) len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.order.Len()
+}
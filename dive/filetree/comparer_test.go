@@ -0,0 +1,192 @@
+package filetree
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// comparerLayers creates layers adding, modifying and removing files (including a whiteout of a file that does not
+// exist, which is a path error).
+func comparerLayers(t *testing.T, count int) []*FileTree {
+	var trees []*FileTree
+	for idx := 0; idx < count; idx++ {
+		tree := NewFileTree()
+		tree.Name = fmt.Sprintf("layer-%d", idx)
+		paths := []string{
+			fmt.Sprintf("/layer%d/file", idx),
+			"/etc/shared",
+			fmt.Sprintf("/var/cache/%d", idx%3),
+		}
+		if idx > 0 {
+			paths = append(paths, fmt.Sprintf("/layer%d/.wh.file", idx-1))
+		}
+		if idx%4 == 3 {
+			paths = append(paths, "/missing/.wh.file")
+		}
+		for _, path := range paths {
+			info := FileInfo{Path: path, Size: int64(idx + 1), hash: uint64(idx)}
+			if _, _, err := tree.AddPath(path, info); err != nil {
+				t.Fatalf("unable to add %s: %v", path, err)
+			}
+		}
+		trees = append(trees, tree)
+	}
+	return trees
+}
+
+// describeTree lists the payload and diff type of every node of the given tree
+func describeTree(t *testing.T, tree *FileTree) []string {
+	var nodes []string
+	err := tree.VisitDepthParentFirst(func(node *FileNode) error {
+		nodes = append(nodes, fmt.Sprintf("%s %s %d %d", node.Path(), tree.DiffType(node), node.Data.FileInfo.Size, node.Data.FileInfo.hash))
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("unable to visit tree: %v", err)
+	}
+	return append(nodes, fmt.Sprintf("size %d", tree.Size))
+}
+
+// eagerTree builds the comparison of the given key from scratch
+func eagerTree(t *testing.T, trees []*FileTree, key TreeIndexKey) ([]string, []PathError) {
+	tree, pathErrors, err := StackTreeRange(trees, key.bottomTreeStart, key.bottomTreeStop)
+	if err != nil {
+		t.Fatalf("unable to stack trees: %v", err)
+	}
+	for idx := key.topTreeStart; idx <= key.topTreeStop; idx++ {
+		markPathErrors, err := tree.CompareAndMark(trees[idx])
+		if err != nil {
+			t.Fatalf("unable to compare trees: %v", err)
+		}
+		pathErrors = append(pathErrors, markPathErrors...)
+	}
+	return describeTree(t, tree), pathErrors
+}
+
+func comparerKeys(cmp *Comparer) []TreeIndexKey {
+	var keys []TreeIndexKey
+	for key := range cmp.NaturalIndexes() {
+		keys = append(keys, key)
+	}
+	for key := range cmp.AggregatedIndexes() {
+		keys = append(keys, key)
+	}
+	// the changes between two arbitrary layers (as compared in the layer range mode)
+	for lower := 1; lower < len(cmp.refTrees)-1; lower += 3 {
+		keys = append(keys, NewTreeIndexKey(0, lower, lower+1, min(lower+4, len(cmp.refTrees)-1)))
+	}
+	return keys
+}
+
+func TestComparer_GetTree(t *testing.T) {
+	trees := comparerLayers(t, 10)
+
+	for _, capacity := range []int{1, 2, DefaultComparerCapacity, 100} {
+		cmp := NewComparerWithCapacity(trees, capacity)
+		keys := comparerKeys(&cmp)
+
+		// forwards, backwards and then skipping around (so that stacks are built from scratch, from shorter stacks,
+		// and taken as they are)
+		var order []TreeIndexKey
+		order = append(order, keys...)
+		for idx := len(keys) - 1; idx >= 0; idx-- {
+			order = append(order, keys[idx])
+		}
+		for idx := 0; idx < len(keys); idx++ {
+			order = append(order, keys[(idx*7)%len(keys)])
+		}
+
+		for _, key := range order {
+			expectedTree, expectedErrors := eagerTree(t, trees, key)
+
+			tree, err := cmp.GetTree(key)
+			if err != nil {
+				t.Fatalf("capacity %d: %s: unable to get tree: %v", capacity, key, err)
+			}
+			if actual := describeTree(t, tree); !reflect.DeepEqual(expectedTree, actual) {
+				t.Fatalf("capacity %d: %s: expected tree:\n%s\ngot:\n%s", capacity, key, strings.Join(expectedTree, "\n"), strings.Join(actual, "\n"))
+			}
+
+			pathErrors, err := cmp.GetPathErrors(key)
+			if err != nil {
+				t.Fatalf("capacity %d: %s: unable to get path errors: %v", capacity, key, err)
+			}
+			if fmt.Sprint(expectedErrors) != fmt.Sprint(pathErrors) {
+				t.Errorf("capacity %d: %s: expected path errors %v, got %v", capacity, key, expectedErrors, pathErrors)
+			}
+
+			if held := cmp.cache.len(); held > capacity {
+				t.Fatalf("capacity %d: %s: holding %d trees", capacity, key, held)
+			}
+		}
+	}
+
+	// the reference trees are never altered
+	for idx, tree := range comparerLayers(t, 10) {
+		if !reflect.DeepEqual(describeTree(t, tree), describeTree(t, trees[idx])) {
+			t.Errorf("layer %d: expected the reference tree to be unaltered", idx)
+		}
+	}
+}
+
+func TestComparer_BuildCache(t *testing.T) {
+	trees := comparerLayers(t, 12)
+	cmp := NewComparerWithCapacity(trees, 3)
+
+	var expected []string
+	natural := make(map[TreeIndexKey]bool)
+	for key := range cmp.NaturalIndexes() {
+		_, pathErrors := eagerTree(t, trees, key)
+		for _, path := range pathErrors {
+			expected = append(expected, fmt.Sprintf("path error at layer index %s: %s", key, path))
+		}
+		natural[key] = true
+	}
+	// every aggregated comparison extends the previous one, reporting the path errors of the newly marked layer
+	_, previous, err := StackTreeRange(trees, 0, 0)
+	if err != nil {
+		t.Fatalf("unable to stack trees: %v", err)
+	}
+	for key := range cmp.AggregatedIndexes() {
+		if natural[key] {
+			continue
+		}
+		_, pathErrors := eagerTree(t, trees, key)
+		for _, path := range pathErrors[len(previous):] {
+			expected = append(expected, fmt.Sprintf("path error at layer index %s: %s", key, path))
+		}
+		previous = pathErrors
+	}
+	if len(expected) == 0 {
+		t.Fatalf("expected the layers to have path errors")
+	}
+
+	var progress [][2]int
+	errors := cmp.BuildCache(context.Background(), func(built, total int) {
+		progress = append(progress, [2]int{built, total})
+	})
+	var actual []string
+	for _, err := range errors {
+		actual = append(actual, err.Error())
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+	if len(progress) != 2*len(trees) || progress[len(progress)-1] != [2]int{2 * len(trees), 2 * len(trees)} {
+		t.Errorf("expected progress for every layer, got %v", progress)
+	}
+	if held := cmp.cache.len(); held > 3 {
+		t.Errorf("expected at most 3 trees to be held, got %d", held)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cmp = NewComparer(trees)
+	errors = cmp.BuildCache(ctx, nil)
+	if len(errors) != 1 || errors[0] != context.Canceled {
+		t.Errorf("expected the context error, got %v", errors)
+	}
+}
@@ -34,14 +34,14 @@ func (efs EfficiencySlice) Less(i, j int) bool {
 
 // Efficiency returns the score and file set of the given set of FileTrees (layers). This is loosely based on:
 // 1. Files that are duplicated across layers discounts your score, weighted by file size
-// 2. Files that are removed discounts your score, weighted by the original file size
+// 2. Files that are removed (or hidden by an opaque directory) discounts your score, weighted by the original file size
 func Efficiency(trees []*FileTree) (float64, EfficiencySlice) {
 	efficiencyMap := make(map[string]*EfficiencyData)
 	inefficientMatches := make(EfficiencySlice, 0)
 	currentTree := 0
 
-	visitor := func(node *FileNode) error {
-		path := node.Path()
+	// record takes note of a node found at the given path contributing the given size
+	record := func(path string, node *FileNode, sizeBytes int64) {
 		if _, ok := efficiencyMap[path]; !ok {
 			efficiencyMap[path] = &EfficiencyData{
 				Path:              path,
@@ -50,7 +50,18 @@ func Efficiency(trees []*FileTree) (float64, EfficiencySlice) {
 			}
 		}
 		data := efficiencyMap[path]
+		data.CumulativeSize += sizeBytes
+		if data.minDiscoveredSize < 0 || sizeBytes < data.minDiscoveredSize {
+			data.minDiscoveredSize = sizeBytes
+		}
+		data.Nodes = append(data.Nodes, node)
+
+		if len(data.Nodes) == 2 {
+			inefficientMatches = append(inefficientMatches, data)
+		}
+	}
 
+	visitor := func(node *FileNode) error {
 		// this node may have had children that were deleted, however, we won't explicitly list out every child, only
 		// the top-most parent with the cumulative size. These operations will need to be done on the full (stacked)
 		// tree.
@@ -89,16 +100,7 @@ func Efficiency(trees []*FileTree) (float64, EfficiencySlice) {
 			sizeBytes = node.Data.FileInfo.Size
 		}
 
-		data.CumulativeSize += sizeBytes
-		if data.minDiscoveredSize < 0 || sizeBytes < data.minDiscoveredSize {
-			data.minDiscoveredSize = sizeBytes
-		}
-		data.Nodes = append(data.Nodes, node)
-
-		if len(data.Nodes) == 2 {
-			inefficientMatches = append(inefficientMatches, data)
-		}
-
+		record(node.Path(), node, sizeBytes)
 		return nil
 	}
 	visitEvaluator := func(node *FileNode) bool {
@@ -106,6 +108,9 @@ func Efficiency(trees []*FileTree) (float64, EfficiencySlice) {
 	}
 	for idx, tree := range trees {
 		currentTree = idx
+		if idx > 0 {
+			hideLowerContents(trees, idx, record)
+		}
 		err := tree.VisitDepthChildFirst(visitor, visitEvaluator)
 		if err != nil {
 			logrus.Errorf("unable to propagate ref tree: %+v", err)
@@ -131,3 +136,38 @@ func Efficiency(trees []*FileTree) (float64, EfficiencySlice) {
 
 	return score, inefficientMatches
 }
+
+// hideLowerContents records the files of the lower trees hidden by the opaque directories of the tree at the given
+// index (and not replaced by it) as removed, so the hidden contents are counted as wasted.
+func hideLowerContents(trees []*FileTree, idx int, record func(string, *FileNode, int64)) {
+	dirs := trees[idx].opaqueDirs()
+	if len(dirs) == 0 {
+		return
+	}
+	stackedTree, failedPaths, err := StackTreeRange(trees, 0, idx-1)
+	for _, path := range failedPaths {
+		logrus.Errorf(path.String())
+	}
+	if err != nil {
+		logrus.Errorf("unable to stack tree range: %+v", err)
+		return
+	}
+
+	for _, dir := range dirs {
+		lowerDir, err := stackedTree.GetNode(dir.Path())
+		if err != nil {
+			continue
+		}
+		err = lowerDir.VisitDepthChildFirst(func(node *FileNode) error {
+			if _, err := trees[idx].GetNode(node.Path()); err != nil {
+				record(node.Path(), dir, 0)
+			}
+			return nil
+		}, func(node *FileNode) bool {
+			return node.IsLeaf() && !node.IsWhiteout()
+		}, nil)
+		if err != nil {
+			logrus.Errorf("unable to propagate opaque dir: %+v", err)
+		}
+	}
+}
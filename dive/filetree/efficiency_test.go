@@ -78,3 +78,46 @@ func TestEfficency_ScratchImage(t *testing.T) {
 	}
 
 }
+
+func TestEfficency_HardLinks(t *testing.T) {
+	trees := []*FileTree{hardLinkedTree(t), NewFileTree()}
+	trees[0].ResolveHardLinks()
+
+	// replacing the binary wastes its contents once, not once for each link to it
+	_, _, err := trees[1].AddPath("/bin/busybox", FileInfo{Size: 1000})
+	checkError(t, err, "could not setup test")
+
+	score, matches := Efficiency(trees)
+	if expected := 1000.0 / 2000.0; score != expected {
+		t.Errorf("Expected score of %v but got %v", expected, score)
+	}
+	if len(matches) != 1 || matches[0].Path != "/bin/busybox" || matches[0].CumulativeSize != 2000 {
+		t.Errorf("Expected only /bin/busybox to be inefficient, got %+v", matches)
+	}
+}
+
+func TestEfficency_OpaqueWhiteout(t *testing.T) {
+	lowerTree, upperTree := opaqueTrees(t)
+
+	score, matches := Efficiency([]*FileTree{lowerTree, upperTree})
+
+	// the hidden mime.types and default.conf are wasted, as is the replaced nginx.conf
+	wasted := map[string]int64{
+		"/etc/nginx/mime.types":          100,
+		"/etc/nginx/conf.d/default.conf": 100,
+		"/etc/nginx/nginx.conf":          110,
+	}
+	if len(matches) != len(wasted) {
+		t.Fatalf("Expected to find %d inefficient paths, but found %+v", len(wasted), matches)
+	}
+	for _, match := range matches {
+		if size, ok := wasted[match.Path]; !ok || size != match.CumulativeSize {
+			t.Errorf("unexpected inefficient path %s (%d bytes)", match.Path, match.CumulativeSize)
+		}
+	}
+
+	// of the 420 bytes discovered, only the hosts file, the new site.conf and the final nginx.conf are needed
+	if expected := 120.0 / 420.0; score != expected {
+		t.Errorf("Expected score of %v but got %v", expected, score)
+	}
+}
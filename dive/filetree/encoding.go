@@ -0,0 +1,153 @@
+package filetree
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// EncodingVersion identifies the format of encoded trees. It must change whenever the encoding changes, or when the
+// trees parsed from the same layer would differ (e.g. when FileInfo gains attributes), so that previously encoded
+// trees are no longer used.
+const EncodingVersion = 1
+
+type encodedTree struct {
+	Version  int
+	Name     string
+	FileSize uint64
+	Root     encodedNode
+}
+
+type encodedNode struct {
+	Name     string
+	Info     encodedFileInfo
+	Children []encodedNode
+}
+
+// encodedFileInfo mirrors FileInfo, including the unexported content hash
+type encodedFileInfo struct {
+	Path      string
+	TypeFlag  byte
+	Linkname  string
+	Hash      uint64
+	Size      int64
+	Mode      os.FileMode
+	Uid       int
+	Gid       int
+	IsDir     bool
+	HardLinks int
+	Opaque    bool
+	Xattrs    map[string]string
+	ModTime   time.Time
+	Devmajor  int64
+	Devminor  int64
+	Uname     string
+	Gname     string
+	Digest    string
+}
+
+// Encode writes the files of the tree (not any view or comparison state) to the given writer, to be read back with
+// DecodeFileTree.
+func (tree *FileTree) Encode(writer io.Writer) error {
+	encoded := encodedTree{
+		Version:  EncodingVersion,
+		Name:     tree.Name,
+		FileSize: tree.FileSize,
+		Root:     encodeNode(tree.Root),
+	}
+	return gob.NewEncoder(writer).Encode(&encoded)
+}
+
+func encodeNode(node *FileNode) encodedNode {
+	info := node.Data.FileInfo
+	encoded := encodedNode{
+		Name: node.Name,
+		Info: encodedFileInfo{
+			Path:      info.Path,
+			TypeFlag:  info.TypeFlag,
+			Linkname:  info.Linkname,
+			Hash:      info.hash,
+			Size:      info.Size,
+			Mode:      info.Mode,
+			Uid:       info.Uid,
+			Gid:       info.Gid,
+			IsDir:     info.IsDir,
+			HardLinks: info.HardLinks,
+			Opaque:    info.Opaque,
+			Xattrs:    info.Xattrs,
+			ModTime:   info.ModTime,
+			Devmajor:  info.Devmajor,
+			Devminor:  info.Devminor,
+			Uname:     info.Uname,
+			Gname:     info.Gname,
+			Digest:    info.Digest,
+		},
+	}
+
+	// children are encoded by name, so the same tree is always encoded the same way
+	names := make([]string, 0, len(node.Children))
+	for name := range node.Children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		encoded.Children = append(encoded.Children, encodeNode(node.Children[name]))
+	}
+	return encoded
+}
+
+// DecodeFileTree reads a tree written by FileTree.Encode. Trees encoded with another EncodingVersion are rejected.
+func DecodeFileTree(reader io.Reader) (*FileTree, error) {
+	var encoded encodedTree
+	if err := gob.NewDecoder(reader).Decode(&encoded); err != nil {
+		return nil, fmt.Errorf("unable to decode tree: %w", err)
+	}
+	if encoded.Version != EncodingVersion {
+		return nil, fmt.Errorf("unable to decode tree: unsupported version %d (expected %d)", encoded.Version, EncodingVersion)
+	}
+
+	tree := NewFileTree()
+	tree.Name = encoded.Name
+	tree.FileSize = encoded.FileSize
+	tree.Root.Data.FileInfo = encoded.Root.Info.fileInfo()
+	decodeChildren(tree, tree.Root, encoded.Root.Children)
+	return tree, nil
+}
+
+func decodeChildren(tree *FileTree, parent *FileNode, children []encodedNode) {
+	if len(children) > 0 && parent.Children == nil {
+		parent.Children = make(map[string]*FileNode, len(children))
+	}
+	for _, encoded := range children {
+		node := NewNode(parent, encoded.Name, encoded.Info.fileInfo())
+		parent.Children[encoded.Name] = node
+		tree.Size++
+		decodeChildren(tree, node, encoded.Children)
+	}
+}
+
+func (info encodedFileInfo) fileInfo() FileInfo {
+	return FileInfo{
+		Path:      info.Path,
+		TypeFlag:  info.TypeFlag,
+		Linkname:  info.Linkname,
+		hash:      info.Hash,
+		Size:      info.Size,
+		Mode:      info.Mode,
+		Uid:       info.Uid,
+		Gid:       info.Gid,
+		IsDir:     info.IsDir,
+		HardLinks: info.HardLinks,
+		Opaque:    info.Opaque,
+		Xattrs:    info.Xattrs,
+		ModTime:   info.ModTime,
+		Devmajor:  info.Devmajor,
+		Devminor:  info.Devminor,
+		Uname:     internOwnerName(info.Uname),
+		Gname:     internOwnerName(info.Gname),
+		Digest:    info.Digest,
+	}
+}
@@ -0,0 +1,89 @@
+package filetree
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecodeFileTree(t *testing.T) {
+	tree := hardLinkedTree(t)
+	tree.Name = "layer.tar"
+	tree.ResolveHardLinks()
+
+	_, opaque := opaqueTrees(t)
+	if _, _, err := tree.AddPath("/etc/nginx/.wh..wh..opq", FileInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tree.AddPath("/tmp/.wh.cache", FileInfo{Path: "/tmp/.wh.cache"}); err != nil {
+		t.Fatal(err)
+	}
+	ping := FileInfo{
+		Path: "/usr/bin/ping", TypeFlag: 0, Mode: 0755, Size: 10, hash: 7,
+		Xattrs:  map[string]string{"security.capability": "\x01"},
+		ModTime: time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC), Uname: "root", Gname: "root",
+		Digest: "sha256:aaaa",
+	}
+	if _, _, err := tree.AddPath(ping.Path, ping); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, original := range map[string]*FileTree{"hard links": tree, "opaque": opaque} {
+		var buf bytes.Buffer
+		if err := original.Encode(&buf); err != nil {
+			t.Fatalf("%s: unable to encode tree: %v", name, err)
+		}
+		decoded, err := DecodeFileTree(&buf)
+		if err != nil {
+			t.Fatalf("%s: unable to decode tree: %v", name, err)
+		}
+
+		if decoded.Name != original.Name || decoded.FileSize != original.FileSize || decoded.Size != original.Size {
+			t.Errorf("%s: expected tree %q (%d bytes, %d nodes), got %q (%d bytes, %d nodes)", name,
+				original.Name, original.FileSize, original.Size, decoded.Name, decoded.FileSize, decoded.Size)
+		}
+		if expected, actual := original.String(true), decoded.String(true); expected != actual {
+			t.Errorf("%s: unexpected tree:\nexpected:\n%s\nactual:\n%s", name, expected, actual)
+		}
+		assertSameNodes(t, name, original.Root, decoded.Root)
+	}
+}
+
+// assertSameNodes compares the payloads of the given nodes and of all their children (by name).
+func assertSameNodes(t *testing.T, name string, expected, actual *FileNode) {
+	t.Helper()
+	if !reflect.DeepEqual(expected.Data.FileInfo, actual.Data.FileInfo) {
+		t.Errorf("%s: %s: expected %+v, got %+v", name, expected.Path(), expected.Data.FileInfo, actual.Data.FileInfo)
+	}
+	if len(expected.Children) != len(actual.Children) {
+		t.Errorf("%s: %s: expected %d children, got %d", name, expected.Path(), len(expected.Children), len(actual.Children))
+	}
+	for childName, child := range expected.Children {
+		other, exists := actual.Children[childName]
+		if !exists {
+			t.Errorf("%s: missing %s", name, child.Path())
+			continue
+		}
+		if other.Parent != actual || other.Tree != actual.Tree {
+			t.Errorf("%s: %s is not attached to the decoded tree", name, child.Path())
+		}
+		assertSameNodes(t, name, child, other)
+	}
+}
+
+func TestDecodeFileTree_Version(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&encodedTree{Version: EncodingVersion + 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeFileTree(&buf); err == nil || !strings.Contains(err.Error(), "unsupported version") {
+		t.Errorf("expected an unsupported version error, got %v", err)
+	}
+
+	if _, err := DecodeFileTree(strings.NewReader("not a tree")); err == nil {
+		t.Errorf("expected an error for an invalid tree")
+	}
+}
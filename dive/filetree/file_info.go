@@ -2,31 +2,87 @@ package filetree
 
 import (
 	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/cespare/xxhash"
-	"github.com/sirupsen/logrus"
 )
 
 // FileInfo contains tar metadata for a specific FileNode
 type FileInfo struct {
 	Path     string
-	TypeFlag byte
 	Linkname string
 	hash     uint64
 	Size     int64
+	// the small fields are kept together, as there is a FileInfo for every node of (potentially very large) trees
 	Mode     os.FileMode
-	Uid      int
-	Gid      int
+	TypeFlag byte
 	IsDir    bool
+	// Opaque indicates the directory hides the contents of the same directory in lower layers (marked by an opaque
+	// whiteout file within the directory)
+	Opaque bool
+	Uid    int
+	Gid    int
+	// HardLinks is the number of hard links to this file within its layer (see FileTree.ResolveHardLinks)
+	HardLinks int
+	// Xattrs are the extended attributes of the file (e.g. "security.capability"), keyed by name
+	Xattrs   map[string]string
+	ModTime  time.Time
+	Devmajor int64
+	Devminor int64
+	Uname    string
+	Gname    string
+	// Digest is the cryptographic digest of the contents of a regular file (e.g. "sha256:<hex>"), only computed when
+	// requested (see DigestAlgorithm)
+	Digest string
+}
+
+// DigestAlgorithm selects the cryptographic digest computed for the contents of regular files, if any.
+type DigestAlgorithm string
+
+const (
+	// NoDigest skips computing digests (file contents are still hashed for comparison)
+	NoDigest DigestAlgorithm = ""
+	// DigestSHA256 computes the SHA-256 digest of regular files
+	DigestSHA256 DigestAlgorithm = "sha256"
+)
+
+// ParseDigestAlgorithm returns the algorithm of the given name ("sha256", or "none"/empty for no digests).
+func ParseDigestAlgorithm(name string) (DigestAlgorithm, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "none":
+		return NoDigest, nil
+	case string(DigestSHA256):
+		return DigestSHA256, nil
+	}
+	return NoDigest, fmt.Errorf("unsupported file digest algorithm: '%s' (expected sha256)", name)
 }
 
 // NewFileInfoFromTarHeader extracts the metadata from a tar header and file contents and generates a new FileInfo object.
-func NewFileInfoFromTarHeader(reader *tar.Reader, header *tar.Header, path string) FileInfo {
+func NewFileInfoFromTarHeader(reader *tar.Reader, header *tar.Header, path string) (FileInfo, error) {
+	return NewFileInfoFromTarHeaderWithDigest(reader, header, path, NoDigest)
+}
+
+// NewFileInfoFromTarHeaderWithDigest is NewFileInfoFromTarHeader, additionally computing the given digest for regular
+// files.
+func NewFileInfoFromTarHeaderWithDigest(reader *tar.Reader, header *tar.Header, path string, algorithm DigestAlgorithm) (FileInfo, error) {
 	var hash uint64
+	var digest string
 	if header.Typeflag != tar.TypeDir {
-		hash = getHashFromReader(reader)
+		if header.Typeflag != tar.TypeReg {
+			algorithm = NoDigest
+		}
+		var err error
+		hash, digest, err = hashContents(reader, algorithm)
+		if err != nil {
+			return FileInfo{}, fmt.Errorf("unable to read %s: %w", path, err)
+		}
 	}
 
 	return FileInfo{
@@ -39,105 +95,248 @@ func NewFileInfoFromTarHeader(reader *tar.Reader, header *tar.Header, path strin
 		Uid:      header.Uid,
 		Gid:      header.Gid,
 		IsDir:    header.FileInfo().IsDir(),
+		Xattrs:   xattrsFromTarHeader(header),
+		ModTime:  header.ModTime,
+		Devmajor: header.Devmajor,
+		Devminor: header.Devminor,
+		Uname:    internOwnerName(header.Uname),
+		Gname:    internOwnerName(header.Gname),
+		Digest:   digest,
+	}, nil
+}
+
+var (
+	ownerNamesLock sync.RWMutex
+	ownerNames     = make(map[string]string)
+)
+
+// internOwnerName returns the single shared instance of the given user or group name, as images typically have
+// millions of files owned by a handful of users.
+func internOwnerName(name string) string {
+	if name == "" {
+		return name
+	}
+	ownerNamesLock.RLock()
+	interned, exists := ownerNames[name]
+	ownerNamesLock.RUnlock()
+	if exists {
+		return interned
+	}
+
+	ownerNamesLock.Lock()
+	defer ownerNamesLock.Unlock()
+	if interned, exists := ownerNames[name]; exists {
+		return interned
 	}
+	ownerNames[name] = name
+	return name
 }
 
-func NewFileInfo(realPath, path string, info os.FileInfo) FileInfo {
-	var err error
+// xattrsFromTarHeader returns the extended attributes recorded in the PAX records of the given header (if any).
+func xattrsFromTarHeader(header *tar.Header) map[string]string {
+	const prefix = "SCHILY.xattr."
+	var xattrs map[string]string
+	for key, value := range header.PAXRecords {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if xattrs == nil {
+			xattrs = make(map[string]string)
+		}
+		xattrs[strings.TrimPrefix(key, prefix)] = value
+	}
+	return xattrs
+}
+
+// NewFileInfo generates a new FileInfo object from a file on disk (at realPath), to be placed at the given path
+// within a tree. Symlinks are not followed and only regular file contents are hashed, matching the tar-based FileInfos.
+func NewFileInfo(realPath, path string, info os.FileInfo) (FileInfo, error) {
+	return NewFileInfoWithDigest(realPath, path, info, NoDigest)
+}
 
-	// todo: don't use tar types here, create our own...
+// NewFileInfoWithDigest is NewFileInfo, additionally computing the given digest for regular files.
+func NewFileInfoWithDigest(realPath, path string, info os.FileInfo, algorithm DigestAlgorithm) (FileInfo, error) {
 	var fileType byte
 	var linkName string
 	var size int64
+	var err error
 
-	if info.Mode()&os.ModeSymlink != 0 {
+	mode := info.Mode()
+	switch {
+	case mode&os.ModeSymlink != 0:
 		fileType = tar.TypeSymlink
 
 		linkName, err = os.Readlink(realPath)
 		if err != nil {
-			logrus.Panic("unable to read link:", realPath, err)
+			return FileInfo{}, fmt.Errorf("unable to read link %s: %w", realPath, err)
 		}
-	} else if info.IsDir() {
+	case info.IsDir():
 		fileType = tar.TypeDir
-	} else {
+	case mode&os.ModeNamedPipe != 0:
+		fileType = tar.TypeFifo
+	case mode&os.ModeCharDevice != 0:
+		fileType = tar.TypeChar
+	case mode&os.ModeDevice != 0:
+		fileType = tar.TypeBlock
+	default:
 		fileType = tar.TypeReg
 
 		size = info.Size()
 	}
 
 	var hash uint64
-	if fileType != tar.TypeDir {
+	var digest string
+	switch fileType {
+	case tar.TypeDir:
+	case tar.TypeReg:
 		file, err := os.Open(realPath)
 		if err != nil {
-			logrus.Panic("unable to read file:", realPath)
+			return FileInfo{}, fmt.Errorf("unable to read file %s: %w", realPath, err)
 		}
 		defer file.Close()
-		hash = getHashFromReader(file)
+		hash, digest, err = hashContents(file, algorithm)
+		if err != nil {
+			return FileInfo{}, fmt.Errorf("unable to read file %s: %w", realPath, err)
+		}
+	default:
+		// entries without contents (as they would appear in a tar)
+		hash = xxhash.Sum64(nil)
 	}
 
+	uid, gid := fileOwner(info)
+
 	return FileInfo{
 		Path:     path,
 		TypeFlag: fileType,
 		Linkname: linkName,
 		hash:     hash,
 		Size:     size,
+		Mode:     mode,
+		Uid:      uid,
+		Gid:      gid,
+		IsDir:    info.IsDir(),
+		ModTime:  info.ModTime(),
+		Digest:   digest,
+	}, nil
+}
+
+// NewHardLinkFileInfo generates the FileInfo of a file on disk that is a hard link to the given earlier path of the
+// same tree (as it would appear in a tar), without reading its contents.
+func NewHardLinkFileInfo(path, linkName string, info os.FileInfo) FileInfo {
+	uid, gid := fileOwner(info)
+
+	return FileInfo{
+		Path:     path,
+		TypeFlag: tar.TypeLink,
+		Linkname: linkName,
+		hash:     xxhash.Sum64(nil),
 		Mode:     info.Mode(),
-		// todo: support UID/GID
-		Uid:   -1,
-		Gid:   -1,
-		IsDir: info.IsDir(),
+		Uid:      uid,
+		Gid:      gid,
+		ModTime:  info.ModTime(),
 	}
 }
 
+// Hash is the hash of the file contents (as used to tell modified files apart, this is not a cryptographic digest)
+func (data *FileInfo) Hash() uint64 {
+	return data.hash
+}
+
 // Copy duplicates a FileInfo
 func (data *FileInfo) Copy() *FileInfo {
 	if data == nil {
 		return nil
 	}
 	return &FileInfo{
-		Path:     data.Path,
-		TypeFlag: data.TypeFlag,
-		Linkname: data.Linkname,
-		hash:     data.hash,
-		Size:     data.Size,
-		Mode:     data.Mode,
-		Uid:      data.Uid,
-		Gid:      data.Gid,
-		IsDir:    data.IsDir,
+		Path:      data.Path,
+		TypeFlag:  data.TypeFlag,
+		Linkname:  data.Linkname,
+		hash:      data.hash,
+		Size:      data.Size,
+		Mode:      data.Mode,
+		Uid:       data.Uid,
+		Gid:       data.Gid,
+		IsDir:     data.IsDir,
+		HardLinks: data.HardLinks,
+		Opaque:    data.Opaque,
+		Xattrs:    copyXattrs(data.Xattrs),
+		ModTime:   data.ModTime,
+		Devmajor:  data.Devmajor,
+		Devminor:  data.Devminor,
+		Uname:     data.Uname,
+		Gname:     data.Gname,
+		Digest:    data.Digest,
 	}
 }
 
-// Compare determines the DiffType between two FileInfos based on the type and contents of each given FileInfo
-func (data *FileInfo) Compare(other FileInfo) DiffType {
-	if data.TypeFlag == other.TypeFlag {
-		if data.hash == other.hash &&
-			data.Mode == other.Mode &&
-			data.Uid == other.Uid &&
-			data.Gid == other.Gid {
-			return Unmodified
-		}
+func copyXattrs(xattrs map[string]string) map[string]string {
+	if xattrs == nil {
+		return nil
 	}
-	return Modified
+	duplicate := make(map[string]string, len(xattrs))
+	for key, value := range xattrs {
+		duplicate[key] = value
+	}
+	return duplicate
 }
 
-func getHashFromReader(reader io.Reader) uint64 {
-	h := xxhash.New()
+// Compare determines the DiffType between two FileInfos based on the type and contents of each given FileInfo, as well
+// as the attributes selected by the GlobalComparePolicy.
+func (data *FileInfo) Compare(other FileInfo) DiffType {
+	return data.CompareWithPolicy(other, GlobalComparePolicy)
+}
 
-	buf := make([]byte, 1024)
-	for {
-		n, err := reader.Read(buf)
-		if err != nil && err != io.EOF {
-			logrus.Panic(err)
-		}
-		if n == 0 {
-			break
+// CompareWithPolicy determines the DiffType between two FileInfos based on the type and contents of each given
+// FileInfo, as well as the attributes selected by the given policy.
+func (data *FileInfo) CompareWithPolicy(other FileInfo, policy ComparePolicy) DiffType {
+	if data.TypeFlag != other.TypeFlag ||
+		data.hash != other.hash ||
+		data.Mode != other.Mode ||
+		data.Uid != other.Uid ||
+		data.Gid != other.Gid {
+		return Modified
+	}
+	if policy&CompareXattrs != 0 && !equalXattrs(data.Xattrs, other.Xattrs) {
+		return Modified
+	}
+	if policy&CompareModTime != 0 && !data.ModTime.Equal(other.ModTime) {
+		return Modified
+	}
+	if policy&CompareDevice != 0 && (data.Devmajor != other.Devmajor || data.Devminor != other.Devminor) {
+		return Modified
+	}
+	if policy&CompareOwnerNames != 0 && (data.Uname != other.Uname || data.Gname != other.Gname) {
+		return Modified
+	}
+	return Unmodified
+}
+
+func equalXattrs(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
 		}
+	}
+	return true
+}
 
-		_, err = h.Write(buf[:n])
-		if err != nil {
-			logrus.Panic(err)
+// hashContents hashes the contents read from the reader (for comparison), along with computing the digest of the
+// given algorithm (if any).
+func hashContents(reader io.Reader, algorithm DigestAlgorithm) (uint64, string, error) {
+	h := xxhash.New()
+	if algorithm != DigestSHA256 {
+		if _, err := io.Copy(h, reader); err != nil {
+			return 0, "", err
 		}
+		return h.Sum64(), "", nil
 	}
 
-	return h.Sum64()
+	digester := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(h, digester), reader); err != nil {
+		return 0, "", err
+	}
+	return h.Sum64(), string(DigestSHA256) + ":" + hex.EncodeToString(digester.Sum(nil)), nil
 }
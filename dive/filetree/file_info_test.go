@@ -0,0 +1,233 @@
+package filetree
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/cespare/xxhash"
+)
+
+func TestNewFileInfoFromTarHeader(t *testing.T) {
+	modTime := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	headers := []*tar.Header{
+		{
+			Name: "usr/bin/ping", Typeflag: tar.TypeReg, Mode: 0755, ModTime: modTime, Uname: "root", Gname: "root",
+			PAXRecords: map[string]string{"SCHILY.xattr.security.capability": "\x01\x00\x00\x02", "comment": "not an xattr"},
+			Format:     tar.FormatPAX,
+		},
+		{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3, ModTime: modTime},
+	}
+	for _, header := range headers {
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatalf("unable to write archive: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unable to write archive: %v", err)
+	}
+
+	reader := tar.NewReader(&buf)
+	var infos []FileInfo
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to read archive: %v", err)
+		}
+		info, err := NewFileInfoFromTarHeader(reader, header, "/"+header.Name)
+		if err != nil {
+			t.Fatalf("unable to read file info: %v", err)
+		}
+		infos = append(infos, info)
+	}
+
+	ping := infos[0]
+	if len(ping.Xattrs) != 1 || ping.Xattrs["security.capability"] != "\x01\x00\x00\x02" {
+		t.Errorf("expected only the capability xattr, got %q", ping.Xattrs)
+	}
+	if !ping.ModTime.Equal(modTime) || ping.Uname != "root" || ping.Gname != "root" {
+		t.Errorf("unexpected attributes: %+v", ping)
+	}
+
+	null := infos[1]
+	if null.Devmajor != 1 || null.Devminor != 3 || null.Xattrs != nil {
+		t.Errorf("unexpected device attributes: %+v", null)
+	}
+
+	// copies do not share xattrs
+	duplicate := ping.Copy()
+	duplicate.Xattrs["security.capability"] = ""
+	if ping.Xattrs["security.capability"] == "" {
+		t.Errorf("expected a copy of the xattrs")
+	}
+}
+
+func TestCompareWithPolicy(t *testing.T) {
+	base := FileInfo{
+		TypeFlag: tar.TypeReg,
+		hash:     123,
+		Mode:     0755,
+		ModTime:  time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+		Xattrs:   map[string]string{"user.origin": "build"},
+		Uname:    "root",
+	}
+
+	table := map[string]struct {
+		change   func(info *FileInfo)
+		policy   ComparePolicy
+		expected DiffType
+	}{
+		"unchanged": {change: func(info *FileInfo) {}, policy: CompareXattrs | CompareModTime | CompareDevice | CompareOwnerNames, expected: Unmodified},
+		"contents":  {change: func(info *FileInfo) { info.hash = 321 }, policy: 0, expected: Modified},
+		"capability": {change: func(info *FileInfo) {
+			info.Xattrs = map[string]string{"user.origin": "build", "security.capability": "\x01"}
+		}, policy: DefaultComparePolicy, expected: Modified},
+		"capability-ignored":       {change: func(info *FileInfo) { info.Xattrs = nil }, policy: CompareModTime, expected: Unmodified},
+		"xattr-value":              {change: func(info *FileInfo) { info.Xattrs = map[string]string{"user.origin": "other"} }, policy: CompareXattrs, expected: Modified},
+		"mtime":                    {change: func(info *FileInfo) { info.ModTime = info.ModTime.Add(time.Hour) }, policy: CompareModTime, expected: Modified},
+		"mtime-ignored-by-default": {change: func(info *FileInfo) { info.ModTime = info.ModTime.Add(time.Hour) }, policy: DefaultComparePolicy, expected: Unmodified},
+		"device":                   {change: func(info *FileInfo) { info.Devminor = 5 }, policy: DefaultComparePolicy, expected: Modified},
+		"owner-name":               {change: func(info *FileInfo) { info.Uname = "admin" }, policy: CompareOwnerNames, expected: Modified},
+		"owner-name-ignored":       {change: func(info *FileInfo) { info.Uname = "admin" }, policy: DefaultComparePolicy, expected: Unmodified},
+	}
+
+	for name, test := range table {
+		other := *base.Copy()
+		test.change(&other)
+		if actual := base.CompareWithPolicy(other, test.policy); actual != test.expected {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, actual)
+		}
+	}
+}
+
+func TestParseComparePolicy(t *testing.T) {
+	policy, err := ParseComparePolicy([]string{"xattrs", " MTime "})
+	if err != nil {
+		t.Fatalf("unable to parse policy: %v", err)
+	}
+	if policy != CompareXattrs|CompareModTime {
+		t.Errorf("unexpected policy: %b", policy)
+	}
+
+	if policy, err := ParseComparePolicy(nil); err != nil || policy != 0 {
+		t.Errorf("expected an empty policy, got %b (%v)", policy, err)
+	}
+	if _, err := ParseComparePolicy([]string{"inode"}); err == nil {
+		t.Errorf("expected an error for an unknown attribute")
+	}
+}
+
+func TestNewFileInfoFromTarHeaderWithDigest(t *testing.T) {
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	entries := []struct {
+		header  *tar.Header
+		content string
+	}{
+		{header: &tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: &tar.Header{Name: "etc/hostname", Typeflag: tar.TypeReg, Mode: 0644, Size: 5}, content: "dive\n"},
+		{header: &tar.Header{Name: "etc/motd", Typeflag: tar.TypeSymlink, Linkname: "/dev/null"}},
+	}
+	for _, entry := range entries {
+		if err := writer.WriteHeader(entry.header); err != nil {
+			t.Fatalf("unable to write archive: %v", err)
+		}
+		if _, err := writer.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("unable to write archive: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unable to write archive: %v", err)
+	}
+	archive := buf.Bytes()
+
+	read := func(algorithm DigestAlgorithm) map[string]FileInfo {
+		reader := tar.NewReader(bytes.NewReader(archive))
+		infos := make(map[string]FileInfo)
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unable to read archive: %v", err)
+			}
+			info, err := NewFileInfoFromTarHeaderWithDigest(reader, header, "/"+header.Name, algorithm)
+			if err != nil {
+				t.Fatalf("unable to read file info: %v", err)
+			}
+			infos[info.Path] = info
+		}
+		return infos
+	}
+
+	withDigests := read(DigestSHA256)
+	expected := "sha256:2b25a828e41ea177224ae2dee24977e93f8f4953964a38e5dbf11742c5a0ef8f"
+	if digest := withDigests["/etc/hostname"].Digest; digest != expected {
+		t.Errorf("expected digest %q, got %q", expected, digest)
+	}
+	for _, path := range []string{"/etc/", "/etc/motd"} {
+		if digest := withDigests[path].Digest; digest != "" {
+			t.Errorf("expected no digest for %s, got %q", path, digest)
+		}
+	}
+
+	withoutDigests := read(NoDigest)
+	if digest := withoutDigests["/etc/hostname"].Digest; digest != "" {
+		t.Errorf("expected no digest when not requested, got %q", digest)
+	}
+	if withoutDigests["/etc/hostname"].hash != withDigests["/etc/hostname"].hash {
+		t.Errorf("expected the content hash to be independent of the digest")
+	}
+}
+
+func TestHashContents_NoDigestAllocations(t *testing.T) {
+	content := []byte("dive\n")
+	hashOnly := testing.AllocsPerRun(100, func() {
+		if _, err := io.Copy(xxhash.New(), bytes.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	withoutDigests := testing.AllocsPerRun(100, func() {
+		if _, _, err := hashContents(bytes.NewReader(content), NoDigest); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// the sha256 digester is only created when digests are requested
+	if withoutDigests > hashOnly {
+		t.Errorf("expected no allocations beyond the content hash, got %v (content hash alone %v)", withoutDigests, hashOnly)
+	}
+}
+
+func TestParseDigestAlgorithm(t *testing.T) {
+	for name, expected := range map[string]DigestAlgorithm{"": NoDigest, "none": NoDigest, " SHA256 ": DigestSHA256} {
+		algorithm, err := ParseDigestAlgorithm(name)
+		if err != nil || algorithm != expected {
+			t.Errorf("%q: expected %q, got %q (%v)", name, expected, algorithm, err)
+		}
+	}
+	if _, err := ParseDigestAlgorithm("md5"); err == nil {
+		t.Errorf("expected an error for an unsupported algorithm")
+	}
+}
+
+func TestInternOwnerName(t *testing.T) {
+	first := internOwnerName(strings.Clone("nginx"))
+	second := internOwnerName(strings.Clone("nginx"))
+	if first != "nginx" || unsafe.StringData(first) != unsafe.StringData(second) {
+		t.Errorf("expected the same instance of equal names")
+	}
+	if internOwnerName("") != "" {
+		t.Errorf("expected an empty name")
+	}
+}
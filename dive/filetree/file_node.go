@@ -3,16 +3,19 @@ package filetree
 import (
 	"archive/tar"
 	"fmt"
+	"maps"
 	"strings"
+	"sync/atomic"
 
 	"github.com/dustin/go-humanize"
 	"github.com/fatih/color"
 	"github.com/phayes/permbits"
-	"github.com/sirupsen/logrus"
 )
 
 const (
-	AttributeFormat = "%s%s %11s %10s "
+	AttributeFormat = "%s%s%1s %11s %10s %16s "
+	// the width of the owner column of AttributeFormat (longer owners are truncated)
+	ownerWidth = 11
 )
 
 var diffTypeColor = map[DiffType]*color.Color{
@@ -22,36 +25,76 @@ var diffTypeColor = map[DiffType]*color.Color{
 	Unmodified: color.New(color.Reset),
 }
 
-// FileNode represents a single file, its relation to files beneath it, the tree it exists in, and the metadata of the given file.
+// FileNode represents a single file, its relation to files beneath it, the tree it exists in, and the metadata of the
+// given file.
+//
+// Nodes are shared between a tree and its copies until either tree alters them (see FileTree.Copy), so the view and
+// comparison state of a node is held by each tree (see FileTree.ViewInfo and FileTree.DiffType). The node methods use
+// the state held by the Tree of the node, which for a shared node is the tree the node was created (or last altered)
+// in; use the FileTree methods for the state of the node within any other tree. Nodes must only be altered through
+// the node and tree methods (never through Data or Children directly), so that a shared node is copied first.
 type FileNode struct {
-	Tree     *FileTree
-	Parent   *FileNode
-	Size     int64 // memoized total size of file or directory
-	Name     string
-	Data     NodeData
+	// Tree is the tree the node was created (or last altered) in
+	Tree *FileTree
+	// Parent is the parent node within Tree. A node is only ever shared at the same path, so for a shared node Parent
+	// has the same Name and (node) identity as the parent of the node within every tree sharing it, but it may be the
+	// version of the parent held by another tree (with other children). The parent of a node within a given tree is
+	// found with FileTree.GetNode.
+	Parent *FileNode
+	// Deprecated: the size of a node depends on the tree it is within, use GetSize (or FileTree.NodeSize). Size is
+	// always -1.
+	Size int64
+	Name string
+	Data NodeData
+	// Children is nil until the first child is added (most nodes of large trees are files, which have no children)
 	Children map[string]*FileNode
 	path     string
+	// id identifies the node (in the way an inode does) in every tree it is shared with, including the copies of the
+	// node made when it is altered in one of the trees
+	id uint64
+	// edit is the edit token of the tree that may alter the node in place (see FileTree.own)
+	edit uint64
 }
 
+// nodeIDs and editTokens hand out the node ids and tree edit tokens, which are never reused
+var nodeIDs, editTokens atomic.Uint64
+
 // NewNode creates a new FileNode relative to the given parent node with a payload.
 func NewNode(parent *FileNode, name string, data FileInfo) (node *FileNode) {
-	node = new(FileNode)
-	node.Name = name
-	node.Data = *NewNodeData()
-	node.Data.FileInfo = *data.Copy()
-	node.Size = -1 // signal lazy load later
-
-	node.Children = make(map[string]*FileNode)
-	node.Parent = parent
+	node = &FileNode{
+		Name:   name,
+		Parent: parent,
+		Size:   -1,
+		Data: NodeData{
+			FileInfo: data,
+		},
+		id: nodeIDs.Add(1),
+	}
+	// the payload is copied in place (rather than with FileInfo.Copy) to avoid allocating a copy for every node
+	node.Data.FileInfo.Xattrs = copyXattrs(data.Xattrs)
 	if parent != nil {
 		node.Tree = parent.Tree
+		node.edit = parent.edit
 	}
 
 	return node
 }
 
+// clone copies the node (keeping its id and sharing its children) under the given parent, which must be the version
+// of the parent of the node within the given tree, to be altered in place by the tree.
+func (node *FileNode) clone(parent *FileNode, tree *FileTree) *FileNode {
+	newNode := *node
+	newNode.Parent = parent
+	newNode.Tree = tree
+	newNode.edit = tree.edit.Load()
+	if node.Children != nil {
+		newNode.Children = maps.Clone(node.Children)
+	}
+	return &newNode
+}
+
 // renderTreeLine returns a string representing this FileNode in the context of a greater ASCII tree.
-func (node *FileNode) renderTreeLine(spaces []bool, last bool, collapsed bool) string {
+func (node *FileNode) renderTreeLine(diffType DiffType, spaces []bool, last bool, collapsed bool) string {
 	var otherBranches string
 	for _, space := range spaces {
 		if space {
@@ -71,117 +114,132 @@ func (node *FileNode) renderTreeLine(spaces []bool, last bool, collapsed bool) s
 		collapsedIndicator = collapsedItem
 	}
 
-	return otherBranches + thisBranch + collapsedIndicator + node.String() + newLine
+	return otherBranches + thisBranch + collapsedIndicator + node.display(diffType) + newLine
 }
 
-// Copy duplicates the existing node relative to a new parent node.
-func (node *FileNode) Copy(parent *FileNode) *FileNode {
-	newNode := NewNode(parent, node.Name, node.Data.FileInfo)
-	newNode.Data.ViewInfo = node.Data.ViewInfo
-	newNode.Data.DiffType = node.Data.DiffType
-	for name, child := range node.Children {
-		newNode.Children[name] = child.Copy(newNode)
-		child.Parent = newNode
+// String shows the filename formatted into the proper color (by DiffType), additionally indicating if it is a link
+// (or the target of hard links).
+func (node *FileNode) String() string {
+	if node == nil {
+		return ""
 	}
-	return newNode
+	diffType := Unmodified
+	if node.Tree != nil {
+		diffType = node.Tree.DiffType(node)
+	}
+	return node.display(diffType)
 }
 
-// AddChild creates a new node relative to the current FileNode.
-func (node *FileNode) AddChild(name string, data FileInfo) (child *FileNode) {
-	// never allow processing of purely whiteout flag files (for now)
-	if strings.HasPrefix(name, doubleWhiteoutPrefix) {
-		return nil
+// display shows the filename formatted into the color of the given DiffType, additionally indicating if it is a link
+// (or the target of hard links).
+func (node *FileNode) display(diffType DiffType) string {
+	var display string
+
+	display = node.Name
+	switch {
+	case node.Data.FileInfo.TypeFlag == tar.TypeSymlink:
+		display += " → " + node.Data.FileInfo.Linkname
+	case node.Data.FileInfo.TypeFlag == tar.TypeLink:
+		display += " → " + node.Data.FileInfo.Linkname + " (hard link)"
+	case node.Data.FileInfo.HardLinks == 1:
+		display += " (1 hard link)"
+	case node.Data.FileInfo.HardLinks > 1:
+		display += fmt.Sprintf(" (%d hard links)", node.Data.FileInfo.HardLinks)
 	}
+	return diffTypeColor[diffType].Sprint(display)
+}
 
-	child = NewNode(node, name, data)
-	if node.Children[name] != nil {
-		// tree node already exists, replace the payload, keep the children
-		node.Children[name].Data.FileInfo = *data.Copy()
-	} else {
-		node.Children[name] = child
-		node.Tree.Size++
+// MetadataString returns the FileNode metadata (within its Tree) in a columnar string.
+func (node *FileNode) MetadataString() string {
+	if node == nil {
+		return ""
 	}
+	return node.Tree.MetadataString(node)
+}
 
-	return child
+// GetSize returns the total size of the node within its Tree (see FileTree.NodeSize).
+func (node *FileNode) GetSize() int64 {
+	return node.Tree.NodeSize(node)
 }
 
-// Remove deletes the current FileNode from it's parent FileNode's relations.
-func (node *FileNode) Remove() error {
-	if node == node.Tree.Root {
-		return fmt.Errorf("cannot remove the tree root")
+// AssignDiffType will assign the given DiffType to this node within its Tree, possibly affecting child nodes (see
+// FileTree.AssignDiffType).
+func (node *FileNode) AssignDiffType(diffType DiffType) error {
+	return node.Tree.AssignDiffType(node, diffType)
+}
+
+// Copy duplicates the existing node (and the nodes beneath it) relative to a new parent node, along with the view and
+// comparison state of the nodes (from the Tree of the node to the Tree of the parent).
+func (node *FileNode) Copy(parent *FileNode) *FileNode {
+	newNode := NewNode(parent, node.Name, node.Data.FileInfo)
+	if node.Tree != nil && newNode.Tree != nil {
+		newNode.Tree.SetViewInfo(newNode, node.Tree.ViewInfo(node))
+		newNode.Tree.setDiffType(newNode, node.Tree.DiffType(node))
 	}
-	for _, child := range node.Children {
-		err := child.Remove()
-		if err != nil {
-			return err
-		}
+	if len(node.Children) > 0 {
+		newNode.Children = make(map[string]*FileNode, len(node.Children))
 	}
-	delete(node.Parent.Children, node.Name)
-	node.Tree.Size--
-	return nil
+	for name, child := range node.Children {
+		newNode.Children[name] = child.Copy(newNode)
+	}
+	return newNode
 }
 
-// String shows the filename formatted into the proper color (by DiffType), additionally indicating if it is a symlink.
-func (node *FileNode) String() string {
-	var display string
-	if node == nil {
-		return ""
-	}
+// AddChild creates a new node relative to the current FileNode (see FileTree.AddChild).
+func (node *FileNode) AddChild(name string, data FileInfo) (child *FileNode) {
+	return node.Tree.AddChild(node, name, data)
+}
 
-	display = node.Name
-	if node.Data.FileInfo.TypeFlag == tar.TypeSymlink || node.Data.FileInfo.TypeFlag == tar.TypeLink {
-		display += " → " + node.Data.FileInfo.Linkname
-	}
-	return diffTypeColor[node.Data.DiffType].Sprint(display)
+// Remove deletes the current FileNode from its Tree (see FileTree.RemoveNode).
+func (node *FileNode) Remove() error {
+	return node.Tree.RemoveNode(node)
 }
 
-// MetadatString returns the FileNode metadata in a columnar string.
-func (node *FileNode) MetadataString() string {
+// MetadataString returns the metadata of the given node of the tree in a columnar string.
+func (tree *FileTree) MetadataString(node *FileNode) string {
 	if node == nil {
 		return ""
 	}
 
-	fileMode := permbits.FileMode(node.Data.FileInfo.Mode).String()
+	info := node.Data.FileInfo
+	fileMode := permbits.FileMode(info.Mode).String()
 	dir := "-"
-	if node.Data.FileInfo.IsDir {
+	if info.IsDir {
 		dir = "d"
 	}
-	user := node.Data.FileInfo.Uid
-	group := node.Data.FileInfo.Gid
-	userGroup := fmt.Sprintf("%d:%d", user, group)
-
-	// don't include file sizes of children that have been removed (unless the node in question is a removed dir,
-	// then show the accumulated size of removed files)
-	sizeBytes := node.GetSize()
-
-	size := humanize.Bytes(uint64(sizeBytes))
-
-	return diffTypeColor[node.Data.DiffType].Sprint(fmt.Sprintf(AttributeFormat, dir, fileMode, userGroup, size))
-}
-
-func (node *FileNode) GetSize() int64 {
-	if 0 <= node.Size {
-		return node.Size
+	// files with extended attributes (e.g. capabilities) are marked as "ls" does
+	xattrs := ""
+	if len(info.Xattrs) > 0 {
+		xattrs = "@"
+	}
+	user, group := info.Uname, info.Gname
+	if user == "" {
+		user = fmt.Sprint(info.Uid)
+	}
+	if group == "" {
+		group = fmt.Sprint(info.Gid)
+	}
+	userGroup := user + ":" + group
+	if owner := []rune(userGroup); len(owner) > ownerWidth {
+		userGroup = string(owner[:ownerWidth-1]) + "…"
 	}
-	var sizeBytes int64
 
-	if node.IsLeaf() {
-		sizeBytes = node.Data.FileInfo.Size
+	var size string
+	if info.TypeFlag == tar.TypeChar || info.TypeFlag == tar.TypeBlock {
+		// devices have no size, show the device numbers instead
+		size = fmt.Sprintf("%d, %d", info.Devmajor, info.Devminor)
 	} else {
-		sizer := func(curNode *FileNode) error {
+		// don't include file sizes of children that have been removed (unless the node in question is a removed dir,
+		// then show the accumulated size of removed files)
+		size = humanize.Bytes(uint64(tree.NodeSize(node)))
+	}
 
-			if curNode.Data.DiffType != Removed || node.Data.DiffType == Removed {
-				sizeBytes += curNode.Data.FileInfo.Size
-			}
-			return nil
-		}
-		err := node.VisitDepthChildFirst(sizer, nil, nil)
-		if err != nil {
-			logrus.Errorf("unable to propagate node for metadata: %+v", err)
-		}
+	modified := "-"
+	if !info.ModTime.IsZero() {
+		modified = info.ModTime.UTC().Format("2006-01-02 15:04")
 	}
-	node.Size = sizeBytes
-	return node.Size
+
+	return diffTypeColor[tree.DiffType(node)].Sprint(fmt.Sprintf(AttributeFormat, dir, fileMode, xattrs, userGroup, size, modified))
 }
 
 // VisitDepthChildFirst iterates a tree depth-first (starting at this FileNode), evaluating the deepest depths first (visit on bubble up)
@@ -198,7 +256,7 @@ func (node *FileNode) VisitDepthChildFirst(visitor Visitor, evaluator VisitEvalu
 		}
 	}
 	// never visit the root node
-	if node == node.Tree.Root {
+	if node.Parent == nil {
 		return nil
 	} else if evaluator != nil && evaluator(node) || evaluator == nil {
 		return visitor(node)
@@ -218,7 +276,7 @@ func (node *FileNode) VisitDepthParentFirst(visitor Visitor, evaluator VisitEval
 	}
 
 	// never visit the root node
-	if node != node.Tree.Root {
+	if node.Parent != nil {
 		err = visitor(node)
 		if err != nil {
 			return err
@@ -273,40 +331,6 @@ func (node *FileNode) Path() string {
 	return strings.Replace(node.path, "//", "/", -1)
 }
 
-// deriveDiffType determines a DiffType to the current FileNode. Note: the DiffType of a node is always the DiffType of
-// its attributes and its contents. The contents are the bytes of the file of the children of a directory.
-func (node *FileNode) deriveDiffType(diffType DiffType) error {
-	if node.IsLeaf() {
-		return node.AssignDiffType(diffType)
-	}
-
-	myDiffType := diffType
-	for _, v := range node.Children {
-		myDiffType = myDiffType.merge(v.Data.DiffType)
-	}
-
-	return node.AssignDiffType(myDiffType)
-}
-
-// AssignDiffType will assign the given DiffType to this node, possibly affecting child nodes.
-func (node *FileNode) AssignDiffType(diffType DiffType) error {
-	var err error
-
-	node.Data.DiffType = diffType
-
-	if diffType == Removed {
-		// if we've removed this node, then all children have been removed as well
-		for _, child := range node.Children {
-			err = child.AssignDiffType(diffType)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
 // compare the current node against the given node, returning a definitive DiffType.
 func (node *FileNode) compare(other *FileNode) DiffType {
 	if node == nil && other == nil {
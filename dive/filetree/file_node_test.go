@@ -1,7 +1,9 @@
 package filetree
 
 import (
+	"archive/tar"
 	"testing"
+	"time"
 )
 
 func TestAddChild(t *testing.T) {
@@ -46,6 +48,58 @@ func TestAddChild(t *testing.T) {
 
 }
 
+func TestAddChild_LeafChildren(t *testing.T) {
+	tree := NewFileTree()
+	dir := tree.Root.AddChild("etc", FileInfo{})
+	file := dir.AddChild("motd", FileInfo{Path: "/etc/motd"})
+
+	// files do not hold on to an (empty) map of children
+	if file.Children != nil {
+		t.Errorf("expected a file without children to have no children map")
+	}
+	copied := tree.Copy()
+	if copied.Root.Children["etc"].Children["motd"].Children != nil {
+		t.Errorf("expected a copied file to have no children map")
+	}
+
+	// ...but may still be given children (e.g. a file replaced by a directory in an upper layer)
+	child := file.AddChild("nested", FileInfo{})
+	if file, _ = tree.GetNode("/etc/motd"); file.Children["nested"] != child {
+		t.Errorf("expected the child to be added")
+	}
+	if copied.Root.Children["etc"].Children["motd"].Children != nil {
+		t.Errorf("expected the child not to be added to the copied tree")
+	}
+	if err := file.Children["nested"].Remove(); err != nil {
+		t.Errorf("unable to remove child: %v", err)
+	}
+	if len(file.Children) != 0 || tree.Size != 2 {
+		t.Errorf("expected the child to be removed, got %d children (tree size %d)", len(file.Children), tree.Size)
+	}
+}
+
+func TestCopyNode(t *testing.T) {
+	tree := NewFileTree()
+	dir, _, err := tree.AddPath("/etc/nginx", FileInfo{IsDir: true})
+	checkError(t, err, "unable to setup test")
+	_, _, err = tree.AddPath("/etc/nginx/nginx.conf", FileInfo{Size: 100})
+	checkError(t, err, "unable to setup test")
+	checkError(t, dir.AssignDiffType(Removed), "unable to setup test")
+	tree.SetViewInfo(dir, ViewInfo{Collapsed: true})
+
+	other := NewFileTree()
+	copied := dir.Copy(other.Root)
+	if copied.Tree != other || copied.Children["nginx.conf"].Parent != copied {
+		t.Errorf("expected the copy to be relative to the new parent")
+	}
+	if other.DiffType(copied.Children["nginx.conf"]) != Removed || !other.ViewInfo(copied).Collapsed {
+		t.Errorf("expected the copy to take the state of the nodes")
+	}
+	if copied.GetSize() != 100 {
+		t.Errorf("expected the copied directory to be 100 bytes, got %d", copied.GetSize())
+	}
+}
+
 func TestRemoveChild(t *testing.T) {
 	var expected, actual int
 
@@ -107,27 +161,27 @@ func TestIsWhiteout(t *testing.T) {
 		t.Errorf("Expected path '%s' to be a whiteout file", p2.Name)
 	}
 
-	if p3 != nil {
-		t.Errorf("Expected to not be able to add path '%s'", p2.Name)
+	if p3 == nil || p3.IsWhiteout() || p3.Name != "public3" {
+		t.Errorf("Expected the opaque whiteout to mark its directory, got %v", p3)
 	}
 }
 
 func TestDiffTypeFromAddedChildren(t *testing.T) {
 	tree := NewFileTree()
 	node, _, _ := tree.AddPath("/usr", *BlankFileChangeInfo("/usr"))
-	node.Data.DiffType = Unmodified
+	checkError(t, node.AssignDiffType(Unmodified), "unable to setup test")
 
 	node, _, _ = tree.AddPath("/usr/bin", *BlankFileChangeInfo("/usr/bin"))
-	node.Data.DiffType = Added
+	checkError(t, node.AssignDiffType(Added), "unable to setup test")
 
 	node, _, _ = tree.AddPath("/usr/bin2", *BlankFileChangeInfo("/usr/bin2"))
-	node.Data.DiffType = Removed
+	checkError(t, node.AssignDiffType(Removed), "unable to setup test")
 
-	err := tree.Root.Children["usr"].deriveDiffType(Unmodified)
+	err := tree.deriveDiffType(tree.Root.Children["usr"], Unmodified)
 	checkError(t, err, "unable to setup test")
 
-	if tree.Root.Children["usr"].Data.DiffType != Modified {
-		t.Errorf("Expected Modified but got %v", tree.Root.Children["usr"].Data.DiffType)
+	if tree.DiffType(tree.Root.Children["usr"]) != Modified {
+		t.Errorf("Expected Modified but got %v", tree.DiffType(tree.Root.Children["usr"]))
 	}
 }
 func TestDiffTypeFromRemovedChildren(t *testing.T) {
@@ -136,17 +190,17 @@ func TestDiffTypeFromRemovedChildren(t *testing.T) {
 
 	info1 := BlankFileChangeInfo("/usr/.wh.bin")
 	node, _, _ := tree.AddPath("/usr/.wh.bin", *info1)
-	node.Data.DiffType = Removed
+	checkError(t, node.AssignDiffType(Removed), "unable to setup test")
 
 	info2 := BlankFileChangeInfo("/usr/.wh.bin2")
 	node, _, _ = tree.AddPath("/usr/.wh.bin2", *info2)
-	node.Data.DiffType = Removed
+	checkError(t, node.AssignDiffType(Removed), "unable to setup test")
 
-	err := tree.Root.Children["usr"].deriveDiffType(Unmodified)
+	err := tree.deriveDiffType(tree.Root.Children["usr"], Unmodified)
 	checkError(t, err, "unable to setup test")
 
-	if tree.Root.Children["usr"].Data.DiffType != Modified {
-		t.Errorf("Expected Modified but got %v", tree.Root.Children["usr"].Data.DiffType)
+	if tree.DiffType(tree.Root.Children["usr"]) != Modified {
+		t.Errorf("Expected Modified but got %v", tree.DiffType(tree.Root.Children["usr"]))
 	}
 
 }
@@ -161,8 +215,43 @@ func TestDirSize(t *testing.T) {
 	checkError(t, err, "unable to setup test")
 
 	node, _ := tree1.GetNode("/etc/nginx")
-	expected, actual := "----------         0:0      600 B ", node.MetadataString()
+	expected, actual := "----------          0:0      600 B                - ", node.MetadataString()
 	if expected != actual {
 		t.Errorf("Expected metadata '%s' got '%s'", expected, actual)
 	}
 }
+
+func TestMetadataString(t *testing.T) {
+	modTime := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	table := map[string]struct {
+		info     FileInfo
+		expected string
+	}{
+		"capabilities": {
+			info:     FileInfo{TypeFlag: tar.TypeReg, Mode: 0755, Size: 1000, ModTime: modTime, Xattrs: map[string]string{"security.capability": "\x01"}},
+			expected: "-rwxr-xr-x@         0:0     1.0 kB 2019-01-02 03:04 ",
+		},
+		"owner-names": {
+			info:     FileInfo{TypeFlag: tar.TypeReg, Mode: 0644, Uid: 101, Gid: 101, Uname: "nginx", ModTime: modTime},
+			expected: "-rw-r--r--    nginx:101        0 B 2019-01-02 03:04 ",
+		},
+		"long-owner-names": {
+			info:     FileInfo{TypeFlag: tar.TypeReg, Mode: 0644, Uid: 33, Gid: 33, Uname: "www-data", Gname: "www-data", ModTime: modTime},
+			expected: "-rw-r--r--  www-data:w…        0 B 2019-01-02 03:04 ",
+		},
+		"device": {
+			info:     FileInfo{TypeFlag: tar.TypeChar, Mode: 0666, Uname: "root", Gname: "root", Devmajor: 1, Devminor: 3},
+			expected: "-rw-rw-rw-    root:root       1, 3                - ",
+		},
+	}
+
+	for name, test := range table {
+		tree := NewFileTree()
+		node, _, err := tree.AddPath("/file", test.info)
+		checkError(t, err, "unable to setup test")
+
+		if actual := node.MetadataString(); actual != test.expected {
+			t.Errorf("%s: expected metadata '%s' got '%s'", name, test.expected, actual)
+		}
+	}
+}
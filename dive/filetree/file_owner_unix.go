@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package filetree
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the UID and GID of the given file
+func fileOwner(info os.FileInfo) (int, int) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(stat.Uid), int(stat.Gid)
+	}
+	return -1, -1
+}
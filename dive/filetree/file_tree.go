@@ -1,9 +1,12 @@
 package filetree
 
 import (
+	"archive/tar"
 	"fmt"
+	"maps"
 	"path"
 	"strings"
+	"sync/atomic"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -17,6 +20,7 @@ const (
 	lastItem             = "└─"
 	whiteoutPrefix       = ".wh."
 	doubleWhiteoutPrefix = ".wh..wh.."
+	opaqueWhiteout       = ".wh..wh..opq"
 	uncollapsedItem      = "─ "
 	collapsedItem        = "⊕ "
 )
@@ -29,14 +33,23 @@ type FileTree struct {
 	Name      string
 	Id        uuid.UUID
 	SortOrder SortOrder
+	// edit is the token of the nodes the tree may alter in place, the remaining nodes are shared with other trees
+	edit atomic.Uint64
+	// the view and comparison state of the nodes, by node id (see tree_state.go)
+	views     map[uint64]ViewInfo
+	diffTypes map[uint64]DiffType
+	// sizes memoizes the size of directories (see NodeSize) until the tree is altered
+	sizes map[uint64]int64
 }
 
 // NewFileTree creates an empty FileTree
 func NewFileTree() (tree *FileTree) {
 	tree = new(FileTree)
 	tree.Size = 0
-	tree.Root = new(FileNode)
+	tree.edit.Store(editTokens.Add(1))
+	tree.Root = NewNode(nil, "", FileInfo{})
 	tree.Root.Tree = tree
+	tree.Root.edit = tree.edit.Load()
 	tree.Root.Children = make(map[string]*FileNode)
 	tree.Id = uuid.New()
 	tree.SortOrder = ByName
@@ -68,26 +81,27 @@ func (tree *FileTree) renderStringTreeBetween(startRow, stopRow int, showAttribu
 		currentParams, paramsToVisit = paramsToVisit[0], paramsToVisit[1:]
 
 		// take note of the next nodes to visit later
-		sorter := GetSortOrderStrategy(tree.SortOrder)
+		sorter := tree.sortOrderStrategy()
 		keys := sorter.orderKeys(currentParams.node.Children)
 
 		var childParams = make([]renderParams, 0)
 		for idx, name := range keys {
 			child := currentParams.node.Children[name]
+			childView := tree.ViewInfo(child)
 			// don't visit this node...
-			if child.Data.ViewInfo.Hidden || currentParams.node.Data.ViewInfo.Collapsed {
+			if childView.Hidden || tree.ViewInfo(currentParams.node).Collapsed {
 				continue
 			}
 
 			// visit this node...
 			isLast := idx == (len(currentParams.node.Children) - 1)
-			showCollapsed := child.Data.ViewInfo.Collapsed && len(child.Children) > 0
+			showCollapsed := childView.Collapsed && len(child.Children) > 0
 
 			// completely copy the reference slice
 			childSpaces := make([]bool, len(currentParams.childSpaces))
 			copy(childSpaces, currentParams.childSpaces)
 
-			if len(child.Children) > 0 && !child.Data.ViewInfo.Collapsed {
+			if len(child.Children) > 0 && !childView.Collapsed {
 				childSpaces = append(childSpaces, isLast)
 			}
 
@@ -119,9 +133,9 @@ func (tree *FileTree) renderStringTreeBetween(startRow, stopRow int, showAttribu
 		currentParams := params[idx]
 
 		if showAttributes {
-			result += currentParams.node.MetadataString() + " "
+			result += tree.MetadataString(currentParams.node) + " "
 		}
-		result += currentParams.node.renderTreeLine(currentParams.spaces, currentParams.isLast, currentParams.showCollapsed)
+		result += currentParams.node.renderTreeLine(tree.DiffType(currentParams.node), currentParams.spaces, currentParams.isLast, currentParams.showCollapsed)
 	}
 
 	return result
@@ -135,14 +149,15 @@ func (tree *FileTree) VisibleSize() int {
 		return nil
 	}
 	visitEvaluator := func(node *FileNode) bool {
+		view := tree.ViewInfo(node)
 		if node.Data.FileInfo.IsDir {
 			// we won't visit a collapsed dir, but we need to count it
-			if node.Data.ViewInfo.Collapsed {
+			if view.Collapsed {
 				size++
 			}
-			return !node.Data.ViewInfo.Collapsed && !node.Data.ViewInfo.Hidden
+			return !view.Collapsed && !view.Hidden
 		}
-		return !node.Data.ViewInfo.Hidden
+		return !view.Hidden
 	}
 	err := tree.VisitDepthParentFirst(visitor, visitEvaluator)
 	if err != nil {
@@ -165,25 +180,58 @@ func (tree *FileTree) StringBetween(start, stop int, showAttributes bool) string
 	return tree.renderStringTreeBetween(start, stop, showAttributes)
 }
 
-// Copy returns a copy of the given FileTree
+// Copy returns a copy of the given FileTree. The copy shares the nodes of the tree, a node is only copied (along with
+// the nodes above it) when either tree alters it, so copying a tree takes neither the time nor the memory of copying
+// its nodes.
 func (tree *FileTree) Copy() *FileTree {
 	newTree := NewFileTree()
 	newTree.Size = tree.Size
 	newTree.FileSize = tree.FileSize
-	newTree.Root = tree.Root.Copy(newTree.Root)
+	newTree.Root = tree.Root
 	newTree.SortOrder = tree.SortOrder
+	newTree.views = maps.Clone(tree.views)
+	newTree.diffTypes = maps.Clone(tree.diffTypes)
 
-	// update the tree pointers
-	err := newTree.VisitDepthChildFirst(func(node *FileNode) error {
-		node.Tree = newTree
-		return nil
-	}, nil)
+	// the nodes are shared from here on, so neither tree may alter them in place
+	tree.edit.Store(editTokens.Add(1))
 
-	if err != nil {
-		logrus.Errorf("unable to propagate tree on copy(): %+v", err)
+	return newTree
+}
+
+// own returns the version of the given node that the tree may alter in place. A node shared with other trees is copied
+// into the tree first (along with the shared nodes above it), so that altering it never affects the other trees. The
+// result is nil if the node is not within the tree.
+func (tree *FileTree) own(node *FileNode) *FileNode {
+	// any alteration may change the size of the directories
+	tree.sizes = nil
+
+	edit := tree.edit.Load()
+	if node.edit == edit {
+		return node
 	}
+	if node.Parent == nil {
+		if tree.Root.edit != edit {
+			tree.Root = tree.Root.clone(nil, tree)
+		}
+		return tree.Root
+	}
+	parent := tree.own(node.Parent)
+	if parent == nil {
+		return nil
+	}
+	return tree.ownChild(parent, node.Name)
+}
 
-	return newTree
+// ownChild returns the version of the named child of the given node (which the tree may alter in place) that the tree
+// may alter in place, or nil if there is no such child.
+func (tree *FileTree) ownChild(parent *FileNode, name string) *FileNode {
+	child := parent.Children[name]
+	if child == nil || child.edit == parent.edit {
+		return child
+	}
+	child = child.clone(parent, tree)
+	parent.Children[name] = child
+	return child
 }
 
 // Visitor is a function that processes, observes, or otherwise transforms the given node
@@ -194,18 +242,31 @@ type VisitEvaluator func(*FileNode) bool
 
 // VisitDepthChildFirst iterates the given tree depth-first, evaluating the deepest depths first (visit on bubble up)
 func (tree *FileTree) VisitDepthChildFirst(visitor Visitor, evaluator VisitEvaluator) error {
-	sorter := GetSortOrderStrategy(tree.SortOrder)
+	sorter := tree.sortOrderStrategy()
 	return tree.Root.VisitDepthChildFirst(visitor, evaluator, sorter)
 }
 
 // VisitDepthParentFirst iterates the given tree depth-first, evaluating the shallowest depths first (visit while sinking down)
 func (tree *FileTree) VisitDepthParentFirst(visitor Visitor, evaluator VisitEvaluator) error {
-	sorter := GetSortOrderStrategy(tree.SortOrder)
+	sorter := tree.sortOrderStrategy()
 	return tree.Root.VisitDepthParentFirst(visitor, evaluator, sorter)
 }
 
 // Stack takes two trees and combines them together. This is done by "stacking" the given tree on top of the owning tree.
 func (tree *FileTree) Stack(upper *FileTree) (failed []PathError, stackErr error) {
+	// the contents of opaque directories replace the contents of the owning tree
+	for _, dir := range upper.opaqueDirs() {
+		lowerDir, err := tree.GetNode(dir.Path())
+		if err != nil {
+			continue
+		}
+		for _, child := range lowerDir.Children {
+			if err := tree.RemoveNode(child); err != nil {
+				failed = append(failed, NewPathError(child.Path(), ActionRemove, err))
+			}
+		}
+	}
+
 	graft := func(node *FileNode) error {
 		if node.IsWhiteout() {
 			err := tree.RemovePath(node.Path())
@@ -247,16 +308,21 @@ func (tree *FileTree) AddPath(filepath string, data FileInfo) (*FileNode, []*Fil
 		return nil, nil, fmt.Errorf("cannot add relative path '%s'", filepath)
 	}
 	nodeNames := strings.Split(strings.Trim(filepath, "/"), "/")
-	node := tree.Root
+	node := tree.own(tree.Root)
 	addedNodes := make([]*FileNode, 0)
 	for idx, name := range nodeNames {
 		if name == "" {
 			continue
 		}
-		// find or create node
+		// find or create node (the nodes along the path are altered, either by a new child or by the payload)
 		if node.Children[name] != nil {
-			node = node.Children[name]
+			node = tree.ownChild(node, name)
 		} else {
+			// an opaque whiteout is not a node of its own, it marks the directory it is within
+			if name == opaqueWhiteout && idx == len(nodeNames)-1 {
+				node.Data.FileInfo.Opaque = true
+				return node, addedNodes, nil
+			}
 			// don't add paths that should be deleted
 			if strings.HasPrefix(name, doubleWhiteoutPrefix) {
 				return nil, addedNodes, nil
@@ -264,7 +330,7 @@ func (tree *FileTree) AddPath(filepath string, data FileInfo) (*FileNode, []*Fil
 
 			// don't attach the payload. The payload is destined for the
 			// Path's end node, not any intermediary node.
-			node = node.AddChild(name, FileInfo{})
+			node = tree.AddChild(node, name, FileInfo{})
 			addedNodes = append(addedNodes, node)
 
 			if node == nil {
@@ -275,7 +341,10 @@ func (tree *FileTree) AddPath(filepath string, data FileInfo) (*FileNode, []*Fil
 
 		// attach payload to the last specified node
 		if idx == len(nodeNames)-1 {
+			// the opaque whiteout of a directory may be added before the directory itself (to a node without a payload)
+			opaque := node.Data.FileInfo.Opaque && node.Data.FileInfo.Path == ""
 			node.Data.FileInfo = data
+			node.Data.FileInfo.Opaque = data.Opaque || opaque
 		}
 	}
 	return node, addedNodes, nil
@@ -287,7 +356,48 @@ func (tree *FileTree) RemovePath(path string) error {
 	if err != nil {
 		return err
 	}
-	return node.Remove()
+	return tree.RemoveNode(node)
+}
+
+// AddChild creates a new node with the given payload beneath the given node of the tree. The payload of an existing
+// node of the same name is replaced instead (keeping its children).
+func (tree *FileTree) AddChild(parent *FileNode, name string, data FileInfo) (child *FileNode) {
+	// never allow processing of purely whiteout flag files (for now)
+	if strings.HasPrefix(name, doubleWhiteoutPrefix) {
+		return nil
+	}
+
+	parent = tree.own(parent)
+	if parent == nil {
+		return nil
+	}
+	if child = tree.ownChild(parent, name); child != nil {
+		// tree node already exists, replace the payload, keep the children
+		child.Data.FileInfo = *data.Copy()
+		return child
+	}
+
+	child = NewNode(parent, name, data)
+	if parent.Children == nil {
+		parent.Children = make(map[string]*FileNode)
+	}
+	parent.Children[name] = child
+	tree.Size++
+	return child
+}
+
+// RemoveNode removes the given node (along with the nodes beneath it) from the tree.
+func (tree *FileTree) RemoveNode(node *FileNode) error {
+	if node.Parent == nil {
+		return fmt.Errorf("cannot remove the tree root")
+	}
+	parent := tree.own(node.Parent)
+	if parent == nil || parent.Children[node.Name] == nil {
+		return fmt.Errorf("path does not exist: %s", node.Path())
+	}
+	tree.forget(parent.Children[node.Name])
+	delete(parent.Children, node.Name)
+	return nil
 }
 
 type compareMark struct {
@@ -331,13 +441,24 @@ func (tree *FileTree) CompareAndMark(upper *FileTree) ([]PathError, error) {
 			return nil
 		}
 
-		// the file exists in the lower layer
-		lowerNode, _ := tree.GetNode(upperNode.Path())
+		// the file exists in the lower layer (and takes the payload of the upper layer below)
+		lowerNode := tree.own(originalLowerNode)
 		diffType := lowerNode.compare(upperNode)
 		modifications = append(modifications, compareMark{lowerNode: lowerNode, upperNode: upperNode, tentative: diffType, final: -1})
 
 		return nil
 	}
+	// the contents of opaque directories hide anything in the lower tree that they do not replace
+	for _, dir := range upper.opaqueDirs() {
+		lowerDir, err := tree.GetNode(dir.Path())
+		if err != nil {
+			continue
+		}
+		if err := tree.markHidden(lowerDir, dir); err != nil {
+			failed = append(failed, NewPathError(dir.Path(), ActionRemove, err))
+		}
+	}
+
 	// we must visit from the leaves upwards to ensure that diff types can be derived from and assigned to children
 	err := upper.VisitDepthChildFirst(graft, nil)
 	if err != nil {
@@ -347,12 +468,12 @@ func (tree *FileTree) CompareAndMark(upper *FileTree) ([]PathError, error) {
 	// take note of the comparison results on each note in the owning tree.
 	for _, pair := range modifications {
 		if pair.final > 0 {
-			err = pair.lowerNode.AssignDiffType(pair.final)
+			err = tree.AssignDiffType(pair.lowerNode, pair.final)
 			if err != nil {
 				return failed, err
 			}
-		} else if pair.lowerNode.Data.DiffType == Unmodified {
-			err = pair.lowerNode.deriveDiffType(pair.tentative)
+		} else if tree.DiffType(pair.lowerNode) == Unmodified {
+			err = tree.deriveDiffType(pair.lowerNode, pair.tentative)
 			if err != nil {
 				return failed, err
 			}
@@ -364,13 +485,153 @@ func (tree *FileTree) CompareAndMark(upper *FileTree) ([]PathError, error) {
 	return failed, nil
 }
 
+// ResolveHardLinks points the hard links within the tree (which must be a single layer, since a hard link may only
+// refer to a file earlier in the same layer) at their targets. Each link takes the contents hash (and digest, if
+// computed) of its target, so that changes to the contents are seen through every link. A link has no size of its
+// own (tar readers report none, nor do the directory and podman sources), so the contents are only counted once (for
+// the target). The target records the number of links to it. A layer that replaces the target of a link after the
+// link must first be passed through KeepReplacedLinkTargets.
+func (tree *FileTree) ResolveHardLinks() {
+	err := tree.VisitDepthChildFirst(func(node *FileNode) error {
+		target := tree.hardLinkTarget(node)
+		if target == nil {
+			return nil
+		}
+		node, target = tree.own(node), tree.own(target)
+		node.Data.FileInfo.hash = target.Data.FileInfo.hash
+		node.Data.FileInfo.Digest = target.Data.FileInfo.Digest
+		target.Data.FileInfo.HardLinks++
+		return nil
+	}, func(node *FileNode) bool {
+		return node.Data.FileInfo.TypeFlag == tar.TypeLink
+	})
+	if err != nil {
+		logrus.Errorf("unable to resolve hard links: %+v", err)
+	}
+}
+
+// hardLinkTarget returns the file the given hard link refers to (following links to other links), or nil if the
+// target is not within the tree.
+func (tree *FileTree) hardLinkTarget(link *FileNode) *FileNode {
+	node := link
+	// a chain longer than the number of nodes must contain a cycle
+	for hops := 0; hops <= tree.Size; hops++ {
+		// link names are relative to the root of the layer (e.g. "bin/busybox" or "./bin/busybox")
+		target, err := tree.GetNode(path.Clean("/" + node.Data.FileInfo.Linkname))
+		if err != nil || target.Parent == nil || target == link || target.Data.FileInfo.IsDir {
+			return nil
+		}
+		if target.Data.FileInfo.TypeFlag != tar.TypeLink {
+			return target
+		}
+		node = target
+	}
+	return nil
+}
+
+// KeepReplacedLinkTargets keeps the contents of the files of a layer (given in the order of the layer tar) that are
+// replaced by a later entry while there are hard links to them: the first link still in place becomes the file holding
+// the replaced contents, and the other links refer to it instead (as when the tar is extracted). Otherwise the links
+// would be resolved to the contents of the replacing entry.
+func KeepReplacedLinkTargets(files []FileInfo) {
+	linkPath := func(name string) string {
+		// link names are relative to the root of the layer (e.g. "bin/busybox" or "./bin/busybox")
+		return path.Clean("/" + name)
+	}
+	// the entry holding each path, the entry each link refers to, and the links to each entry
+	current := make(map[string]int)
+	targets := make(map[int]int)
+	links := make(map[int][]int)
+
+	for idx := range files {
+		name := linkPath(files[idx].Path)
+		if replaced, exists := current[name]; exists && len(links[replaced]) > 0 {
+			var remaining []int
+			for _, link := range links[replaced] {
+				if current[linkPath(files[link].Path)] == link {
+					remaining = append(remaining, link)
+				}
+			}
+			delete(links, replaced)
+
+			if len(remaining) > 0 {
+				holder := &files[remaining[0]]
+				holder.TypeFlag = files[replaced].TypeFlag
+				holder.Linkname = ""
+				holder.Size = files[replaced].Size
+				holder.hash = files[replaced].hash
+				holder.Digest = files[replaced].Digest
+				delete(targets, remaining[0])
+				for _, link := range remaining[1:] {
+					files[link].Linkname = holder.Path
+					targets[link] = remaining[0]
+				}
+				links[remaining[0]] = remaining[1:]
+			}
+		}
+		current[name] = idx
+
+		if files[idx].TypeFlag != tar.TypeLink {
+			continue
+		}
+		target, exists := current[linkPath(files[idx].Linkname)]
+		if !exists || target == idx {
+			continue
+		}
+		if linked, isLink := targets[target]; isLink {
+			// a link to a link refers to the same file
+			target = linked
+		}
+		if files[target].TypeFlag == tar.TypeLink || files[target].IsDir {
+			continue
+		}
+		targets[idx] = target
+		links[target] = append(links[target], idx)
+	}
+}
+
+// opaqueDirs returns the directories of the tree marked as opaque (possibly including the root).
+func (tree *FileTree) opaqueDirs() []*FileNode {
+	var dirs []*FileNode
+	if tree.Root.Data.FileInfo.Opaque {
+		dirs = append(dirs, tree.Root)
+	}
+	err := tree.VisitDepthChildFirst(func(node *FileNode) error {
+		dirs = append(dirs, node)
+		return nil
+	}, func(node *FileNode) bool {
+		return node.Data.FileInfo.Opaque
+	})
+	if err != nil {
+		logrus.Errorf("unable to find opaque directories: %+v", err)
+	}
+	return dirs
+}
+
+// markHidden marks the contents of the lower directory (of the tree) that are not within the given (opaque) upper
+// directory as Removed.
+func (tree *FileTree) markHidden(lower, upper *FileNode) error {
+	for name, child := range lower.Children {
+		if upperChild, exists := upper.Children[name]; exists {
+			if err := tree.markHidden(child, upperChild); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tree.AssignDiffType(child, Removed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // markRemoved annotates the FileNode at the given path as Removed.
 func (tree *FileTree) markRemoved(path string) error {
 	node, err := tree.GetNode(path)
 	if err != nil {
 		return err
 	}
-	return node.AssignDiffType(Removed)
+	return tree.AssignDiffType(node, Removed)
 }
 
 // StackTreeRange combines an array of trees into a single tree
@@ -0,0 +1,142 @@
+package filetree
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// benchmarkFiles is the number of files of the synthetic layer (100 x 100 directories of 100 files each)
+const benchmarkFiles = 1_000_000
+
+var (
+	benchmarkLayerOnce sync.Once
+	benchmarkLayerInfo []FileInfo
+)
+
+// benchmarkLayer returns the payloads of a synthetic layer of a million files (and the directories holding them), as
+// parsed from a layer tar.
+func benchmarkLayer() []FileInfo {
+	benchmarkLayerOnce.Do(func() {
+		for dir := 0; dir < 100; dir++ {
+			dirPath := fmt.Sprintf("usr/lib%02d", dir)
+			benchmarkLayerInfo = append(benchmarkLayerInfo, FileInfo{Path: dirPath, TypeFlag: '5', IsDir: true, Mode: 0755 | 1<<31, Uname: "root", Gname: "root"})
+			for sub := 0; sub < 100; sub++ {
+				subPath := fmt.Sprintf("%s/package%02d", dirPath, sub)
+				benchmarkLayerInfo = append(benchmarkLayerInfo, FileInfo{Path: subPath, TypeFlag: '5', IsDir: true, Mode: 0755 | 1<<31, Uname: "root", Gname: "root"})
+				for file := 0; file < benchmarkFiles/10000; file++ {
+					filePath := fmt.Sprintf("%s/file%02d.so", subPath, file)
+					benchmarkLayerInfo = append(benchmarkLayerInfo, FileInfo{Path: filePath, TypeFlag: '0', Size: int64(file), hash: uint64(dir*sub + file), Mode: 0644, Uname: "root", Gname: "root"})
+				}
+			}
+		}
+	})
+	return benchmarkLayerInfo
+}
+
+func benchmarkTree(b *testing.B, infos []FileInfo) *FileTree {
+	tree := NewFileTree()
+	for _, info := range infos {
+		if _, _, err := tree.AddPath(info.Path, info); err != nil {
+			b.Fatalf("unable to add %s: %v", info.Path, err)
+		}
+	}
+	return tree
+}
+
+// reportHeap reports the heap held (per file of the synthetic layer) by whatever the given function returns.
+func reportHeap(b *testing.B, build func() any) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	held := build()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(held)
+	b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/benchmarkFiles, "heap-B/file")
+}
+
+func BenchmarkAddPath_MillionFiles(b *testing.B) {
+	infos := benchmarkLayer()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchmarkTree(b, infos)
+	}
+	b.StopTimer()
+	reportHeap(b, func() any { return benchmarkTree(b, infos) })
+}
+
+func BenchmarkCopy_MillionFiles(b *testing.B) {
+	tree := benchmarkTree(b, benchmarkLayer())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Copy()
+	}
+	b.StopTimer()
+	reportHeap(b, func() any { return tree.Copy() })
+	runtime.KeepAlive(tree)
+}
+
+func BenchmarkStack_MillionFiles(b *testing.B) {
+	lower := benchmarkTree(b, benchmarkLayer())
+	// an upper layer replacing every tenth file
+	var upperInfos []FileInfo
+	for idx, info := range benchmarkLayer() {
+		if idx%10 == 0 {
+			info.hash++
+			upperInfos = append(upperInfos, info)
+		}
+	}
+	upper := benchmarkTree(b, upperInfos)
+
+	stack := func() *FileTree {
+		tree := lower.Copy()
+		if _, err := tree.Stack(upper); err != nil {
+			b.Fatal(err)
+		}
+		return tree
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stack()
+	}
+	b.StopTimer()
+	// the heap held by a stack on top of the (already held) lower tree
+	reportHeap(b, func() any { return stack() })
+	runtime.KeepAlive(lower)
+}
+
+func BenchmarkCompareAndMark_MillionFiles(b *testing.B) {
+	lower := benchmarkTree(b, benchmarkLayer())
+	var upperInfos []FileInfo
+	for idx, info := range benchmarkLayer() {
+		if idx%10 == 0 {
+			info.hash++
+			upperInfos = append(upperInfos, info)
+		}
+	}
+	upper := benchmarkTree(b, upperInfos)
+
+	// comparisons are always made on a copy of the (held) lower tree
+	compare := func() *FileTree {
+		tree := lower.Copy()
+		if _, err := tree.CompareAndMark(upper); err != nil {
+			b.Fatal(err)
+		}
+		return tree
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compare()
+	}
+	b.StopTimer()
+	reportHeap(b, func() any { return compare() })
+	runtime.KeepAlive(lower)
+}
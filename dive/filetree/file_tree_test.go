@@ -1,7 +1,9 @@
 package filetree
 
 import (
+	"archive/tar"
 	"fmt"
+	"path"
 	"testing"
 )
 
@@ -15,8 +17,8 @@ func stringInSlice(a string, list []string) bool {
 }
 
 func AssertDiffType(node *FileNode, expectedDiffType DiffType) error {
-	if node.Data.DiffType != expectedDiffType {
-		return fmt.Errorf("Expecting node at %s to have DiffType %v, but had %v", node.Path(), expectedDiffType, node.Data.DiffType)
+	if node.Tree.DiffType(node) != expectedDiffType {
+		return fmt.Errorf("Expecting node at %s to have DiffType %v, but had %v", node.Path(), expectedDiffType, node.Tree.DiffType(node))
 	}
 	return nil
 }
@@ -27,7 +29,7 @@ func TestStringCollapsed(t *testing.T) {
 	two := tree.Root.AddChild("2 node!", FileInfo{})
 	subTwo := two.AddChild("2 child!", FileInfo{})
 	subTwo.AddChild("2 grandchild!", FileInfo{})
-	subTwo.Data.ViewInfo.Collapsed = true
+	tree.SetViewInfo(subTwo, ViewInfo{Collapsed: true})
 	three := tree.Root.AddChild("3 node!", FileInfo{})
 	subThree := three.AddChild("3 child!", FileInfo{})
 	three.AddChild("3 nested child 1!", FileInfo{})
@@ -35,7 +37,7 @@ func TestStringCollapsed(t *testing.T) {
 	threeGc1.AddChild("3 greatgrandchild 1!", FileInfo{})
 	subThree.AddChild("3 grandchild 2!", FileInfo{})
 	four := tree.Root.AddChild("4 node!", FileInfo{})
-	four.Data.ViewInfo.Collapsed = true
+	tree.SetViewInfo(four, ViewInfo{Collapsed: true})
 	tree.Root.AddChild("5 node!", FileInfo{})
 	four.AddChild("6, one level down...", FileInfo{})
 
@@ -212,6 +214,14 @@ func TestAddWhiteoutPath(t *testing.T) {
 	if err != nil {
 		t.Errorf("expected no error but got: %v", err)
 	}
+	if node == nil || node.Path() != "/usr/local/lib/python3.7/site-packages/pip" || !node.Data.FileInfo.Opaque {
+		t.Errorf("expected the opaque directory to be marked, but got: %v", node)
+	}
+	// other double whiteout files are ignored
+	node, _, err = tree.AddPath("usr/.wh..wh..plnk", FileInfo{})
+	if err != nil {
+		t.Errorf("expected no error but got: %v", err)
+	}
 	if node != nil {
 		t.Errorf("expected node to be nil, but got: %v", node)
 	}
@@ -332,14 +342,6 @@ func TestStack(t *testing.T) {
 	if err != nil {
 		t.Errorf("could not setup test: %v", err)
 	}
-	// ignore opaque whiteout files entirely
-	node, _, err := tree2.AddPath("/.wh..wh..opq", FileInfo{})
-	if err != nil {
-		t.Errorf("expected no error on whiteout file add, but got %v", err)
-	}
-	if node != nil {
-		t.Errorf("expected no node on whiteout file add, but got %v", node)
-	}
 
 	failedPaths, err := tree1.Stack(tree2)
 
@@ -361,7 +363,7 @@ func TestStack(t *testing.T) {
         └── systemd
 `
 
-	node, err = tree1.GetNode(payloadKey)
+	node, err := tree1.GetNode(payloadKey)
 	if err != nil {
 		t.Errorf("Expected '%s' to still exist, but it doesn't", payloadKey)
 	}
@@ -430,7 +432,120 @@ func TestCopy(t *testing.T) {
 	if expected != actual {
 		t.Errorf("Expected tree string:\n--->%s<---\nGot:\n--->%s<---", expected, actual)
 	}
+	// the original tree is left as it is
+	err = tree.VisitDepthChildFirst(func(node *FileNode) error {
+		for _, child := range node.Children {
+			if child.Parent != node {
+				t.Errorf("expected %s to remain a child of the original tree", child.Path())
+			}
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		t.Errorf("could not visit tree: %v", err)
+	}
+}
+
+func TestCopy_SharesUnalteredNodes(t *testing.T) {
+	tree := NewFileTree()
+	for _, path := range []string{"/etc/nginx/nginx.conf", "/etc/hosts", "/usr/bin/bash", "/usr/lib/libc.so"} {
+		if _, _, err := tree.AddPath(path, FileInfo{Path: path, Size: 100}); err != nil {
+			t.Fatalf("could not setup test: %v", err)
+		}
+	}
+	hosts, _ := tree.GetNode("/etc/hosts")
+	tree.SetViewInfo(hosts, ViewInfo{Hidden: true})
+	original := tree.String(true)
 
+	copied := tree.Copy()
+	if _, _, err := copied.AddPath("/usr/bin/sh", FileInfo{Path: "/usr/bin/sh", Size: 50}); err != nil {
+		t.Fatalf("could not add to the copy: %v", err)
+	}
+	if err := copied.RemovePath("/etc/nginx"); err != nil {
+		t.Fatalf("could not remove from the copy: %v", err)
+	}
+	upper := NewFileTree()
+	if _, _, err := upper.AddPath("/usr/lib/libc.so", FileInfo{Path: "/usr/lib/libc.so", Size: 200, hash: 1}); err != nil {
+		t.Fatalf("could not setup test: %v", err)
+	}
+	if _, err := copied.CompareAndMark(upper); err != nil {
+		t.Fatalf("could not compare the copy: %v", err)
+	}
+	copiedHosts, _ := copied.GetNode("/etc/hosts")
+	copied.SetViewInfo(copiedHosts, ViewInfo{})
+
+	// the original tree is left as it is...
+	if actual := tree.String(true); actual != original {
+		t.Errorf("expected the original tree to be unaltered:\n%s\ngot:\n%s", original, actual)
+	}
+	if !tree.ViewInfo(hosts).Hidden || tree.Size != 9 {
+		t.Errorf("expected the original tree state to be unaltered (size %d)", tree.Size)
+	}
+	libc, _ := tree.GetNode("/usr/lib/libc.so")
+	if tree.DiffType(libc) != Unmodified || libc.Data.FileInfo.Size != 100 {
+		t.Errorf("expected the original libc to be unaltered, got %v (%d bytes)", tree.DiffType(libc), libc.Data.FileInfo.Size)
+	}
+
+	// ...while the copy has its own nodes and state where it has been altered...
+	copiedLibc, _ := copied.GetNode("/usr/lib/libc.so")
+	if copiedLibc == libc || copied.DiffType(copiedLibc) != Modified || copiedLibc.Data.FileInfo.Size != 200 {
+		t.Errorf("expected the copied libc to be modified, got %v (%d bytes)", copied.DiffType(copiedLibc), copiedLibc.Data.FileInfo.Size)
+	}
+	if copied.ViewInfo(copiedHosts).Hidden || copied.Size != 8 {
+		t.Errorf("expected the copied tree state to be altered (size %d)", copied.Size)
+	}
+
+	// ...and shares the nodes it has not altered
+	if copiedHosts != hosts {
+		t.Errorf("expected /etc/hosts to be shared")
+	}
+	bash, _ := tree.GetNode("/usr/bin/bash")
+	if copiedBash, _ := copied.GetNode("/usr/bin/bash"); copiedBash != bash {
+		t.Errorf("expected /usr/bin/bash to be shared")
+	}
+}
+
+func TestCopy_SharedNodeParents(t *testing.T) {
+	tree := NewFileTree()
+	for _, filePath := range []string{"/etc/nginx/nginx.conf", "/etc/nginx/conf.d/default.conf", "/usr/bin/bash"} {
+		if _, _, err := tree.AddPath(filePath, FileInfo{Path: filePath}); err != nil {
+			t.Fatalf("could not setup test: %v", err)
+		}
+	}
+	copied := tree.Copy()
+
+	// both trees alter the nodes above nodes they still share
+	if _, _, err := tree.AddPath("/etc/nginx/mime.types", FileInfo{}); err != nil {
+		t.Fatalf("could not setup test: %v", err)
+	}
+	if _, _, err := copied.AddPath("/etc/nginx/sites/default", FileInfo{}); err != nil {
+		t.Fatalf("could not setup test: %v", err)
+	}
+	if err := copied.RemovePath("/usr/bin"); err != nil {
+		t.Fatalf("could not setup test: %v", err)
+	}
+
+	// the parent of a shared node may be held by another tree, but is always the same node at the parent path
+	for name, current := range map[string]*FileTree{"original": tree, "copy": copied} {
+		err := current.VisitDepthChildFirst(func(node *FileNode) error {
+			parent, err := current.GetNode(path.Dir(node.Path()))
+			if err != nil {
+				return err
+			}
+			if node.Parent.id != parent.id || node.Parent.Name != parent.Name || node.Parent.Path() != parent.Path() {
+				t.Errorf("%s: expected the parent of %s to be %s, got %s", name, node.Path(), parent.Path(), node.Parent.Path())
+			}
+			return nil
+		}, nil)
+		if err != nil {
+			t.Errorf("%s: could not visit tree: %v", name, err)
+		}
+	}
+	conf, _ := copied.GetNode("/etc/nginx/conf.d")
+	nginx, _ := copied.GetNode("/etc/nginx")
+	if conf.Parent == nginx || conf.Parent.Children["sites"] != nil {
+		t.Errorf("expected the shared /etc/nginx/conf.d to keep the parent of the original tree")
+	}
 }
 
 func TestCompareWithNoChanges(t *testing.T) {
@@ -464,8 +579,8 @@ func TestCompareWithNoChanges(t *testing.T) {
 		if n.Path() == "/" {
 			return nil
 		}
-		if (n.Data.DiffType) != Unmodified {
-			t.Errorf("Expecting node at %s to have DiffType unchanged, but had %v", n.Path(), n.Data.DiffType)
+		if n.Tree.DiffType(n) != Unmodified {
+			t.Errorf("Expecting node at %s to have DiffType unchanged, but had %v", n.Path(), n.Tree.DiffType(n))
 		}
 		return nil
 	}
@@ -816,12 +931,12 @@ func TestRemoveOnIterate(t *testing.T) {
 		}
 		node, _, err := tree.AddPath(value, fakeData)
 		if err == nil && stringInSlice(node.Path(), []string{"/etc"}) {
-			node.Data.ViewInfo.Hidden = true
+			tree.SetViewInfo(node, ViewInfo{Hidden: true})
 		}
 	}
 
 	err := tree.VisitDepthChildFirst(func(node *FileNode) error {
-		if node.Data.ViewInfo.Hidden {
+		if tree.ViewInfo(node).Hidden {
 			err := tree.RemovePath(node.Path())
 			if err != nil {
 				t.Errorf("could not setup test: %v", err)
@@ -844,3 +959,230 @@ func TestRemoveOnIterate(t *testing.T) {
 	}
 
 }
+
+// hardLinkedTree is a layer like a busybox install: a single binary and many hard links to it.
+func hardLinkedTree(t *testing.T) *FileTree {
+	tree := NewFileTree()
+	files := []FileInfo{
+		{Path: "/bin", TypeFlag: tar.TypeDir, IsDir: true},
+		{Path: "/bin/busybox", TypeFlag: tar.TypeReg, Size: 1000, hash: 42},
+		{Path: "/bin/sh", TypeFlag: tar.TypeLink, Linkname: "bin/busybox"},
+		{Path: "/bin/ls", TypeFlag: tar.TypeLink, Linkname: "./bin/busybox"},
+		// a link to a link still refers to the binary
+		{Path: "/usr/bin/env", TypeFlag: tar.TypeLink, Linkname: "bin/sh"},
+		// a link to a file that is not within the layer is left as-is
+		{Path: "/usr/bin/missing", TypeFlag: tar.TypeLink, Linkname: "bin/nothing"},
+	}
+	for _, file := range files {
+		tree.FileSize += uint64(file.Size)
+		if _, _, err := tree.AddPath(file.Path, file); err != nil {
+			t.Fatalf("could not setup test: %v", err)
+		}
+	}
+	return tree
+}
+
+func TestResolveHardLinks(t *testing.T) {
+	tree := hardLinkedTree(t)
+	tree.ResolveHardLinks()
+
+	bin, _ := tree.GetNode("/bin")
+	if size := bin.GetSize(); size != 1000 {
+		t.Errorf("expected /bin to be 1000 bytes, got %d", size)
+	}
+
+	busybox, _ := tree.GetNode("/bin/busybox")
+	if busybox.Data.FileInfo.HardLinks != 3 {
+		t.Errorf("expected 3 hard links to the binary, got %d", busybox.Data.FileInfo.HardLinks)
+	}
+	for _, path := range []string{"/bin/sh", "/bin/ls", "/usr/bin/env"} {
+		link, _ := tree.GetNode(path)
+		if link.Data.FileInfo.Size != 0 || link.Data.FileInfo.hash != busybox.Data.FileInfo.hash {
+			t.Errorf("expected %s to refer to the binary, got %+v", path, link.Data.FileInfo)
+		}
+	}
+
+	missing, _ := tree.GetNode("/usr/bin/missing")
+	if missing.Data.FileInfo.hash != 0 || missing.Data.FileInfo.HardLinks != 0 {
+		t.Errorf("expected an unresolved link to be left as-is, got %+v", missing.Data.FileInfo)
+	}
+
+	expected :=
+		`├── bin
+│   ├── busybox (3 hard links)
+│   ├── ls → ./bin/busybox (hard link)
+│   └── sh → bin/busybox (hard link)
+└── usr
+    └── bin
+        ├── env → bin/sh (hard link)
+        └── missing → bin/nothing (hard link)
+`
+	if actual := tree.String(false); actual != expected {
+		t.Errorf("Expected tree string:\n--->%s<---\nGot:\n--->%s<---", expected, actual)
+	}
+}
+
+func TestResolveHardLinks_Cycle(t *testing.T) {
+	tree := NewFileTree()
+	for _, file := range []FileInfo{
+		{Path: "/a", TypeFlag: tar.TypeLink, Linkname: "b"},
+		{Path: "/b", TypeFlag: tar.TypeLink, Linkname: "a"},
+		{Path: "/c", TypeFlag: tar.TypeLink, Linkname: "c"},
+	} {
+		if _, _, err := tree.AddPath(file.Path, file); err != nil {
+			t.Fatalf("could not setup test: %v", err)
+		}
+	}
+	tree.ResolveHardLinks()
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		link, _ := tree.GetNode(path)
+		if link.Data.FileInfo.hash != 0 || link.Data.FileInfo.HardLinks != 0 {
+			t.Errorf("expected %s (without a target) to be left as-is, got %+v", path, link.Data.FileInfo)
+		}
+	}
+}
+
+func TestKeepReplacedLinkTargets(t *testing.T) {
+	files := []FileInfo{
+		{Path: "bin/busybox", TypeFlag: tar.TypeReg, Size: 1000, hash: 42},
+		{Path: "bin/sh", TypeFlag: tar.TypeLink, Linkname: "bin/busybox"},
+		{Path: "bin/ls", TypeFlag: tar.TypeLink, Linkname: "bin/sh"},
+		{Path: "bin/cat", TypeFlag: tar.TypeLink, Linkname: "bin/busybox"},
+		// the first link is replaced, then the binary
+		{Path: "bin/sh", TypeFlag: tar.TypeReg, Size: 10, hash: 7},
+		{Path: "bin/busybox", TypeFlag: tar.TypeReg, Size: 2000, hash: 43},
+		// a link after the replacement refers to the new binary
+		{Path: "bin/vi", TypeFlag: tar.TypeLink, Linkname: "bin/busybox"},
+	}
+	KeepReplacedLinkTargets(files)
+
+	if ls := files[2]; ls.TypeFlag != tar.TypeReg || ls.Linkname != "" || ls.Size != 1000 || ls.hash != 42 {
+		t.Errorf("expected the first remaining link to hold the replaced binary, got %+v", ls)
+	}
+	if cat := files[3]; cat.TypeFlag != tar.TypeLink || cat.Linkname != "bin/ls" {
+		t.Errorf("expected the other links to refer to the new holder, got %+v", cat)
+	}
+	if vi := files[6]; vi.Linkname != "bin/busybox" {
+		t.Errorf("expected a later link to be left as-is, got %+v", vi)
+	}
+}
+
+// opaqueTrees returns a lower tree and an upper tree that replaces the contents of /etc/nginx with an opaque whiteout.
+func opaqueTrees(t *testing.T) (*FileTree, *FileTree) {
+	lowerTree := NewFileTree()
+	upperTree := NewFileTree()
+	lowerPaths := []string{"/etc/nginx/nginx.conf", "/etc/nginx/conf.d/default.conf", "/etc/nginx/mime.types", "/etc/hosts"}
+	// the opaque whiteout comes before its directory, as some tar writers order it
+	upperPaths := []string{"/etc/nginx/.wh..wh..opq", "/etc/nginx", "/etc/nginx/nginx.conf", "/etc/nginx/conf.d/site.conf"}
+
+	for _, value := range lowerPaths {
+		if _, _, err := lowerTree.AddPath(value, FileInfo{Path: value, TypeFlag: 1, hash: 123, Size: 100}); err != nil {
+			t.Fatalf("could not setup test: %v", err)
+		}
+	}
+	for _, value := range upperPaths {
+		if _, _, err := upperTree.AddPath(value, FileInfo{Path: value, TypeFlag: 1, hash: 123, Size: 10}); err != nil {
+			t.Fatalf("could not setup test: %v", err)
+		}
+	}
+	return lowerTree, upperTree
+}
+
+func TestAddOpaqueWhiteoutPath(t *testing.T) {
+	_, upperTree := opaqueTrees(t)
+
+	node, err := upperTree.GetNode("/etc/nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !node.Data.FileInfo.Opaque || node.Data.FileInfo.Path != "/etc/nginx" {
+		t.Errorf("expected the directory payload to be kept opaque, got %+v", node.Data.FileInfo)
+	}
+	if _, err := upperTree.GetNode("/etc/nginx/.wh..wh..opq"); err == nil {
+		t.Errorf("expected the opaque whiteout to not be added as a node")
+	}
+}
+
+func TestStackOpaqueWhiteout(t *testing.T) {
+	lowerTree, upperTree := opaqueTrees(t)
+
+	failedPaths, err := lowerTree.Stack(upperTree)
+	if err != nil {
+		t.Errorf("Could not stack refTrees: %v", err)
+	}
+	if len(failedPaths) > 0 {
+		t.Errorf("expected no filepath errors, got %d", len(failedPaths))
+	}
+
+	expected :=
+		`└── etc
+    ├── hosts
+    └── nginx
+        ├── conf.d
+        │   └── site.conf
+        └── nginx.conf
+`
+	if actual := lowerTree.String(false); actual != expected {
+		t.Errorf("Expected tree string:\n--->%s<---\nGot:\n--->%s<---", expected, actual)
+	}
+}
+
+func TestStackOpaqueRoot(t *testing.T) {
+	lowerTree, _ := opaqueTrees(t)
+	upperTree := NewFileTree()
+	for _, value := range []string{"/.wh..wh..opq", "/bin/sh"} {
+		if _, _, err := upperTree.AddPath(value, FileInfo{}); err != nil {
+			t.Fatalf("could not setup test: %v", err)
+		}
+	}
+
+	if _, err := lowerTree.Stack(upperTree); err != nil {
+		t.Errorf("Could not stack refTrees: %v", err)
+	}
+
+	expected :=
+		`└── bin
+    └── sh
+`
+	if actual := lowerTree.String(false); actual != expected {
+		t.Errorf("Expected tree string:\n--->%s<---\nGot:\n--->%s<---", expected, actual)
+	}
+}
+
+func TestCompareWithOpaqueWhiteout(t *testing.T) {
+	lowerTree, upperTree := opaqueTrees(t)
+
+	failedPaths, err := lowerTree.CompareAndMark(upperTree)
+	if err != nil {
+		t.Errorf("could not setup test: %v", err)
+	}
+	if len(failedPaths) > 0 {
+		t.Errorf("expected no filepath errors, got %d", len(failedPaths))
+	}
+
+	expected := map[string]DiffType{
+		"/etc":                           Modified,
+		"/etc/hosts":                     Unmodified,
+		"/etc/nginx":                     Modified,
+		"/etc/nginx/nginx.conf":          Unmodified,
+		"/etc/nginx/mime.types":          Removed,
+		"/etc/nginx/conf.d":              Modified,
+		"/etc/nginx/conf.d/default.conf": Removed,
+		"/etc/nginx/conf.d/site.conf":    Added,
+	}
+	visited := 0
+	err = lowerTree.VisitDepthChildFirst(func(n *FileNode) error {
+		visited++
+		if err := AssertDiffType(n, expected[n.Path()]); err != nil {
+			t.Error(err)
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		t.Errorf("Expected no errors when visiting nodes, got: %+v", err)
+	}
+	if visited != len(expected) {
+		t.Errorf("expected %d nodes, visited %d", len(expected), visited)
+	}
+}
@@ -2,27 +2,23 @@ package filetree
 
 var GlobalFileTreeCollapse bool
 
-// NodeData is the payload for a FileNode
+// NodeData is the payload for a FileNode. The view and comparison state of a node (formerly the ViewInfo and DiffType
+// fields) is held by the tree instead, since the node may be shared with other trees: use FileTree.ViewInfo,
+// FileTree.SetViewInfo and FileTree.DiffType.
 type NodeData struct {
-	ViewInfo ViewInfo
 	FileInfo FileInfo
-	DiffType DiffType
 }
 
 // NewNodeData creates an empty NodeData struct for a FileNode
 func NewNodeData() *NodeData {
 	return &NodeData{
-		ViewInfo: *NewViewInfo(),
 		FileInfo: FileInfo{},
-		DiffType: Unmodified,
 	}
 }
 
 // Copy duplicates a NodeData
 func (data *NodeData) Copy() *NodeData {
 	return &NodeData{
-		ViewInfo: *data.ViewInfo.Copy(),
 		FileInfo: *data.FileInfo.Copy(),
-		DiffType: data.DiffType,
 	}
 }
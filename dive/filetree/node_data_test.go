@@ -10,8 +10,11 @@ func TestAssignDiffType(t *testing.T) {
 	if err != nil {
 		t.Errorf("Expected no error from fetching path. got: %v", err)
 	}
-	node.Data.DiffType = Modified
-	if tree.Root.Children["usr"].Data.DiffType != Modified {
+	err = node.AssignDiffType(Modified)
+	if err != nil {
+		t.Errorf("Expected no error from assigning the diff type. got: %v", err)
+	}
+	if tree.DiffType(tree.Root.Children["usr"]) != Modified {
 		t.Fail()
 	}
 }
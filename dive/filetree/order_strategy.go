@@ -17,6 +17,8 @@ type OrderStrategy interface {
 	orderKeys(files map[string]*FileNode) []string
 }
 
+// GetSortOrderStrategy returns the strategy ordering nodes by the given SortOrder (by their size within their own Tree,
+// see FileNode.GetSize).
 func GetSortOrderStrategy(sortOrder SortOrder) OrderStrategy {
 	switch sortOrder {
 	case ByName:
@@ -27,6 +29,15 @@ func GetSortOrderStrategy(sortOrder SortOrder) OrderStrategy {
 	return orderByNameStrategy{}
 }
 
+// sortOrderStrategy returns the strategy ordering the nodes of the tree by its SortOrder (the sizes of the nodes depend
+// on the tree, see NodeSize).
+func (tree *FileTree) sortOrderStrategy() OrderStrategy {
+	if tree.SortOrder == BySizeDesc {
+		return orderBySizeDescStrategy{tree: tree}
+	}
+	return GetSortOrderStrategy(tree.SortOrder)
+}
+
 type orderByNameStrategy struct{}
 
 func (orderByNameStrategy) orderKeys(files map[string]*FileNode) []string {
@@ -40,9 +51,19 @@ func (orderByNameStrategy) orderKeys(files map[string]*FileNode) []string {
 	return keys
 }
 
-type orderBySizeDescStrategy struct{}
+type orderBySizeDescStrategy struct {
+	// tree is the tree the sizes are taken within (the Tree of each node when nil)
+	tree *FileTree
+}
+
+func (strategy orderBySizeDescStrategy) size(node *FileNode) int64 {
+	if strategy.tree == nil {
+		return node.GetSize()
+	}
+	return strategy.tree.NodeSize(node)
+}
 
-func (orderBySizeDescStrategy) orderKeys(files map[string]*FileNode) []string {
+func (strategy orderBySizeDescStrategy) orderKeys(files map[string]*FileNode) []string {
 	var keys []string
 	for key := range files {
 		keys = append(keys, key)
@@ -50,11 +71,11 @@ func (orderBySizeDescStrategy) orderKeys(files map[string]*FileNode) []string {
 
 	sort.Slice(keys, func(i, j int) bool {
 		ki, kj := keys[i], keys[j]
-		ni, nj := files[ki], files[kj]
-		if ni.GetSize() == nj.GetSize() {
+		si, sj := strategy.size(files[ki]), strategy.size(files[kj])
+		if si == sj {
 			return ki < kj
 		}
-		return ni.GetSize() > nj.GetSize()
+		return si > sj
 	})
 
 	return keys
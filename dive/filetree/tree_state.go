@@ -0,0 +1,127 @@
+package filetree
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// The view and comparison state of the nodes is held by each tree (by node id) rather than by the nodes, since the
+// nodes may be shared with other trees. Only the state that differs from the default is held.
+
+// ViewInfo returns the view state of the given node of the tree.
+func (tree *FileTree) ViewInfo(node *FileNode) ViewInfo {
+	if view, exists := tree.views[node.id]; exists {
+		return view
+	}
+	return defaultViewInfo(node)
+}
+
+// SetViewInfo sets the view state of the given node of the tree (leaving any other tree sharing the node as it is).
+func (tree *FileTree) SetViewInfo(node *FileNode, view ViewInfo) {
+	if view == defaultViewInfo(node) {
+		delete(tree.views, node.id)
+		return
+	}
+	if tree.views == nil {
+		tree.views = make(map[uint64]ViewInfo)
+	}
+	tree.views[node.id] = view
+}
+
+func defaultViewInfo(node *FileNode) ViewInfo {
+	if node.Parent == nil {
+		// the root is never collapsed
+		return ViewInfo{}
+	}
+	return *NewViewInfo()
+}
+
+// DiffType returns the DiffType the given node of the tree has been marked with (see CompareAndMark).
+func (tree *FileTree) DiffType(node *FileNode) DiffType {
+	return tree.diffTypes[node.id]
+}
+
+// AssignDiffType will assign the given DiffType to the given node of the tree, possibly affecting child nodes.
+func (tree *FileTree) AssignDiffType(node *FileNode, diffType DiffType) error {
+	tree.setDiffType(node, diffType)
+
+	if diffType == Removed {
+		// if we've removed this node, then all children have been removed as well
+		for _, child := range node.Children {
+			if err := tree.AssignDiffType(child, diffType); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (tree *FileTree) setDiffType(node *FileNode, diffType DiffType) {
+	// the sizes of directories do not include removed files
+	tree.sizes = nil
+	if diffType == Unmodified {
+		delete(tree.diffTypes, node.id)
+		return
+	}
+	if tree.diffTypes == nil {
+		tree.diffTypes = make(map[uint64]DiffType)
+	}
+	tree.diffTypes[node.id] = diffType
+}
+
+// deriveDiffType determines a DiffType to the given node of the tree. Note: the DiffType of a node is always the
+// DiffType of its attributes and its contents. The contents are the bytes of the file of the children of a directory.
+func (tree *FileTree) deriveDiffType(node *FileNode, diffType DiffType) error {
+	if node.IsLeaf() {
+		return tree.AssignDiffType(node, diffType)
+	}
+
+	myDiffType := diffType
+	for _, v := range node.Children {
+		myDiffType = myDiffType.merge(tree.DiffType(v))
+	}
+
+	return tree.AssignDiffType(node, myDiffType)
+}
+
+// NodeSize returns the total size of the given node of the tree. The size of a directory does not include the files
+// beneath it that have been removed (unless the directory itself has been removed, then it is the accumulated size of
+// the removed files).
+func (tree *FileTree) NodeSize(node *FileNode) int64 {
+	if node.IsLeaf() {
+		return node.Data.FileInfo.Size
+	}
+	if size, exists := tree.sizes[node.id]; exists {
+		return size
+	}
+
+	var sizeBytes int64
+	removed := tree.DiffType(node) == Removed
+	sizer := func(curNode *FileNode) error {
+		if removed || tree.DiffType(curNode) != Removed {
+			sizeBytes += curNode.Data.FileInfo.Size
+		}
+		return nil
+	}
+	err := node.VisitDepthChildFirst(sizer, nil, nil)
+	if err != nil {
+		logrus.Errorf("unable to propagate node for metadata: %+v", err)
+	}
+
+	if tree.sizes == nil {
+		tree.sizes = make(map[uint64]int64)
+	}
+	tree.sizes[node.id] = sizeBytes
+	return sizeBytes
+}
+
+// forget drops the given node (and the nodes beneath it), which has been removed from the tree, from the size and the
+// node state of the tree.
+func (tree *FileTree) forget(node *FileNode) {
+	for _, child := range node.Children {
+		tree.forget(child)
+	}
+	tree.Size--
+	delete(tree.views, node.id)
+	delete(tree.diffTypes, node.id)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/wagoodman/dive/dive/image"
+	"github.com/wagoodman/dive/dive/image/dir"
 	"github.com/wagoodman/dive/dive/image/docker"
 	"github.com/wagoodman/dive/dive/image/podman"
 )
@@ -15,14 +16,19 @@ const (
 	SourceDockerEngine
 	SourcePodmanEngine
 	SourceDockerArchive
+	SourceOciDir
+	SourceRegistry
+	SourceContainerd
+	SourceDirectory
+	SourceDirectories
 )
 
 type ImageSource int
 
-var ImageSources = []string{SourceDockerEngine.String(), SourcePodmanEngine.String(), SourceDockerArchive.String()}
+var ImageSources = []string{SourceDockerEngine.String(), SourcePodmanEngine.String(), SourceDockerArchive.String(), SourceOciDir.String(), SourceRegistry.String(), SourceContainerd.String(), SourceDirectory.String(), SourceDirectories.String()}
 
 func (r ImageSource) String() string {
-	return [...]string{"unknown", "docker", "podman", "docker-archive"}[r]
+	return [...]string{"unknown", "docker", "podman", "docker-archive", "oci-dir", "registry", "containerd", "dir", "dirs"}[r]
 }
 
 func ParseImageSource(r string) ImageSource {
@@ -35,6 +41,18 @@ func ParseImageSource(r string) ImageSource {
 		return SourceDockerArchive
 	case "docker-tar":
 		return SourceDockerArchive
+	case SourceOciDir.String():
+		return SourceOciDir
+	case "oci":
+		return SourceOciDir
+	case SourceRegistry.String():
+		return SourceRegistry
+	case SourceContainerd.String():
+		return SourceContainerd
+	case SourceDirectory.String():
+		return SourceDirectory
+	case SourceDirectories.String():
+		return SourceDirectories
 	default:
 		return SourceUnknown
 	}
@@ -57,18 +75,40 @@ func DeriveImageSource(image string) (ImageSource, string) {
 		return SourceDockerArchive, imageSource
 	case "docker-tar":
 		return SourceDockerArchive, imageSource
+	case SourceOciDir.String():
+		return SourceOciDir, imageSource
+	case "oci":
+		return SourceOciDir, imageSource
+	case SourceRegistry.String():
+		return SourceRegistry, imageSource
+	case SourceContainerd.String():
+		return SourceContainerd, imageSource
+	case SourceDirectory.String():
+		return SourceDirectory, imageSource
+	case SourceDirectories.String():
+		return SourceDirectories, imageSource
 	}
 	return SourceUnknown, ""
 }
 
-func GetImageResolver(r ImageSource) (image.Resolver, error) {
+func GetImageResolver(r ImageSource, options image.ResolverOptions) (image.Resolver, error) {
 	switch r {
 	case SourceDockerEngine:
-		return docker.NewResolverFromEngine(), nil
+		return docker.NewResolverFromEngine(options), nil
 	case SourcePodmanEngine:
-		return podman.NewResolverFromEngine(), nil
+		return podman.NewResolverFromEngine(options), nil
 	case SourceDockerArchive:
-		return docker.NewResolverFromArchive(), nil
+		return docker.NewResolverFromArchive(options), nil
+	case SourceOciDir:
+		return docker.NewResolverFromOciLayout(options), nil
+	case SourceRegistry:
+		return docker.NewResolverFromRegistry(options), nil
+	case SourceContainerd:
+		return docker.NewResolverFromContainerd(options), nil
+	case SourceDirectory:
+		return dir.NewResolverFromDirectory(options), nil
+	case SourceDirectories:
+		return dir.NewResolverFromDirectories(options), nil
 	}
 
 	return nil, fmt.Errorf("unable to determine image resolver")
@@ -9,12 +9,14 @@ type Analyzer interface {
 }
 
 type AnalysisResult struct {
-	Layers            []*Layer
-	RefTrees          []*filetree.FileTree
-	Efficiency        float64
-	SizeBytes         uint64
-	UserSizeByes      uint64  // this is all bytes except for the base image
-	WastedUserPercent float64 // = wasted-bytes/user-size-bytes
-	WastedBytes       uint64
-	Inefficiencies    filetree.EfficiencySlice
+	Layers     []*Layer
+	RefTrees   []*filetree.FileTree
+	Efficiency float64
+	SizeBytes  uint64
+	// CompressedSizeBytes is the size of the layer blobs as pulled (zero when unknown for any layer)
+	CompressedSizeBytes uint64
+	UserSizeByes        uint64  // this is all bytes except for the base image
+	WastedUserPercent   float64 // = wasted-bytes/user-size-bytes
+	WastedBytes         uint64
+	Inefficiencies      filetree.EfficiencySlice
 }
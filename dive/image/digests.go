@@ -0,0 +1,21 @@
+package image
+
+import (
+	"context"
+
+	"github.com/wagoodman/dive/dive/filetree"
+)
+
+type fileDigestsKey struct{}
+
+// WithFileDigests requests the resolvers fetching with the returned context to compute the digest of the given
+// algorithm for every regular file of the image (see filetree.FileInfo.Digest), which is skipped by default.
+func WithFileDigests(ctx context.Context, algorithm filetree.DigestAlgorithm) context.Context {
+	return context.WithValue(ctx, fileDigestsKey{}, algorithm)
+}
+
+// FileDigestsFrom returns the file digest algorithm requested with the context (filetree.NoDigest when there is none).
+func FileDigestsFrom(ctx context.Context) filetree.DigestAlgorithm {
+	algorithm, _ := ctx.Value(fileDigestsKey{}).(filetree.DigestAlgorithm)
+	return algorithm
+}
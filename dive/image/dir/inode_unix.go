@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package dir
+
+import (
+	"os"
+	"syscall"
+)
+
+// hardLinkInode returns the inode of a regular file that has more than one link
+func hardLinkInode(info os.FileInfo) (inode, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() || stat.Nlink < 2 {
+		return inode{}, false
+	}
+	return inode{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
@@ -0,0 +1,10 @@
+package dir
+
+import (
+	"os"
+)
+
+// hardLinkInode is not supported on windows (hard links are counted as separate files)
+func hardLinkInode(_ os.FileInfo) (inode, bool) {
+	return inode{}, false
+}
@@ -0,0 +1,141 @@
+package dir
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wagoodman/dive/dive/filetree"
+	"github.com/wagoodman/dive/dive/image"
+)
+
+type resolver struct {
+	options image.ResolverOptions
+	layered bool
+}
+
+// NewResolverFromDirectory analyzes a single directory (e.g. an extracted root filesystem) as a one-layer image.
+func NewResolverFromDirectory(options image.ResolverOptions) *resolver {
+	return &resolver{
+		options: options,
+	}
+}
+
+// NewResolverFromDirectories analyzes a comma separated list of directories as the ordered layers of an image (the
+// first directory being the base layer).
+func NewResolverFromDirectories(options image.ResolverOptions) *resolver {
+	return &resolver{
+		options: options,
+		layered: true,
+	}
+}
+
+func (r *resolver) Fetch(ctx context.Context, id string) (*image.Image, error) {
+	paths := []string{id}
+	if r.layered {
+		paths = strings.Split(id, ",")
+	}
+
+	progress := image.ProgressTrackerFrom(ctx)
+	progress.SetLayersTotal(len(paths))
+
+	img := &image.Image{}
+	for idx, root := range paths {
+		tree, err := readTree(ctx, root)
+		if err != nil {
+			return nil, err
+		}
+		progress.LayerParsed()
+
+		img.Trees = append(img.Trees, tree)
+		img.Layers = append(img.Layers, &image.Layer{
+			Id:      filepath.Base(filepath.Clean(root)),
+			Index:   idx,
+			Command: root,
+			Size:    tree.FileSize,
+			Tree:    tree,
+			Names:   []string{root},
+		})
+	}
+	return img, nil
+}
+
+func (r *resolver) Build(ctx context.Context, args []string) (*image.Image, error) {
+	return nil, fmt.Errorf("build option not supported for directory resolver")
+}
+
+// inode identifies a file on disk (inode numbers are only unique within a device).
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// readTree walks the given directory (without following symlinks) into a file tree, stopping early once the given
+// context is done. The file digests requested with the context are computed for regular files.
+func readTree(ctx context.Context, root string) (*filetree.FileTree, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	tree := filetree.NewFileTree()
+	tree.Name = root
+
+	// hard links are recorded as links to the first path seen for the same inode (as in a layer tar), so that their
+	// contents are only counted once
+	links := make(map[inode]string)
+	digests := image.FileDigestsFrom(ctx)
+
+	err = filepath.WalkDir(root, func(realPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, realPath)
+		if err != nil || relPath == "." {
+			return err
+		}
+		if entry.Type()&fs.ModeSocket != 0 {
+			// sockets cannot be represented within an image
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		path := filepath.ToSlash(relPath)
+		linkInode, isLinked := hardLinkInode(info)
+		var fileInfo filetree.FileInfo
+		if first, exists := links[linkInode]; isLinked && exists {
+			// the contents have been read for the first path already
+			fileInfo = filetree.NewHardLinkFileInfo(path, first, info)
+		} else {
+			fileInfo, err = filetree.NewFileInfoWithDigest(realPath, path, info, digests)
+			if err != nil {
+				return err
+			}
+			if isLinked {
+				links[linkInode] = path
+			}
+		}
+
+		tree.FileSize += uint64(fileInfo.Size)
+		_, _, err = tree.AddPath(path, fileInfo)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read directory %s: %w", root, err)
+	}
+	tree.ResolveHardLinks()
+	return tree, nil
+}
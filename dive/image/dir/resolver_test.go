@@ -0,0 +1,133 @@
+package dir
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wagoodman/dive/dive/image"
+	"github.com/wagoodman/dive/dive/image/docker"
+)
+
+// testLayerDirs extracts every layer of the given docker-archive into its own directory, in layer order
+func testLayerDirs(t *testing.T, tarPath string) []string {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatalf("unable to open archive: %v", err)
+	}
+	defer f.Close()
+
+	root := t.TempDir()
+	var manifests []struct {
+		Layers []string
+	}
+	tarReader := tar.NewReader(f)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to read archive: %v", err)
+		}
+		switch {
+		case header.Name == "manifest.json":
+			if err := json.NewDecoder(tarReader).Decode(&manifests); err != nil {
+				t.Fatalf("unable to parse manifest: %v", err)
+			}
+		case strings.HasSuffix(header.Name, "/layer.tar"):
+			docker.TestExtractTar(t, tarReader, filepath.Join(root, header.Name), nil)
+		}
+	}
+
+	var dirs []string
+	for _, layer := range manifests[0].Layers {
+		dirs = append(dirs, filepath.Join(root, layer))
+	}
+	return dirs
+}
+
+func Test_DirectoriesResolver(t *testing.T) {
+	dirs := testLayerDirs(t, "../../../.data/test-docker-image.tar")
+
+	img, err := NewResolverFromDirectories(image.ResolverOptions{}).Fetch(context.Background(), strings.Join(dirs, ","))
+	if err != nil {
+		t.Fatalf("unable to fetch image: %v", err)
+	}
+
+	result, err := img.Analyze()
+	if err != nil {
+		t.Fatalf("unable to analyze: %v", err)
+	}
+	docker.TestCheckAnalysis(t, "", result)
+}
+
+func Test_DirectoryResolver(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "hostname"), []byte("dive\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("hostname", filepath.Join(root, "etc", "dangling-ok")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("does-not-exist", filepath.Join(root, "etc", "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(root, "etc", "hostname"), filepath.Join(root, "etc", "hostname.bak")); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := NewResolverFromDirectory(image.ResolverOptions{}).Fetch(context.Background(), root)
+	if err != nil {
+		t.Fatalf("unable to fetch image: %v", err)
+	}
+	if len(img.Layers) != 1 {
+		t.Fatalf("expected a single layer, got %d", len(img.Layers))
+	}
+	// the hard link is not counted twice
+	if img.Layers[0].Size != 5 {
+		t.Errorf("expected size=5, got %d", img.Layers[0].Size)
+	}
+
+	node, err := img.Trees[0].GetNode("/etc/hostname")
+	if err != nil {
+		t.Fatalf("unable to find file: %v", err)
+	}
+	if node.Data.FileInfo.Uid != os.Getuid() || node.Data.FileInfo.Gid != os.Getgid() {
+		t.Errorf("expected uid/gid=%d/%d, got %d/%d", os.Getuid(), os.Getgid(), node.Data.FileInfo.Uid, node.Data.FileInfo.Gid)
+	}
+
+	backup, err := img.Trees[0].GetNode("/etc/hostname.bak")
+	if err != nil {
+		t.Fatalf("unable to find hard link: %v", err)
+	}
+	if info := backup.Data.FileInfo; info.TypeFlag != tar.TypeLink || info.Linkname != "etc/hostname" || info.Hash() != node.Data.FileInfo.Hash() || node.Data.FileInfo.HardLinks != 1 {
+		t.Errorf("expected a hard link to /etc/hostname, got %+v", info)
+	}
+
+	link, err := img.Trees[0].GetNode("/etc/dangling")
+	if err != nil {
+		t.Fatalf("unable to find link: %v", err)
+	}
+	if link.Data.FileInfo.TypeFlag != tar.TypeSymlink || link.Data.FileInfo.Linkname != "does-not-exist" {
+		t.Errorf("unexpected link: %+v", link.Data.FileInfo)
+	}
+}
+
+func Test_DirectoryResolver_NotADirectory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewResolverFromDirectory(image.ResolverOptions{}).Fetch(context.Background(), file); err == nil {
+		t.Errorf("expected an error for a regular file")
+	}
+}
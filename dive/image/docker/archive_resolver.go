@@ -1,32 +1,90 @@
 package docker
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/wagoodman/dive/dive/image"
 )
 
-type archiveResolver struct{}
+// stdinPath is the archive path that reads the archive from stdin (e.g. "docker save app | dive docker-archive://-")
+const stdinPath = "-"
 
-func NewResolverFromArchive() *archiveResolver {
-	return &archiveResolver{}
+type archiveResolver struct {
+	options image.ResolverOptions
+	stdin   io.Reader
 }
 
-func (r *archiveResolver) Fetch(path string) (*image.Image, error) {
-	reader, err := os.Open(path)
+func NewResolverFromArchive(options image.ResolverOptions) *archiveResolver {
+	return &archiveResolver{
+		options: options,
+		stdin:   os.Stdin,
+	}
+}
+
+// Fetch reads a docker-archive tarball (or streams it from stdin when the path is "-"). When the archive holds several images one may be selected by its repo tag by
+// suffixing the path with "#<tag>", otherwise the first image in the archive is used.
+func (r *archiveResolver) Fetch(ctx context.Context, id string) (*image.Image, error) {
+	path, ref := splitReference(id)
+
+	img, err := r.load(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-	defer reader.Close()
+	if ref != "" {
+		if err := img.Select(ref); err != nil {
+			return nil, err
+		}
+	}
+	if err := img.CheckPlatform(r.options.Platform); err != nil {
+		return nil, err
+	}
+	return img.ToImage()
+}
+
+// FetchAll reads every image held by a docker-archive tarball.
+func (r *archiveResolver) FetchAll(ctx context.Context, id string) ([]*image.Image, error) {
+	path, ref := splitReference(id)
+	if ref != "" {
+		return nil, fmt.Errorf("cannot select an image (%q) when fetching all images of an archive", ref)
+	}
 
-	img, err := NewImageArchive(reader)
+	img, err := r.load(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-	return img.ToImage()
+	return img.ToImages()
+}
+
+func (r *archiveResolver) load(ctx context.Context, path string) (*ImageArchive, error) {
+	if path == stdinPath {
+		if f, ok := r.stdin.(*os.File); ok {
+			if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+				return nil, fmt.Errorf("refusing to read an image archive from a terminal (pipe an archive to stdin, e.g. 'docker save <image> | dive docker-archive://-')")
+			}
+		}
+		img, err := NewImageArchive(ctx, io.NopCloser(r.stdin))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read image archive from stdin: %w", err)
+		}
+		return img, nil
+	}
+
+	reader, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if info, err := reader.Stat(); err == nil {
+		image.ProgressTrackerFrom(ctx).SetBytesTotal(info.Size())
+	}
+
+	return NewImageArchive(ctx, reader)
 }
 
-func (r *archiveResolver) Build(args []string) (*image.Image, error) {
+func (r *archiveResolver) Build(ctx context.Context, args []string) (*image.Image, error) {
 	return nil, fmt.Errorf("build option not supported for docker archive resolver")
 }
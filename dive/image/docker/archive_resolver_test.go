@@ -0,0 +1,123 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+type testArchiveEntry struct {
+	header  *tar.Header
+	content []byte
+}
+
+// testRewriteArchive reads every entry of the given archive, lets the caller reorder/alter the entries, and returns
+// the resulting archive.
+func testRewriteArchive(t *testing.T, tarPath string, rewrite func([]testArchiveEntry) []testArchiveEntry) []byte {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatalf("unable to open archive: %v", err)
+	}
+	defer f.Close()
+
+	var entries []testArchiveEntry
+	reader := tar.NewReader(f)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to read archive: %v", err)
+		}
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("unable to read archive entry: %v", err)
+		}
+		entries = append(entries, testArchiveEntry{header: header, content: content})
+	}
+
+	return testTar(t, rewrite(entries))
+}
+
+// fetchFromStdin fetches the given archive content through a non-seekable reader standing in for stdin
+func fetchFromStdin(content []byte) (*image.Image, error) {
+	resolver := NewResolverFromArchive(image.ResolverOptions{})
+	resolver.stdin = io.MultiReader(bytes.NewReader(content))
+	return resolver.Fetch(context.Background(), stdinPath)
+}
+
+func Test_ArchiveResolver_Stdin(t *testing.T) {
+	table := map[string]func([]testArchiveEntry) []testArchiveEntry{
+		"as-saved": func(entries []testArchiveEntry) []testArchiveEntry {
+			return entries
+		},
+		"manifest-first": func(entries []testArchiveEntry) []testArchiveEntry {
+			var manifestFirst []testArchiveEntry
+			for _, entry := range entries {
+				if entry.header.Name == "manifest.json" {
+					manifestFirst = append([]testArchiveEntry{entry}, manifestFirst...)
+				} else {
+					manifestFirst = append(manifestFirst, entry)
+				}
+			}
+			return manifestFirst
+		},
+		"symlinked-layer": func(entries []testArchiveEntry) []testArchiveEntry {
+			// replace the first layer with a link to a copy of it, stored at the end of the archive
+			var linked []testArchiveEntry
+			var target testArchiveEntry
+			for _, entry := range entries {
+				if target.header == nil && strings.HasSuffix(entry.header.Name, "/layer.tar") {
+					target = testArchiveEntry{header: &tar.Header{Name: "shared/layer.tar", Mode: 0644, Typeflag: tar.TypeReg}, content: entry.content}
+					entry = testArchiveEntry{header: &tar.Header{Name: entry.header.Name, Linkname: "../shared/layer.tar", Typeflag: tar.TypeSymlink}}
+				}
+				linked = append(linked, entry)
+			}
+			return append(linked, target)
+		},
+	}
+
+	for name, rewrite := range table {
+		img, err := fetchFromStdin(testRewriteArchive(t, "../../../.data/test-docker-image.tar", rewrite))
+		if err != nil {
+			t.Fatalf("%s: unable to fetch image: %v", name, err)
+		}
+
+		result, err := img.Analyze()
+		if err != nil {
+			t.Fatalf("%s: unable to analyze: %v", name, err)
+		}
+		TestCheckAnalysis(t, name, result)
+	}
+}
+
+func Test_ArchiveResolver_StdinMissingLayer(t *testing.T) {
+	var missing string
+	content := testRewriteArchive(t, "../../../.data/test-docker-image.tar", func(entries []testArchiveEntry) []testArchiveEntry {
+		var kept []testArchiveEntry
+		for _, entry := range entries {
+			if missing == "" && strings.HasSuffix(entry.header.Name, "/layer.tar") {
+				missing = entry.header.Name
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		return kept
+	})
+
+	_, err := fetchFromStdin(content)
+	if err == nil {
+		t.Fatalf("expected an error for a missing layer")
+	}
+	expected := "image manifest references layer '" + missing + "' which is not present in the archive"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error to contain %q, got %q", expected, err.Error())
+	}
+}
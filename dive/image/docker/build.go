@@ -1,10 +1,11 @@
 package docker
 
 import (
+	"context"
 	"os"
 )
 
-func buildImageFromCli(buildArgs []string) (string, error) {
+func buildImageFromCli(ctx context.Context, buildArgs []string) (string, error) {
 	iidfile, err := os.CreateTemp("/tmp", "dive.*.iid")
 	if err != nil {
 		return "", err
@@ -12,7 +13,7 @@ func buildImageFromCli(buildArgs []string) (string, error) {
 	defer os.Remove(iidfile.Name())
 
 	allArgs := append([]string{"--iidfile", iidfile.Name()}, buildArgs...)
-	err = runDockerCmd("build", allArgs...)
+	err = runDockerCmd(ctx, "build", allArgs...)
 	if err != nil {
 		return "", err
 	}
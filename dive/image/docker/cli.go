@@ -1,24 +1,22 @@
 package docker
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 
 	"github.com/wagoodman/dive/utils"
 )
 
-// runDockerCmd runs a given Docker command in the current tty
-func runDockerCmd(cmdStr string, args ...string) error {
-	if !isDockerClientBinaryAvailable() {
-		return fmt.Errorf("cannot find docker client executable")
+// runDockerCmd runs a given Docker command in the current tty (the command is killed if the context is done first)
+func runDockerCmd(ctx context.Context, cmdStr string, args ...string) error {
+	cmd, err := dockerCmd(ctx, cmdStr, args...)
+	if err != nil {
+		return err
 	}
 
-	allArgs := utils.CleanArgs(append([]string{cmdStr}, args...))
-
-	cmd := exec.Command("docker", allArgs...)
-	cmd.Env = os.Environ()
-
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
@@ -26,6 +24,31 @@ func runDockerCmd(cmdStr string, args ...string) error {
 	return cmd.Run()
 }
 
+// runDockerCmdWithOutput runs a given Docker command non-interactively, writing all of its output to the given writer
+func runDockerCmdWithOutput(ctx context.Context, output io.Writer, cmdStr string, args ...string) error {
+	cmd, err := dockerCmd(ctx, cmdStr, args...)
+	if err != nil {
+		return err
+	}
+
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	return cmd.Run()
+}
+
+func dockerCmd(ctx context.Context, cmdStr string, args ...string) (*exec.Cmd, error) {
+	if !isDockerClientBinaryAvailable() {
+		return nil, fmt.Errorf("cannot find docker client executable")
+	}
+
+	allArgs := utils.CleanArgs(append([]string{cmdStr}, args...))
+
+	cmd := exec.CommandContext(ctx, "docker", allArgs...)
+	cmd.Env = os.Environ()
+	return cmd, nil
+}
+
 func isDockerClientBinaryAvailable() bool {
 	_, err := exec.LookPath("docker")
 	return err == nil
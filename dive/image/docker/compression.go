@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type compression string
+
+const (
+	uncompressed compression = ""
+	gzipped      compression = "gzip"
+	zstandard    compression = "zstd"
+	xzipped      compression = "xz"
+)
+
+var compressionMagic = []struct {
+	compression compression
+	magic       []byte
+}{
+	{compression: gzipped, magic: []byte{0x1f, 0x8b}},
+	{compression: zstandard, magic: []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{compression: xzipped, magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+// detectCompression identifies the compression of a stream from its leading (magic) bytes.
+func detectCompression(header []byte) compression {
+	for _, candidate := range compressionMagic {
+		if bytes.HasPrefix(header, candidate.magic) {
+			return candidate.compression
+		}
+	}
+	return uncompressed
+}
+
+// newDecompressedReader sniffs the compression of the given stream and transparently decompresses it (uncompressed
+// streams are passed through as-is). The stream is never seeked, so this is suitable for stdin.
+func newDecompressedReader(reader io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(reader)
+	// a short peek (e.g. an empty stream) simply means there are no magic bytes to match
+	header, _ := buffered.Peek(6)
+	return newDecompressor(detectCompression(header), buffered)
+}
+
+// newDecompressor wraps the given stream with a reader for the given compression.
+func newDecompressor(c compression, reader io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case gzipped:
+		return gzip.NewReader(reader)
+	case zstandard:
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case xzipped:
+		decoder, err := xz.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(decoder), nil
+	case uncompressed:
+		return io.NopCloser(reader), nil
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", c)
+}
@@ -0,0 +1,144 @@
+package docker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+func testCompress(t testing.TB, c compression, content []byte) []byte {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	var err error
+	switch c {
+	case uncompressed:
+		return content
+	case gzipped:
+		writer = gzip.NewWriter(&buf)
+	case zstandard:
+		writer, err = zstd.NewWriter(&buf)
+	case xzipped:
+		writer, err = xz.NewWriter(&buf)
+	default:
+		t.Fatalf("unknown compression: %q", c)
+	}
+	if err != nil {
+		t.Fatalf("unable to create %q writer: %v", c, err)
+	}
+	if _, err := writer.Write(content); err != nil {
+		t.Fatalf("unable to compress: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unable to compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func Test_DetectCompression(t *testing.T) {
+	content := []byte("some content that is long enough to compress")
+	for _, c := range []compression{uncompressed, gzipped, zstandard, xzipped} {
+		compressed := testCompress(t, c, content)
+		if actual := detectCompression(compressed); actual != c {
+			t.Errorf("expected %q, got %q", c, actual)
+		}
+
+		reader, err := newDecompressedReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("%q: unable to decompress: %v", c, err)
+		}
+		actual, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("%q: unable to decompress: %v", c, err)
+		}
+		reader.Close()
+		if !bytes.Equal(actual, content) {
+			t.Errorf("%q: unexpected content: %q", c, actual)
+		}
+	}
+
+	if actual := detectCompression(nil); actual != uncompressed {
+		t.Errorf("expected an empty stream to be uncompressed, got %q", actual)
+	}
+}
+
+func Test_ArchiveResolver_CompressedArchive(t *testing.T) {
+	content, err := os.ReadFile("../../../.data/test-docker-image.tar")
+	if err != nil {
+		t.Fatalf("unable to read archive: %v", err)
+	}
+
+	for _, c := range []compression{gzipped, zstandard, xzipped} {
+		compressed := testCompress(t, c, content)
+
+		path := filepath.Join(t.TempDir(), "image.tar."+string(c))
+		if err := os.WriteFile(path, compressed, 0644); err != nil {
+			t.Fatalf("unable to write archive: %v", err)
+		}
+
+		fromFile, err := NewResolverFromArchive(image.ResolverOptions{}).Fetch(context.Background(), path)
+		if err != nil {
+			t.Fatalf("%q: unable to fetch image: %v", c, err)
+		}
+		fromStdin, err := fetchFromStdin(compressed)
+		if err != nil {
+			t.Fatalf("%q: unable to fetch image from stdin: %v", c, err)
+		}
+
+		for _, img := range []*image.Image{fromFile, fromStdin} {
+			result, err := img.Analyze()
+			if err != nil {
+				t.Fatalf("%q: unable to analyze: %v", c, err)
+			}
+			TestCheckAnalysis(t, string(c), result)
+		}
+	}
+}
+
+func Test_ImageArchive_ZstdLayers(t *testing.T) {
+	// rename every layer to "<name>.tar.zst" and compress it accordingly
+	compressedSizes := make(map[string]uint64)
+	content := testRewriteArchive(t, "../../../.data/test-docker-image.tar", func(entries []testArchiveEntry) []testArchiveEntry {
+		for idx, entry := range entries {
+			if filepath.Ext(entry.header.Name) == ".tar" {
+				entries[idx].header.Name += ".zst"
+				entries[idx].content = testCompress(t, zstandard, entry.content)
+				compressedSizes[strings.Split(entry.header.Name, "/")[0]] = uint64(len(entries[idx].content))
+			}
+			if entry.header.Name == "manifest.json" {
+				entries[idx].content = bytes.ReplaceAll(entry.content, []byte(`layer.tar"`), []byte(`layer.tar.zst"`))
+			}
+		}
+		return entries
+	})
+
+	img, err := fetchFromStdin(content)
+	if err != nil {
+		t.Fatalf("unable to fetch image: %v", err)
+	}
+	result, err := img.Analyze()
+	if err != nil {
+		t.Fatalf("unable to analyze: %v", err)
+	}
+	TestCheckAnalysis(t, "", result)
+
+	var compressedSizeBytes uint64
+	for _, layer := range result.Layers {
+		if expected := compressedSizes[layer.Id]; layer.CompressedSize != expected {
+			t.Errorf("expected a compressed size of %d for layer %s, got %d", expected, layer.Id, layer.CompressedSize)
+		}
+		compressedSizeBytes += layer.CompressedSize
+	}
+	if compressedSizeBytes == 0 || result.CompressedSizeBytes != compressedSizeBytes {
+		t.Errorf("expected compressedSizeBytes=%d, got %d", compressedSizeBytes, result.CompressedSizeBytes)
+	}
+}
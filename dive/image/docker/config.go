@@ -2,13 +2,17 @@ package docker
 
 import (
 	"encoding/json"
+	"fmt"
 
-	"github.com/sirupsen/logrus"
+	"github.com/wagoodman/dive/dive/image"
 )
 
 type config struct {
-	History []historyEntry `json:"history"`
-	RootFs  rootFs         `json:"rootfs"`
+	History      []historyEntry `json:"history"`
+	RootFs       rootFs         `json:"rootfs"`
+	OS           string         `json:"os"`
+	Architecture string         `json:"architecture"`
+	Variant      string         `json:"variant"`
 }
 
 type rootFs struct {
@@ -25,16 +29,17 @@ type historyEntry struct {
 	EmptyLayer bool   `json:"empty_layer"`
 }
 
-func newConfig(configBytes []byte) config {
+func newConfig(configBytes []byte) (config, error) {
 	var imageConfig config
 	err := json.Unmarshal(configBytes, &imageConfig)
 	if err != nil {
-		logrus.Panic(err)
+		return imageConfig, fmt.Errorf("%w: %w", image.ErrInvalidConfig, err)
 	}
 
 	layerIdx := 0
 	for idx := range imageConfig.History {
-		if imageConfig.History[idx].EmptyLayer {
+		if imageConfig.History[idx].EmptyLayer || layerIdx >= len(imageConfig.RootFs.DiffIds) {
+			// note: history entries beyond the described layers are not expected, but are tolerated
 			imageConfig.History[idx].ID = "<missing>"
 		} else {
 			imageConfig.History[idx].ID = imageConfig.RootFs.DiffIds[layerIdx]
@@ -42,5 +47,5 @@ func newConfig(configBytes []byte) config {
 		}
 	}
 
-	return imageConfig
+	return imageConfig, nil
 }
@@ -0,0 +1,223 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/wagoodman/dive/utils"
+)
+
+const (
+	containerdDefaultNamespace = "default"
+	containerdContentDir       = "io.containerd.content.v1.content"
+	containerdMetadataDir      = "io.containerd.metadata.v1.bolt"
+	containerdMetadataFile     = "meta.db"
+)
+
+// containerdStore provides the images and blobs held by a containerd content store
+type containerdStore interface {
+	// image returns the descriptor of the manifest (or index) that the named image points to
+	image(ctx context.Context, namespace, name string) (ociDescriptor, error)
+	// open provides the contents of a blob given its digest
+	open(ctx context.Context, namespace, digest string) (io.ReadCloser, error)
+}
+
+// containerdDiskStore reads a containerd content store directly from disk (no running containerd is needed). Images
+// are looked up by name within the containerd metadata database, which lives next to the content directory.
+type containerdDiskStore struct {
+	contentDir   string
+	metadataPath string
+}
+
+// newContainerdDiskStore accepts either the containerd root directory (e.g. /var/lib/containerd) or its content
+// directory (e.g. /var/lib/containerd/io.containerd.content.v1.content).
+func newContainerdDiskStore(root string) containerdDiskStore {
+	contentDir := filepath.Join(root, containerdContentDir)
+	if _, err := os.Stat(filepath.Join(root, "blobs")); err == nil {
+		contentDir = root
+		root = filepath.Dir(root)
+	}
+	return containerdDiskStore{
+		contentDir:   contentDir,
+		metadataPath: filepath.Join(root, containerdMetadataDir, containerdMetadataFile),
+	}
+}
+
+func (s containerdDiskStore) open(_ context.Context, _, digest string) (io.ReadCloser, error) {
+	if err := validateDigest(digest); err != nil {
+		return nil, err
+	}
+	fields := strings.SplitN(digest, ":", 2)
+	reader, err := os.Open(filepath.Join(s.contentDir, "blobs", fields[0], fields[1]))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("blob %s is not present in the content store", digest)
+	}
+	return reader, err
+}
+
+func (s containerdDiskStore) image(_ context.Context, namespace, name string) (ociDescriptor, error) {
+	// containerd holds an exclusive lock on the database while running, so read from a snapshot of it instead
+	snapshot, err := snapshotFile(s.metadataPath)
+	if err != nil {
+		return ociDescriptor{}, fmt.Errorf("unable to read containerd metadata: %w", err)
+	}
+	defer os.Remove(snapshot)
+
+	db, err := bolt.Open(snapshot, 0400, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return ociDescriptor{}, fmt.Errorf("unable to open containerd metadata: %w", err)
+	}
+	defer db.Close()
+
+	var descriptor ociDescriptor
+	err = db.View(func(tx *bolt.Tx) error {
+		// the metadata layout is: v1/<namespace>/images/<name>/target/{digest,mediatype,size}
+		images := nestedBucket(tx, "v1", namespace, "images")
+		if images == nil {
+			return fmt.Errorf("namespace %q has no images", namespace)
+		}
+
+		var available []string
+		for _, candidate := range containerdImageNames(name) {
+			target := images.Bucket([]byte(candidate))
+			if target != nil {
+				target = target.Bucket([]byte("target"))
+			}
+			if target == nil {
+				continue
+			}
+			size, _ := binary.Varint(target.Get([]byte("size")))
+			descriptor = ociDescriptor{
+				MediaType: string(target.Get([]byte("mediatype"))),
+				Digest:    string(target.Get([]byte("digest"))),
+				Size:      size,
+			}
+			return nil
+		}
+
+		_ = images.ForEach(func(k, _ []byte) error {
+			available = append(available, string(k))
+			return nil
+		})
+		return fmt.Errorf("could not find image %q in namespace %q (available: %s)", name, namespace, strings.Join(available, ", "))
+	})
+	return descriptor, err
+}
+
+func nestedBucket(tx *bolt.Tx, names ...string) *bolt.Bucket {
+	bucket := tx.Bucket([]byte(names[0]))
+	for _, name := range names[1:] {
+		if bucket == nil {
+			return nil
+		}
+		bucket = bucket.Bucket([]byte(name))
+	}
+	return bucket
+}
+
+// snapshotFile copies the given file to a temporary file, returning its path
+func snapshotFile(path string) (string, error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+
+	snapshot, err := os.CreateTemp("", "dive-containerd-*.db")
+	if err != nil {
+		return "", err
+	}
+	defer snapshot.Close()
+
+	if _, err := io.Copy(snapshot, source); err != nil {
+		os.Remove(snapshot.Name())
+		return "", err
+	}
+	return snapshot.Name(), nil
+}
+
+// containerdImageNames lists the names an image may be stored under: the name as given, followed by its fully
+// qualified form (e.g. "alpine" is stored as "docker.io/library/alpine:latest" by nerdctl and the CRI plugin).
+func containerdImageNames(name string) []string {
+	names := []string{name}
+	if ref, err := parseRegistryReference(name); err == nil && ref.String() != name {
+		names = append(names, ref.String())
+	}
+	return names
+}
+
+// containerdCliStore reads the content store of a running containerd through the "ctr" client.
+type containerdCliStore struct {
+	address string
+}
+
+func (s containerdCliStore) command(ctx context.Context, namespace string, args ...string) (*exec.Cmd, error) {
+	if _, err := exec.LookPath("ctr"); err != nil {
+		return nil, fmt.Errorf("cannot find ctr client executable (needed to read images from a running containerd, use --containerd-root to read the content store from disk instead)")
+	}
+
+	allArgs := []string{"--namespace", namespace}
+	if s.address != "" {
+		allArgs = append(allArgs, "--address", s.address)
+	}
+
+	cmd := exec.CommandContext(ctx, "ctr", utils.CleanArgs(append(allArgs, args...))...)
+	cmd.Env = os.Environ()
+	return cmd, nil
+}
+
+func (s containerdCliStore) image(ctx context.Context, namespace, name string) (ociDescriptor, error) {
+	for _, candidate := range containerdImageNames(name) {
+		cmd, err := s.command(ctx, namespace, "images", "list", "name=="+candidate)
+		if err != nil {
+			return ociDescriptor{}, err
+		}
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return ociDescriptor{}, fmt.Errorf("unable to list containerd images: %s: %w", strings.TrimSpace(stderr.String()), err)
+		}
+		if descriptor, exists := parseCtrImageList(output, candidate); exists {
+			return descriptor, nil
+		}
+	}
+	return ociDescriptor{}, fmt.Errorf("could not find image %q in namespace %q", name, namespace)
+}
+
+func (s containerdCliStore) open(ctx context.Context, namespace, digest string) (io.ReadCloser, error) {
+	if err := validateDigest(digest); err != nil {
+		return nil, err
+	}
+	cmd, err := s.command(ctx, namespace, "content", "get", digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.NewCommandReader(cmd)
+}
+
+// parseCtrImageList finds the named image within the output of "ctr images list", which is a table of:
+// REF TYPE DIGEST SIZE PLATFORMS LABELS
+func parseCtrImageList(output []byte, name string) (ociDescriptor, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[0] != name {
+			continue
+		}
+		return ociDescriptor{MediaType: fields[1], Digest: fields[2]}, true
+	}
+	return ociDescriptor{}, false
+}
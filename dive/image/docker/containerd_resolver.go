@@ -0,0 +1,107 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+type containerdResolver struct {
+	options image.ResolverOptions
+}
+
+func NewResolverFromContainerd(options image.ResolverOptions) *containerdResolver {
+	return &containerdResolver{
+		options: options,
+	}
+}
+
+// Fetch reads the image manifest, config, and layers from the containerd content store, given "<namespace>/<ref>"
+// (the "default" namespace is used when none is given). The store is read from disk when a containerd root is
+// configured, otherwise from the running containerd through the "ctr" client.
+func (r *containerdResolver) Fetch(ctx context.Context, id string) (*image.Image, error) {
+	namespace, name := splitContainerdReference(id)
+
+	var store containerdStore = containerdCliStore{address: r.options.ContainerdCtrAddress}
+	if r.options.ContainerdRoot != "" {
+		store = newContainerdDiskStore(r.options.ContainerdRoot)
+	}
+
+	open := func(digest string) (io.ReadCloser, error) {
+		return store.open(ctx, namespace, digest)
+	}
+
+	var descriptor ociDescriptor
+	if strings.HasPrefix(name, "sha256:") {
+		descriptor = ociDescriptor{Digest: name}
+	} else {
+		var err error
+		descriptor, err = store.image(ctx, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	content, err := readBlob(open, descriptor.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("could not read image manifest: %w", err)
+	}
+
+	if descriptor.MediaType == "" {
+		// images referenced by digest carry no descriptor, but both manifests and indexes declare their media type
+		var header struct {
+			MediaType string `json:"mediaType"`
+		}
+		if err := json.Unmarshal(content, &header); err != nil {
+			return nil, fmt.Errorf("unable to parse image manifest: %w", err)
+		}
+		descriptor.MediaType = header.MediaType
+	}
+
+	if descriptor.isIndex() {
+		index, err := newOciIndex(content)
+		if err != nil {
+			return nil, err
+		}
+		descriptor, err = resolveManifestDescriptor(index, "", r.options.Platform, func(digest string) ([]byte, error) {
+			return readBlob(open, digest)
+		})
+		if err != nil {
+			return nil, err
+		}
+		content, err = readBlob(open, descriptor.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("could not read image manifest: %w", err)
+		}
+	}
+
+	m, err := newOciManifest(content)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := newImageArchiveFromManifest(ctx, m, open)
+	if err != nil {
+		return nil, err
+	}
+	if err := img.CheckPlatform(r.options.Platform); err != nil {
+		return nil, err
+	}
+	return img.ToImage()
+}
+
+func (r *containerdResolver) Build(ctx context.Context, args []string) (*image.Image, error) {
+	return nil, fmt.Errorf("build option not supported for containerd resolver")
+}
+
+// splitContainerdReference separates the leading namespace from the image reference (e.g. "k8s.io/nginx:1.25").
+func splitContainerdReference(id string) (string, string) {
+	if idx := strings.Index(id, "/"); idx >= 0 {
+		return id[:idx], id[idx+1:]
+	}
+	return containerdDefaultNamespace, id
+}
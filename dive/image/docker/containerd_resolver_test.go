@@ -0,0 +1,160 @@
+package docker
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+// testContainerdRoot lays out a containerd root directory (content store and metadata database) holding the given
+// docker-archive as a multi-platform image named "docker.io/library/dive-test:latest" in the "default" namespace.
+func testContainerdRoot(t *testing.T, tarPath string) (string, ociDescriptor) {
+	layoutRoot := testOciLayoutFromArchive(t, tarPath, "dive-test:latest")
+
+	root := t.TempDir()
+	contentDir := filepath.Join(root, containerdContentDir)
+	if err := os.MkdirAll(contentDir, 0755); err != nil {
+		t.Fatalf("unable to create content dir: %v", err)
+	}
+	if err := os.Rename(filepath.Join(layoutRoot, "blobs"), filepath.Join(contentDir, "blobs")); err != nil {
+		t.Fatalf("unable to move blobs: %v", err)
+	}
+
+	indexContent, err := os.ReadFile(filepath.Join(layoutRoot, "index.json"))
+	if err != nil {
+		t.Fatalf("unable to read index: %v", err)
+	}
+	layoutIndex, err := newOciIndex(indexContent)
+	if err != nil {
+		t.Fatalf("unable to parse index: %v", err)
+	}
+
+	manifestDescriptor := layoutIndex.Manifests[0]
+	manifestDescriptor.Annotations = nil
+	manifestDescriptor.Platform = &image.Platform{OS: "linux", Architecture: runtime.GOARCH}
+	imageIndex, err := json.Marshal(ociIndex{SchemaVersion: 2, MediaType: ociImageIndexMediaType, Manifests: []ociDescriptor{manifestDescriptor}})
+	if err != nil {
+		t.Fatalf("unable to marshal index: %v", err)
+	}
+	indexDescriptor := writeOciBlob(t, contentDir, ociImageIndexMediaType, imageIndex)
+
+	metadataDir := filepath.Join(root, containerdMetadataDir)
+	if err := os.MkdirAll(metadataDir, 0755); err != nil {
+		t.Fatalf("unable to create metadata dir: %v", err)
+	}
+	db, err := bolt.Open(filepath.Join(metadataDir, containerdMetadataFile), 0600, nil)
+	if err != nil {
+		t.Fatalf("unable to create metadata db: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("v1"))
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"default", "images", "docker.io/library/dive-test:latest", "target"} {
+			if bucket, err = bucket.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		size := make([]byte, binary.MaxVarintLen64)
+		size = size[:binary.PutVarint(size, indexDescriptor.Size)]
+		for key, value := range map[string][]byte{"digest": []byte(indexDescriptor.Digest), "mediatype": []byte(indexDescriptor.MediaType), "size": size} {
+			if err := bucket.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to write metadata: %v", err)
+	}
+
+	return root, manifestDescriptor
+}
+
+func Test_ContainerdResolver_Disk(t *testing.T) {
+	root, manifestDescriptor := testContainerdRoot(t, "../../../.data/test-docker-image.tar")
+
+	table := map[string]struct {
+		root string
+		id   string
+	}{
+		"short-name":      {root: root, id: "dive-test"},
+		"namespaced":      {root: root, id: "default/dive-test:latest"},
+		"qualified":       {root: root, id: "default/docker.io/library/dive-test:latest"},
+		"content-dir":     {root: filepath.Join(root, containerdContentDir), id: "default/dive-test:latest"},
+		"manifest-digest": {root: root, id: "default/" + manifestDescriptor.Digest},
+	}
+
+	for name, test := range table {
+		img, err := NewResolverFromContainerd(image.ResolverOptions{ContainerdRoot: test.root}).Fetch(context.Background(), test.id)
+		if err != nil {
+			t.Fatalf("%s: unable to fetch image: %v", name, err)
+		}
+
+		result, err := img.Analyze()
+		if err != nil {
+			t.Fatalf("%s: unable to analyze: %v", name, err)
+		}
+		TestCheckAnalysis(t, name, result)
+	}
+}
+
+func Test_ContainerdResolver_DiskUnknownImage(t *testing.T) {
+	root, _ := testContainerdRoot(t, "../../../.data/test-docker-image.tar")
+
+	_, err := NewResolverFromContainerd(image.ResolverOptions{ContainerdRoot: root}).Fetch(context.Background(), "default/nope:1.0")
+	if err == nil || !strings.Contains(err.Error(), "available: docker.io/library/dive-test:latest") {
+		t.Errorf("expected an error listing the available images, got %v", err)
+	}
+
+	_, err = NewResolverFromContainerd(image.ResolverOptions{ContainerdRoot: root}).Fetch(context.Background(), "k8s.io/dive-test")
+	if err == nil || !strings.Contains(err.Error(), `namespace "k8s.io" has no images`) {
+		t.Errorf("expected an error for an unknown namespace, got %v", err)
+	}
+}
+
+func Test_ParseCtrImageList(t *testing.T) {
+	output := []byte(`REF                                TYPE                                    DIGEST                                                                  SIZE    PLATFORMS   LABELS
+docker.io/library/alpine:3.18      application/vnd.oci.image.index.v1+json sha256:1111111111111111111111111111111111111111111111111111111111111111 3.3 MiB linux/amd64 -
+docker.io/library/alpine:latest    application/vnd.oci.image.index.v1+json sha256:2222222222222222222222222222222222222222222222222222222222222222 3.4 MiB linux/amd64 -
+`)
+
+	descriptor, exists := parseCtrImageList(output, "docker.io/library/alpine:latest")
+	if !exists {
+		t.Fatalf("expected to find the image")
+	}
+	expected := ociDescriptor{MediaType: ociImageIndexMediaType, Digest: "sha256:2222222222222222222222222222222222222222222222222222222222222222"}
+	if descriptor.MediaType != expected.MediaType || descriptor.Digest != expected.Digest {
+		t.Errorf("expected %+v, got %+v", expected, descriptor)
+	}
+
+	if _, exists := parseCtrImageList(output, "docker.io/library/alpine"); exists {
+		t.Errorf("expected a partial name not to match")
+	}
+}
+
+func Test_SplitContainerdReference(t *testing.T) {
+	table := map[string][2]string{
+		"alpine":                              {"default", "alpine"},
+		"default/alpine:3.18":                 {"default", "alpine:3.18"},
+		"k8s.io/docker.io/library/nginx:1.25": {"k8s.io", "docker.io/library/nginx:1.25"},
+	}
+	for id, expected := range table {
+		namespace, name := splitContainerdReference(id)
+		if namespace != expected[0] || name != expected[1] {
+			t.Errorf("%s: expected %v, got [%s %s]", id, expected, namespace, name)
+		}
+	}
+}
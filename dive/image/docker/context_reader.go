@@ -0,0 +1,20 @@
+package docker
+
+import (
+	"context"
+	"io"
+)
+
+// contextReader fails any read made after the given context is done, so that parsing a (possibly multi-GB) image
+// stream stops promptly when the fetch is cancelled.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
@@ -0,0 +1,148 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// dockerConfig is the subset of the docker CLI config (~/.docker/config.json) needed to authenticate with a registry
+type dockerConfig struct {
+	Auths       map[string]dockerAuthEntry `json:"auths"`
+	CredsStore  string                     `json:"credsStore"`
+	CredHelpers map[string]string          `json:"credHelpers"`
+}
+
+type dockerAuthEntry struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// registryCredentials are the username/password (or identity token) used to authenticate with a registry
+type registryCredentials struct {
+	Username      string
+	Password      string
+	IdentityToken string
+}
+
+func (c registryCredentials) isEmpty() bool {
+	return c.Username == "" && c.Password == "" && c.IdentityToken == ""
+}
+
+// dockerConfigPath returns the docker CLI config file location, honoring the DOCKER_CONFIG environment variable.
+func dockerConfigPath() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json"), nil
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".docker", "config.json"), nil
+}
+
+func loadDockerConfig() (*dockerConfig, error) {
+	path, err := dockerConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &dockerConfig{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var cfg dockerConfig
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse docker config (%s): %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// credentialsFor returns any credentials configured for the given registry host (e.g. "ghcr.io" or "docker.io").
+func (cfg *dockerConfig) credentialsFor(registry string) (registryCredentials, error) {
+	key := registry
+	if registry == dockerHubRegistry {
+		key = dockerHubAuthKey
+	}
+
+	if helper, exists := cfg.CredHelpers[registry]; exists {
+		return credentialsFromHelper(helper, key)
+	}
+	if cfg.CredsStore != "" {
+		return credentialsFromHelper(cfg.CredsStore, key)
+	}
+
+	for name, entry := range cfg.Auths {
+		if normalizeAuthKey(name) != normalizeAuthKey(key) {
+			continue
+		}
+		creds := registryCredentials{
+			Username:      entry.Username,
+			Password:      entry.Password,
+			IdentityToken: entry.IdentityToken,
+		}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return creds, fmt.Errorf("unable to decode auth for registry %q: %w", registry, err)
+			}
+			fields := strings.SplitN(string(decoded), ":", 2)
+			if len(fields) != 2 {
+				return creds, fmt.Errorf("invalid auth for registry %q", registry)
+			}
+			creds.Username, creds.Password = fields[0], fields[1]
+		}
+		return creds, nil
+	}
+	return registryCredentials{}, nil
+}
+
+// normalizeAuthKey strips the scheme and path from "auths" keys, which may be a bare host or a URL.
+func normalizeAuthKey(key string) string {
+	key = strings.TrimPrefix(key, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	return strings.SplitN(key, "/", 2)[0]
+}
+
+// credentialsFromHelper invokes a docker credential helper (docker-credential-<helper> get).
+func credentialsFromHelper(helper, serverURL string) (registryCredentials, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// helpers report missing credentials via a non-zero exit, which simply means anonymous access
+		if strings.Contains(stdout.String(), "credentials not found") {
+			return registryCredentials{}, nil
+		}
+		return registryCredentials{}, fmt.Errorf("credential helper %q failed: %w (%s)", helper, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var response struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return registryCredentials{}, fmt.Errorf("unable to parse credential helper %q response: %w", helper, err)
+	}
+
+	if response.Username == "<token>" {
+		return registryCredentials{IdentityToken: response.Secret}, nil
+	}
+	return registryCredentials{Username: response.Username, Password: response.Secret}, nil
+}
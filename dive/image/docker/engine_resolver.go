@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,46 +10,49 @@ import (
 
 	"github.com/docker/cli/cli/connhelper"
 	"github.com/docker/docker/client"
-	"golang.org/x/net/context"
 
 	"github.com/wagoodman/dive/dive/image"
 )
 
-type engineResolver struct{}
+type engineResolver struct {
+	options image.ResolverOptions
+}
 
-func NewResolverFromEngine() *engineResolver {
-	return &engineResolver{}
+func NewResolverFromEngine(options image.ResolverOptions) *engineResolver {
+	return &engineResolver{
+		options: options,
+	}
 }
 
-func (r *engineResolver) Fetch(id string) (*image.Image, error) {
-	reader, err := r.fetchArchive(id)
+func (r *engineResolver) Fetch(ctx context.Context, id string) (*image.Image, error) {
+	reader, err := r.fetchArchive(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	defer reader.Close()
 
-	img, err := NewImageArchive(reader)
+	img, err := NewImageArchive(ctx, reader)
 	if err != nil {
 		return nil, err
 	}
+	if err := img.CheckPlatform(r.options.Platform); err != nil {
+		return nil, err
+	}
 	return img.ToImage()
 }
 
-func (r *engineResolver) Build(args []string) (*image.Image, error) {
-	id, err := buildImageFromCli(args)
+func (r *engineResolver) Build(ctx context.Context, args []string) (*image.Image, error) {
+	id, err := buildImageFromCli(ctx, args)
 	if err != nil {
 		return nil, err
 	}
-	return r.Fetch(id)
+	return r.Fetch(ctx, id)
 }
 
-func (r *engineResolver) fetchArchive(id string) (io.ReadCloser, error) {
+func (r *engineResolver) fetchArchive(ctx context.Context, id string) (io.ReadCloser, error) {
 	var err error
 	var dockerClient *client.Client
 
-	// pull the engineResolver if it does not exist
-	ctx := context.Background()
-
 	host := os.Getenv("DOCKER_HOST")
 	var clientOpts []client.Opt
 
@@ -56,7 +60,7 @@ func (r *engineResolver) fetchArchive(id string) (io.ReadCloser, error) {
 	case "ssh":
 		helper, err := connhelper.GetConnectionHelper(host)
 		if err != nil {
-			fmt.Println("docker host", err)
+			return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
 		}
 		clientOpts = append(clientOpts, func(c *client.Client) error {
 			httpClient := &http.Client{
@@ -83,11 +87,18 @@ func (r *engineResolver) fetchArchive(id string) (io.ReadCloser, error) {
 	if err != nil {
 		return nil, err
 	}
-	_, _, err = dockerClient.ImageInspectWithRaw(ctx, id)
+	inspect, _, err := dockerClient.ImageInspectWithRaw(ctx, id)
+	platform := r.options.Platform
 	if err != nil {
 		// don't use the API, the CLI has more informative output
-		fmt.Println("Handler not available locally. Trying to pull '" + id + "'...")
-		err = runDockerCmd("pull", id)
+		fmt.Fprintln(r.options.OutputOrDiscard(), "Handler not available locally. Trying to pull '"+id+"'...")
+		err = r.pull(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+	} else if platform != nil && !platform.Matches(image.Platform{OS: inspect.Os, Architecture: inspect.Architecture, Variant: inspect.Variant}) {
+		fmt.Fprintln(r.options.OutputOrDiscard(), "Handler not available locally for platform "+platform.String()+". Trying to pull '"+id+"'...")
+		err = r.pull(ctx, id)
 		if err != nil {
 			return nil, err
 		}
@@ -100,3 +111,15 @@ func (r *engineResolver) fetchArchive(id string) (io.ReadCloser, error) {
 
 	return readCloser, nil
 }
+
+// pull fetches the image with the docker CLI, honoring any requested platform.
+func (r *engineResolver) pull(ctx context.Context, id string) error {
+	args := []string{id}
+	if r.options.Platform != nil {
+		args = []string{"--platform", r.options.Platform.String(), id}
+	}
+	if r.options.Interactive {
+		return runDockerCmd(ctx, "pull", args...)
+	}
+	return runDockerCmdWithOutput(ctx, r.options.OutputOrDiscard(), "pull", args...)
+}
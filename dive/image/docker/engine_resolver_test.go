@@ -0,0 +1,63 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+// testDockerCLI puts a fake docker CLI on the path, which prints the arguments it was run with.
+func testDockerCLI(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake docker CLI is a shell script")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"docker $*\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0755); err != nil {
+		t.Fatalf("unable to write fake docker CLI: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestEngineResolver_Pull(t *testing.T) {
+	testDockerCLI(t)
+
+	// the output of the pull is captured, unless the pull runs in the current tty
+	var output bytes.Buffer
+	platform := &image.Platform{OS: "linux", Architecture: "arm64"}
+	resolver := NewResolverFromEngine(image.ResolverOptions{Platform: platform, Output: &output})
+	if err := resolver.pull(context.Background(), "dive-test:latest"); err != nil {
+		t.Fatalf("unable to pull: %v", err)
+	}
+	if expected := "docker pull --platform linux/arm64 dive-test:latest\n"; output.String() != expected {
+		t.Errorf("expected the captured output %q, got %q", expected, output.String())
+	}
+
+	stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatalf("unable to create stdout: %v", err)
+	}
+	defer stdout.Close()
+	original := os.Stdout
+	os.Stdout = stdout
+	defer func() { os.Stdout = original }()
+
+	output.Reset()
+	resolver = NewResolverFromEngine(image.ResolverOptions{Output: &output, Interactive: true})
+	if err := resolver.pull(context.Background(), "dive-test:latest"); err != nil {
+		t.Fatalf("unable to pull: %v", err)
+	}
+	os.Stdout = original
+	attached, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatalf("unable to read stdout: %v", err)
+	}
+	if expected := "docker pull dive-test:latest\n"; string(attached) != expected || output.Len() != 0 {
+		t.Errorf("expected the pull to write %q to the tty only, got %q (and %q captured)", expected, attached, output.String())
+	}
+}
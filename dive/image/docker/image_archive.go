@@ -3,11 +3,11 @@ package docker
 import (
 	"archive/tar"
 	"bytes"
-	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os"
 	"path"
 	"strings"
 
@@ -15,23 +15,61 @@ import (
 	"github.com/wagoodman/dive/dive/image"
 )
 
+// ImageArchive holds every image found in an archive, along with the parsed layers of all of them. One image is
+// selected at a time (the first one by default), which is the image described by ToImage.
 type ImageArchive struct {
-	manifest manifest
-	config   config
-	layerMap map[string]*filetree.FileTree
+	manifest  manifest
+	config    config
+	manifests []manifest
+	configs   map[string]config
+	layerMap  map[string]*filetree.FileTree
+	// compressedSizes are the sizes of the compressed layer blobs by layer tree name (only known for compressed layers
+	// and for layers described by a manifest descriptor)
+	compressedSizes map[string]uint64
 }
 
-func NewImageArchive(tarFile io.ReadCloser) (*ImageArchive, error) {
+// NewImageArchive parses a docker-archive (as written by "docker save") from the given stream, which is abandoned
+// (with the context error) once the given context is done.
+func NewImageArchive(ctx context.Context, tarFile io.ReadCloser) (*ImageArchive, error) {
 	img := &ImageArchive{
-		layerMap: make(map[string]*filetree.FileTree),
+		configs:         make(map[string]config),
+		layerMap:        make(map[string]*filetree.FileTree),
+		compressedSizes: make(map[string]uint64),
 	}
 
-	tarReader := tar.NewReader(tarFile)
+	progress := image.ProgressTrackerFrom(ctx)
+	digests := image.FileDigestsFrom(ctx)
+
+	// the archive itself may be compressed (e.g. "docker save app | gzip > app.tar.gz")
+	archiveReader, err := newDecompressedReader(contextReader{ctx: ctx, reader: progress.Reader(tarFile)})
+	if err != nil {
+		return img, fmt.Errorf("could not decompress image archive: %w", err)
+	}
+	defer archiveReader.Close()
+
+	tarReader := tar.NewReader(archiveReader)
+
+	// layers are read from the archive in turn, but may be parsed concurrently (see layerPool)
+	layers := newLayerPool(ctx)
+	defer layers.close()
+
+	// addLayer adds a parsed layer to the image (with the size of the compressed layer blob, when compressed)
+	addLayer := func(compressedSize uint64) func(*filetree.FileTree) {
+		return func(tree *filetree.FileTree) {
+			img.layerMap[tree.Name] = tree
+			if compressedSize > 0 {
+				img.compressedSizes[tree.Name] = compressedSize
+			}
+		}
+	}
 
 	// store discovered json files in a map so we can read the image in one pass
 	jsonFiles := make(map[string][]byte)
 
-	var currentLayer uint
+	// some layer tars can be relative layer symlinks to other layer tars, which may appear later in the archive (the
+	// archive is read as a stream, so these are resolved once all entries have been read)
+	layerLinks := make(map[string]string)
+
 	for {
 		header, err := tarReader.Next()
 
@@ -40,45 +78,48 @@ func NewImageArchive(tarFile io.ReadCloser) (*ImageArchive, error) {
 		}
 
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			return img, fmt.Errorf("could not read image archive: %w", err)
 		}
 
 		name := header.Name
 
-		// some layer tars can be relative layer symlinks to other layer tars
-		if header.Typeflag == tar.TypeSymlink || header.Typeflag == tar.TypeReg {
+		if header.Typeflag == tar.TypeSymlink {
+			layerLinks[name] = path.Join(path.Dir(name), header.Linkname)
+			continue
+		}
+
+		if header.Typeflag == tar.TypeReg {
 			// For the Docker image format, use file name conventions
 			if strings.HasSuffix(name, ".tar") {
-				currentLayer++
-				layerReader := tar.NewReader(tarReader)
-				tree, err := processLayerTar(name, layerReader)
-				if err != nil {
-					return img, err
-				}
-
-				// add the layer to the image
-				img.layerMap[tree.Name] = tree
-			} else if strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, "tgz") {
-				currentLayer++
-
-				// Add gzip reader
-				gz, err := gzip.NewReader(tarReader)
+				err := layers.submit(tarReader, header.Size, layerJob{
+					name: name,
+					parse: func(reader io.Reader) (*filetree.FileTree, error) {
+						return processLayerTar(name, tar.NewReader(reader), digests)
+					},
+					parsed:       addLayer(0),
+					uncompressed: true,
+				})
 				if err != nil {
 					return img, err
 				}
-
-				// Add tar reader
-				layerReader := tar.NewReader(gz)
-
-				// Process layer
-				tree, err := processLayerTar(name, layerReader)
+			} else if strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, "tgz") || strings.HasSuffix(name, ".tar.zst") {
+				err := layers.submit(tarReader, header.Size, layerJob{
+					name: name,
+					parse: func(reader io.Reader) (*filetree.FileTree, error) {
+						// Add decompressing reader
+						decompressed, err := newDecompressedReader(reader)
+						if err != nil {
+							return nil, corruptLayer(name, err)
+						}
+						defer decompressed.Close()
+
+						return processLayerTar(name, tar.NewReader(decompressed), digests)
+					},
+					parsed: addLayer(uint64(header.Size)),
+				})
 				if err != nil {
 					return img, err
 				}
-
-				// add the layer to the image
-				img.layerMap[tree.Name] = tree
 			} else if strings.HasSuffix(name, ".json") || strings.HasPrefix(name, "sha256:") {
 				fileBuffer, err := io.ReadAll(tarReader)
 				if err != nil {
@@ -100,34 +141,49 @@ func NewImageArchive(tarFile io.ReadCloser) (*ImageArchive, error) {
 				if err != nil && err != io.ErrUnexpectedEOF {
 					return img, err
 				}
+				blob := io.MultiReader(bytes.NewReader(buffer[:n]), tarReader)
 
-				// Only try reading a TAR if file is "big enough"
-				if n == cap(buffer) {
-					var unwrappedReader io.Reader
-					unwrappedReader, err = gzip.NewReader(io.MultiReader(bytes.NewReader(buffer[:n]), tarReader))
-					if err != nil {
-						// Not a gzipped entry
-						unwrappedReader = io.MultiReader(bytes.NewReader(buffer[:n]), tarReader)
+				decoder := json.NewDecoder(bytes.NewReader(buffer[:n]))
+				token, err := decoder.Token()
+				_, isJSON := token.(json.Delim)
+				isJSON = isJSON && err == nil
+
+				// Only try reading a TAR if file is "big enough" (and is not JSON)
+				if n == cap(buffer) && !isJSON {
+					c := detectCompression(buffer[:n])
+					compressedSize := uint64(0)
+					if c != uncompressed {
+						compressedSize = uint64(header.Size)
 					}
-
-					// Try reading a TAR
-					layerReader := tar.NewReader(unwrappedReader)
-					tree, err := processLayerTar(name, layerReader)
-					if err == nil {
-						currentLayer++
-						// add the layer to the image
-						img.layerMap[tree.Name] = tree
-						continue
+					err := layers.submit(blob, header.Size, layerJob{
+						name: name,
+						parse: func(reader io.Reader) (*filetree.FileTree, error) {
+							unwrappedReader, err := newDecompressor(c, reader)
+							if err != nil {
+								// Not a valid compressed entry
+								unwrappedReader = io.NopCloser(reader)
+							}
+							defer unwrappedReader.Close()
+
+							// Try reading a TAR
+							return processLayerTar(name, tar.NewReader(unwrappedReader), digests)
+						},
+						parsed: addLayer(compressedSize),
+						// blobs that fail to parse are not layers after all
+						optional:     true,
+						uncompressed: c == uncompressed,
+					})
+					if err != nil {
+						return img, err
 					}
+					continue
 				}
 
 				// Not a TAR (or smaller than our buffer), might be a JSON file
-				decoder := json.NewDecoder(bytes.NewReader(buffer[:n]))
-				token, err := decoder.Token()
-				if _, ok := token.(json.Delim); err == nil && ok {
+				if isJSON {
 					// Looks like a JSON object (or array)
 					// XXX: should we add a header.Size check too?
-					fileBuffer, err := io.ReadAll(io.MultiReader(bytes.NewReader(buffer[:n]), tarReader))
+					fileBuffer, err := io.ReadAll(blob)
 					if err != nil {
 						return img, err
 					}
@@ -138,45 +194,107 @@ func NewImageArchive(tarFile io.ReadCloser) (*ImageArchive, error) {
 		}
 	}
 
+	// all layers have been read from the archive, wait for the remaining layers to be parsed
+	if err := layers.wait(); err != nil {
+		return img, err
+	}
+
+	resolveLayerLinks(img.layerMap, layerLinks)
+
 	manifestContent, exists := jsonFiles["manifest.json"]
 	if !exists {
-		return img, fmt.Errorf("could not find image manifest")
+		return img, image.ErrManifestNotFound
 	}
 
-	img.manifest = newManifest(manifestContent)
+	manifests, err := newManifests(manifestContent)
+	if err != nil {
+		return img, err
+	}
+	img.manifests = manifests
 
-	configContent, exists := jsonFiles[img.manifest.ConfigPath]
-	if !exists {
-		return img, fmt.Errorf("could not find image config")
+	for _, m := range img.manifests {
+		configContent, exists := jsonFiles[m.ConfigPath]
+		if !exists {
+			return img, fmt.Errorf("%w: '%s'", image.ErrConfigNotFound, m.ConfigPath)
+		}
+		imageConfig, err := newConfig(configContent)
+		if err != nil {
+			return img, err
+		}
+		img.configs[m.ConfigPath] = imageConfig
+
+		for _, layerPath := range m.LayerTarPaths {
+			if _, exists := img.layerMap[layerPath]; !exists {
+				if target, isLink := layerLinks[layerPath]; isLink {
+					return img, fmt.Errorf("%w: image manifest references layer '%s' which links to '%s', but that is not present in the archive", image.ErrLayerNotFound, layerPath, target)
+				}
+				return img, fmt.Errorf("%w: image manifest references layer '%s' which is not present in the archive", image.ErrLayerNotFound, layerPath)
+			}
+		}
 	}
 
-	img.config = newConfig(configContent)
+	img.selectManifest(img.manifests[0])
 
 	return img, nil
 }
 
-func processLayerTar(name string, reader *tar.Reader) (*filetree.FileTree, error) {
+// resolveLayerLinks registers symlinked layer tars under their own names, following chains of links.
+func resolveLayerLinks(layerMap map[string]*filetree.FileTree, layerLinks map[string]string) {
+	for name, target := range layerLinks {
+		// a chain longer than the number of links must contain a cycle
+		for hops := 0; hops <= len(layerLinks); hops++ {
+			next, isLink := layerLinks[target]
+			if !isLink {
+				break
+			}
+			target = next
+		}
+
+		tree, exists := layerMap[target]
+		if !exists {
+			// links to anything other than a parsed layer (e.g. a json file) are not interesting
+			continue
+		}
+		layerMap[name] = tree
+	}
+}
+
+// processLayerTar reads the given layer tar into a file tree, computing the given digest of every regular file. Any
+// error is a CorruptLayerError (unless the read was cancelled).
+func processLayerTar(name string, reader *tar.Reader, digests filetree.DigestAlgorithm) (*filetree.FileTree, error) {
 	tree := filetree.NewFileTree()
 	tree.Name = name
 
-	fileInfos, err := getFileList(reader)
+	fileInfos, err := getFileList(reader, digests)
 	if err != nil {
-		return nil, err
+		return nil, corruptLayer(name, err)
 	}
 
 	for _, element := range fileInfos {
 		tree.FileSize += uint64(element.Size)
+	}
+	filetree.KeepReplacedLinkTargets(fileInfos)
 
+	for _, element := range fileInfos {
 		_, _, err := tree.AddPath(element.Path, element)
 		if err != nil {
-			return nil, err
+			return nil, corruptLayer(name, err)
 		}
 	}
+	tree.ResolveHardLinks()
 
 	return tree, nil
 }
 
-func getFileList(tarReader *tar.Reader) ([]filetree.FileInfo, error) {
+// corruptLayer attributes an error reading a layer to that layer, unless the read was cancelled.
+func corruptLayer(name string, err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &image.CorruptLayerError{Path: name, Err: err}
+}
+
+func getFileList(tarReader *tar.Reader, digests filetree.DigestAlgorithm) ([]filetree.FileInfo, error) {
 	var files []filetree.FileInfo
 
 	for {
@@ -199,12 +317,78 @@ func getFileList(tarReader *tar.Reader) ([]filetree.FileInfo, error) {
 		case tar.TypeXHeader:
 			return nil, fmt.Errorf("unexptected tar file (XHeader): type=%v name=%s", header.Typeflag, name)
 		default:
-			files = append(files, filetree.NewFileInfoFromTarHeader(tarReader, header, name))
+			fileInfo, err := filetree.NewFileInfoFromTarHeaderWithDigest(tarReader, header, name, digests)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, fileInfo)
 		}
 	}
 	return files, nil
 }
 
+func (img *ImageArchive) selectManifest(m manifest) {
+	img.manifest = m
+	img.config = img.configs[m.ConfigPath]
+}
+
+// RepoTags returns the tags of every image in the archive (in the order the images were saved).
+func (img *ImageArchive) RepoTags() [][]string {
+	tags := make([][]string, 0, len(img.manifests))
+	for _, m := range img.manifests {
+		tags = append(tags, m.RepoTags)
+	}
+	return tags
+}
+
+// Select chooses the image with the given repo tag (e.g. "myapp:1.2") as the image described by the archive.
+func (img *ImageArchive) Select(ref string) error {
+	var available []string
+	for _, m := range img.manifests {
+		if m.hasRepoTag(ref) {
+			img.selectManifest(m)
+			return nil
+		}
+		available = append(available, m.RepoTags...)
+	}
+	return fmt.Errorf("could not find image %q in archive (available: %s)", ref, strings.Join(available, ", "))
+}
+
+// ToImages converts every image in the archive, regardless of which image is selected.
+func (img *ImageArchive) ToImages() ([]*image.Image, error) {
+	images := make([]*image.Image, 0, len(img.manifests))
+	for _, m := range img.manifests {
+		entry := *img
+		entry.selectManifest(m)
+		converted, err := entry.ToImage()
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, converted)
+	}
+	return images, nil
+}
+
+// Platform returns the platform the image was built for (as described by the image config).
+func (img *ImageArchive) Platform() image.Platform {
+	return image.Platform{
+		OS:           img.config.OS,
+		Architecture: img.config.Architecture,
+		Variant:      img.config.Variant,
+	}
+}
+
+// CheckPlatform ensures the image was built for the requested platform (if any was requested).
+func (img *ImageArchive) CheckPlatform(requested *image.Platform) error {
+	if requested == nil || img.config.OS == "" || img.config.Architecture == "" {
+		return nil
+	}
+	if !requested.Matches(img.Platform()) {
+		return fmt.Errorf("image platform %s does not match the requested platform %s", img.Platform(), requested)
+	}
+	return nil
+}
+
 func (img *ImageArchive) ToImage() (*image.Image, error) {
 	trees := make([]*filetree.FileTree, 0)
 
@@ -244,15 +428,17 @@ func (img *ImageArchive) ToImage() (*image.Image, error) {
 		historyObj.Size = tree.FileSize
 
 		dockerLayer := layer{
-			history: historyObj,
-			index:   idx,
-			tree:    tree,
+			history:        historyObj,
+			index:          idx,
+			tree:           tree,
+			compressedSize: img.compressedSizes[tree.Name],
 		}
 		layers = append(layers, dockerLayer.ToLayer())
 	}
 
 	return &image.Image{
-		Trees:  trees,
-		Layers: layers,
+		Trees:    trees,
+		Layers:   layers,
+		RepoTags: img.manifest.RepoTags,
 	}, nil
 }
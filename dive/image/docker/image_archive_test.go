@@ -0,0 +1,434 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wagoodman/dive/dive/filetree"
+	"github.com/wagoodman/dive/dive/image"
+)
+
+// testMultiImageArchive combines the given docker-archive tarballs into a single archive (as "docker save a b" would).
+func testMultiImageArchive(t *testing.T, tarPaths ...string) string {
+	path := filepath.Join(t.TempDir(), "bundle.tar")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unable to create archive: %v", err)
+	}
+	defer out.Close()
+
+	writer := tar.NewWriter(out)
+	var manifests []manifest
+	for _, tarPath := range tarPaths {
+		f, err := os.Open(tarPath)
+		if err != nil {
+			t.Fatalf("unable to open archive: %v", err)
+		}
+
+		reader := tar.NewReader(f)
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unable to read archive: %v", err)
+			}
+			if header.Name == "manifest.json" {
+				content, err := io.ReadAll(reader)
+				if err != nil {
+					t.Fatalf("unable to read manifest: %v", err)
+				}
+				entries, err := newManifests(content)
+				if err != nil {
+					t.Fatalf("unable to parse manifest: %v", err)
+				}
+				manifests = append(manifests, entries...)
+				continue
+			}
+			if err := writer.WriteHeader(header); err != nil {
+				t.Fatalf("unable to write archive: %v", err)
+			}
+			if _, err := io.Copy(writer, reader); err != nil {
+				t.Fatalf("unable to write archive: %v", err)
+			}
+		}
+		f.Close()
+	}
+
+	content, err := json.Marshal(manifests)
+	if err != nil {
+		t.Fatalf("unable to marshal manifest: %v", err)
+	}
+	if err := writer.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatalf("unable to write archive: %v", err)
+	}
+	if _, err := writer.Write(content); err != nil {
+		t.Fatalf("unable to write archive: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unable to write archive: %v", err)
+	}
+	return path
+}
+
+func Test_ImageArchive_MultipleImages(t *testing.T) {
+	path := testMultiImageArchive(t, "../../../.data/test-docker-image.tar", "../../../.data/test-kaniko-image.tar")
+
+	archive, err := TestLoadArchive(path)
+	if err != nil {
+		t.Fatalf("unable to load archive: %v", err)
+	}
+
+	expectedTags := [][]string{{"dive-test:latest"}, {"dive-test:kaniko-latest"}}
+	if !reflect.DeepEqual(archive.RepoTags(), expectedTags) {
+		t.Errorf("expected tags %v, got %v", expectedTags, archive.RepoTags())
+	}
+
+	images, err := archive.ToImages()
+	if err != nil {
+		t.Fatalf("unable to convert images: %v", err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(images))
+	}
+	if len(images[0].Layers) != 14 || !reflect.DeepEqual(images[0].RepoTags, expectedTags[0]) {
+		t.Errorf("unexpected first image: %d layers, tags %v", len(images[0].Layers), images[0].RepoTags)
+	}
+	if !reflect.DeepEqual(images[1].RepoTags, expectedTags[1]) {
+		t.Errorf("unexpected second image tags: %v", images[1].RepoTags)
+	}
+}
+
+func Test_ArchiveResolver_SelectImage(t *testing.T) {
+	path := testMultiImageArchive(t, "../../../.data/test-docker-image.tar", "../../../.data/test-kaniko-image.tar")
+	resolver := NewResolverFromArchive(image.ResolverOptions{})
+
+	table := map[string]struct {
+		id          string
+		expectedTag string
+		expectedErr string
+	}{
+		"default-first": {id: path, expectedTag: "dive-test:latest"},
+		"by-tag":        {id: path + "#dive-test:kaniko-latest", expectedTag: "dive-test:kaniko-latest"},
+		"implicit-hub":  {id: path + "#docker.io/library/dive-test:kaniko-latest", expectedTag: "dive-test:kaniko-latest"},
+		"implicit-tag":  {id: path + "#dive-test", expectedTag: "dive-test:latest"},
+		"unknown":       {id: path + "#nope:1.0", expectedErr: `could not find image "nope:1.0" in archive (available: dive-test:latest, dive-test:kaniko-latest)`},
+	}
+
+	for name, test := range table {
+		img, err := resolver.Fetch(context.Background(), test.id)
+		if test.expectedErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("%s: expected error %q, got %v", name, test.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(img.RepoTags, []string{test.expectedTag}) {
+			t.Errorf("%s: expected %q, got %v", name, test.expectedTag, img.RepoTags)
+		}
+	}
+
+	images, err := resolver.FetchAll(context.Background(), path)
+	if err != nil {
+		t.Fatalf("unable to fetch all images: %v", err)
+	}
+	if len(images) != 2 {
+		t.Errorf("expected 2 images, got %d", len(images))
+	}
+}
+
+func TestNewImageArchive_Cancelled(t *testing.T) {
+	f, err := os.Open("../../../.data/test-docker-image.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := NewImageArchive(ctx, f); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled error, got %v", err)
+	}
+
+	_, err = NewResolverFromOciLayout(image.ResolverOptions{}).Fetch(ctx, testOciLayoutFromArchive(t, "../../../.data/test-docker-image.tar", ""))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled error from the OCI layout, got %v", err)
+	}
+}
+
+func TestArchiveResolver_Progress(t *testing.T) {
+	path := "../../../.data/test-docker-image.tar"
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last image.Progress
+	ctx := image.WithProgressTracker(context.Background(), image.NewProgressTracker(func(p image.Progress) {
+		last = p
+	}))
+
+	if _, err := NewResolverFromArchive(image.ResolverOptions{}).Fetch(ctx, path); err != nil {
+		t.Fatalf("unable to fetch archive: %v", err)
+	}
+
+	expected := image.Progress{BytesRead: info.Size(), BytesTotal: info.Size(), Layers: 14}
+	if last != expected {
+		t.Errorf("expected progress %+v, got %+v", expected, last)
+	}
+}
+
+func TestNewImageArchive_Errors(t *testing.T) {
+	layer := testTar(t, []testArchiveEntry{
+		{header: &tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: &tar.Header{Name: "etc/hostname", Typeflag: tar.TypeReg, Mode: 0644}, content: []byte("dive\n")},
+	})
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":["sha256:aaaa"]},"history":[{"created_by":"COPY hostname /etc/"}]}`)
+	manifest := []byte(`[{"Config":"config.json","RepoTags":["dive-test:latest"],"Layers":["layer.tar"]}]`)
+
+	table := map[string]struct {
+		entries  []testArchiveEntry
+		expected error
+		layer    string
+	}{
+		"no-manifest": {
+			entries:  []testArchiveEntry{testEntry("config.json", config), testEntry("layer.tar", layer)},
+			expected: image.ErrManifestNotFound,
+		},
+		"invalid-manifest": {
+			entries:  []testArchiveEntry{testEntry("manifest.json", []byte(`{"Config"`)), testEntry("config.json", config), testEntry("layer.tar", layer)},
+			expected: image.ErrInvalidManifest,
+		},
+		"no-config": {
+			entries:  []testArchiveEntry{testEntry("manifest.json", manifest), testEntry("layer.tar", layer)},
+			expected: image.ErrConfigNotFound,
+		},
+		"invalid-config": {
+			entries:  []testArchiveEntry{testEntry("manifest.json", manifest), testEntry("config.json", []byte(`{"history":7}`)), testEntry("layer.tar", layer)},
+			expected: image.ErrInvalidConfig,
+		},
+		"no-layer": {
+			entries:  []testArchiveEntry{testEntry("manifest.json", manifest), testEntry("config.json", config)},
+			expected: image.ErrLayerNotFound,
+		},
+		"truncated-layer": {
+			entries:  []testArchiveEntry{testEntry("manifest.json", manifest), testEntry("config.json", config), testEntry("layer.tar", layer[:700])},
+			expected: image.ErrCorruptLayer,
+			layer:    "layer.tar",
+		},
+	}
+
+	for name, test := range table {
+		archive := testTar(t, test.entries)
+		_, err := NewImageArchive(context.Background(), io.NopCloser(bytes.NewReader(archive)))
+		if !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %q, got %v", name, test.expected, err)
+			continue
+		}
+
+		var layerErr *image.CorruptLayerError
+		if test.layer != "" && (!errors.As(err, &layerErr) || layerErr.Path != test.layer) {
+			t.Errorf("%s: expected a corrupt layer error for %q, got %v", name, test.layer, err)
+		}
+	}
+}
+
+func TestNewImageArchive_HardLinks(t *testing.T) {
+	binary := bytes.Repeat([]byte{0x7f}, 1000)
+	config := bytes.Repeat([]byte{0x3d}, 100)
+	// (tar readers report no size for a link, whatever the header was written with)
+	layer := testTar(t, []testArchiveEntry{
+		{header: &tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: &tar.Header{Name: "bin/busybox", Typeflag: tar.TypeReg, Mode: 0755}, content: binary},
+		{header: &tar.Header{Name: "bin/sh", Typeflag: tar.TypeLink, Linkname: "bin/busybox"}},
+		{header: &tar.Header{Name: "bin/ls", Typeflag: tar.TypeLink, Linkname: "bin/busybox"}},
+		{header: &tar.Header{Name: "bin/cat", Typeflag: tar.TypeLink, Linkname: "bin/busybox"}},
+		// a link to a file that is not within the layer
+		{header: &tar.Header{Name: "bin/missing", Typeflag: tar.TypeLink, Linkname: "bin/nothing"}},
+		// a link to a file that is replaced later in the same layer keeps the replaced contents
+		{header: &tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: &tar.Header{Name: "etc/app.conf", Typeflag: tar.TypeReg, Mode: 0644}, content: config},
+		{header: &tar.Header{Name: "etc/app.conf.orig", Typeflag: tar.TypeLink, Linkname: "etc/app.conf"}},
+		{header: &tar.Header{Name: "etc/app.conf", Typeflag: tar.TypeReg, Mode: 0644}, content: []byte("new\n")},
+	})
+	imageConfig := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":["sha256:aaaa"]},"history":[{"created_by":"ADD busybox /bin/"}]}`)
+	manifest := []byte(`[{"Config":"config.json","RepoTags":["dive-test:latest"],"Layers":["layer.tar"]}]`)
+
+	archive := testTar(t, []testArchiveEntry{testEntry("manifest.json", manifest), testEntry("config.json", imageConfig), testEntry("layer.tar", layer)})
+	img, err := NewImageArchive(image.WithFileDigests(context.Background(), filetree.DigestSHA256), io.NopCloser(bytes.NewReader(archive)))
+	if err != nil {
+		t.Fatalf("unable to read archive: %v", err)
+	}
+	converted, err := img.ToImage()
+	if err != nil {
+		t.Fatalf("unable to convert archive: %v", err)
+	}
+	tree := converted.Trees[0]
+	getNode := func(path string) *filetree.FileNode {
+		node, err := tree.GetNode(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return node
+	}
+
+	if size := converted.Layers[0].Size; size != 1104 {
+		t.Errorf("expected the linked binary to be counted once (1104 bytes), got %d", size)
+	}
+	busybox := getNode("/bin/busybox").Data.FileInfo
+	if busybox.HardLinks != 3 {
+		t.Errorf("expected 3 hard links to the binary, got %d", busybox.HardLinks)
+	}
+	for _, path := range []string{"/bin/sh", "/bin/ls", "/bin/cat"} {
+		link := getNode(path).Data.FileInfo
+		if link.Size != 0 || link.Hash() != busybox.Hash() || link.Digest != busybox.Digest || link.Digest == "" {
+			t.Errorf("expected %s to share the contents of the binary, got %+v", path, link)
+		}
+	}
+	if size := getNode("/bin").GetSize(); size != 1000 {
+		t.Errorf("expected /bin to be 1000 bytes, got %d", size)
+	}
+
+	missing := getNode("/bin/missing").Data.FileInfo
+	if missing.TypeFlag != tar.TypeLink || missing.Linkname != "bin/nothing" || missing.Digest != "" || missing.HardLinks != 0 {
+		t.Errorf("expected a link without a target to be left as-is, got %+v", missing)
+	}
+
+	conf, orig := getNode("/etc/app.conf").Data.FileInfo, getNode("/etc/app.conf.orig").Data.FileInfo
+	if conf.Size != 4 || conf.HardLinks != 0 {
+		t.Errorf("expected the replacing file to have no links, got %+v", conf)
+	}
+	if orig.TypeFlag != tar.TypeReg || orig.Size != 100 || orig.Hash() == conf.Hash() || orig.Digest == conf.Digest {
+		t.Errorf("expected the link to hold the replaced contents, got %+v", orig)
+	}
+	if size := getNode("/etc").GetSize(); size != 104 {
+		t.Errorf("expected /etc to be 104 bytes, got %d", size)
+	}
+}
+
+func TestNewImageArchive_FileDigests(t *testing.T) {
+	layer := testTar(t, []testArchiveEntry{
+		{header: &tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: &tar.Header{Name: "etc/hostname", Typeflag: tar.TypeReg, Mode: 0644}, content: []byte("dive\n")},
+		{header: &tar.Header{Name: "etc/host", Typeflag: tar.TypeLink, Linkname: "etc/hostname"}},
+	})
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":["sha256:aaaa"]},"history":[{"created_by":"COPY . /"}]}`)
+	manifest := []byte(`[{"Config":"config.json","RepoTags":["dive-test:latest"],"Layers":["layer.tar"]}]`)
+	archive := testTar(t, []testArchiveEntry{testEntry("manifest.json", manifest), testEntry("config.json", config), testEntry("layer.tar", layer)})
+
+	digests := func(ctx context.Context) map[string]string {
+		img, err := NewImageArchive(ctx, io.NopCloser(bytes.NewReader(archive)))
+		if err != nil {
+			t.Fatalf("unable to read archive: %v", err)
+		}
+		converted, err := img.ToImage()
+		if err != nil {
+			t.Fatalf("unable to convert archive: %v", err)
+		}
+		result := make(map[string]string)
+		for _, path := range []string{"/etc", "/etc/hostname", "/etc/host"} {
+			node, err := converted.Trees[0].GetNode(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result[path] = node.Data.FileInfo.Digest
+		}
+		return result
+	}
+
+	expected := map[string]string{
+		"/etc":          "",
+		"/etc/hostname": "sha256:2b25a828e41ea177224ae2dee24977e93f8f4953964a38e5dbf11742c5a0ef8f",
+		// hard links share the contents (and digest) of their target
+		"/etc/host": "sha256:2b25a828e41ea177224ae2dee24977e93f8f4953964a38e5dbf11742c5a0ef8f",
+	}
+	if actual := digests(image.WithFileDigests(context.Background(), filetree.DigestSHA256)); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("unexpected digests:\nexpected: %v\nactual:   %v", expected, actual)
+	}
+	for path, digest := range digests(context.Background()) {
+		if digest != "" {
+			t.Errorf("expected no digest for %s by default, got %q", path, digest)
+		}
+	}
+}
+
+// FuzzNewImageArchive ensures that malformed archives are reported as errors (rather than panicking).
+func FuzzNewImageArchive(f *testing.F) {
+	layer := testTar(f, []testArchiveEntry{
+		{header: &tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: &tar.Header{Name: "etc/hostname", Typeflag: tar.TypeReg, Mode: 0644}, content: []byte("dive\n")},
+		{header: &tar.Header{Name: "etc/host", Typeflag: tar.TypeLink, Linkname: "etc/hostname"}},
+		{header: &tar.Header{Name: "etc/motd", Typeflag: tar.TypeSymlink, Linkname: "/dev/null"}},
+		{header: &tar.Header{Name: "tmp/.wh.cache", Typeflag: tar.TypeReg}},
+	})
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":["sha256:aaaa"]},"history":[{"created_by":"COPY . /"},{"created_by":"CMD sh","empty_layer":true}]}`)
+	manifest := []byte(`[{"Config":"config.json","RepoTags":["dive-test:latest"],"Layers":["layer.tar","link.tar"]}]`)
+
+	archive := testTar(f, []testArchiveEntry{
+		testEntry("manifest.json", manifest),
+		testEntry("config.json", config),
+		testEntry("layer.tar", layer),
+		{header: &tar.Header{Name: "link.tar", Typeflag: tar.TypeSymlink, Linkname: "layer.tar"}},
+	})
+	f.Add(archive)
+	f.Add(testCompress(f, gzipped, archive))
+	f.Add(archive[:len(archive)/2])
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		img, err := NewImageArchive(context.Background(), io.NopCloser(bytes.NewReader(data)))
+		if err != nil {
+			return
+		}
+		images, err := img.ToImages()
+		if err != nil {
+			return
+		}
+		for _, converted := range images {
+			if _, err := converted.Analyze(); err != nil {
+				return
+			}
+		}
+	})
+}
+
+func testEntry(name string, content []byte) testArchiveEntry {
+	return testArchiveEntry{header: &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}, content: content}
+}
+
+// testTar writes the given entries as a tar archive. Hard links keep the size in their header (since they have no
+// contents, some tar writers record the size of the target).
+func testTar(t testing.TB, entries []testArchiveEntry) []byte {
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		if entry.header.Typeflag != tar.TypeLink {
+			entry.header.Size = int64(len(entry.content))
+		}
+		if err := writer.WriteHeader(entry.header); err != nil {
+			t.Fatalf("unable to write archive: %v", err)
+		}
+		if _, err := writer.Write(entry.content); err != nil {
+			t.Fatalf("unable to write archive: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unable to write archive: %v", err)
+	}
+	return buf.Bytes()
+}
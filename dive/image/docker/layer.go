@@ -12,17 +12,20 @@ type layer struct {
 	history historyEntry
 	index   int
 	tree    *filetree.FileTree
+	// compressedSize is the size of the compressed layer blob (zero when unknown)
+	compressedSize uint64
 }
 
 // String represents a layer in a columnar format.
 func (l *layer) ToLayer() *image.Layer {
 	id := strings.Split(l.tree.Name, "/")[0]
 	return &image.Layer{
-		Id:      id,
-		Index:   l.index,
-		Command: strings.TrimPrefix(l.history.CreatedBy, "/bin/sh -c "),
-		Size:    l.history.Size,
-		Tree:    l.tree,
+		Id:             id,
+		Index:          l.index,
+		Command:        strings.TrimPrefix(l.history.CreatedBy, "/bin/sh -c "),
+		Size:           l.history.Size,
+		CompressedSize: l.compressedSize,
+		Tree:           l.tree,
 		// todo: query docker api for tags
 		Names:  []string{"(unavailable)"},
 		Digest: l.history.ID,
@@ -0,0 +1,310 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wagoodman/dive/dive/filetree"
+	"github.com/wagoodman/dive/dive/image"
+)
+
+// layerSpoolMemoryLimit is the largest layer that is spooled in memory (larger layers are spooled to a temporary file)
+const layerSpoolMemoryLimit = 64 << 20
+
+// layerJob describes how to parse a single layer, and what to do with the parsed tree.
+type layerJob struct {
+	// name is the name of the layer tree (given to trees loaded from the layer cache)
+	name  string
+	parse func(io.Reader) (*filetree.FileTree, error)
+	// parsed is called with the parsed tree, in the order the layers were submitted
+	parsed func(*filetree.FileTree)
+	// optional layers that fail to parse are skipped rather than failing the whole image (e.g. blobs that only look
+	// like layers)
+	optional bool
+	// diffID is the digest of the layer contents read by parse, if known, which the tree is cached by (see
+	// image.LayerCache)
+	diffID string
+	// verified indicates the diffID has been computed from the contents read by parse (so they need not be hashed
+	// again to cache the tree)
+	verified bool
+	// uncompressed layers are read as the layer tar itself, so their DiffID may be computed while reading them
+	uncompressed bool
+	// size is the size of the layer blob as read (counted towards the progress when the layer is found in the cache
+	// instead), if known
+	size int64
+}
+
+type layerResult struct {
+	job  layerJob
+	tree *filetree.FileTree
+	err  error
+}
+
+// layerPool parses layers with a bounded number of workers. Layers may finish parsing in any order, however the
+// results are collected in the order the layers were submitted, so that the resulting image does not depend on the
+// scheduling of the workers.
+type layerPool struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	progress *image.ProgressTracker
+	cache    *image.LayerCache
+	digests  filetree.DigestAlgorithm
+	workers  chan struct{}
+	wg       sync.WaitGroup
+
+	lock    sync.Mutex
+	results []*layerResult
+	failed  bool
+
+	// collected records that the results have been passed on (and with which error)
+	collected bool
+	err       error
+}
+
+// newLayerPool creates a pool parsing as many layers at once as requested with the given context (see image.WithJobs),
+// with the layer cache of the context (see image.WithLayerCache).
+func newLayerPool(ctx context.Context) *layerPool {
+	ctx, cancel := context.WithCancel(ctx)
+	return &layerPool{
+		ctx:      ctx,
+		cancel:   cancel,
+		progress: image.ProgressTrackerFrom(ctx),
+		cache:    image.LayerCacheFrom(ctx),
+		digests:  image.FileDigestsFrom(ctx),
+		workers:  make(chan struct{}, image.JobsFrom(ctx)),
+	}
+}
+
+func (p *layerPool) sequential() bool {
+	return cap(p.workers) == 1
+}
+
+// submit parses the layer read from the given reader (of the given size) with the given job. With a single worker the
+// layer is parsed straight from the reader, otherwise the layer is spooled first (so that the caller may move on to
+// the next layer) and parsed by the next free worker. Uncompressed layers are always spooled when caching layers, as
+// their DiffID is only known once read. The error of the first failed layer is returned once any layer has failed.
+func (p *layerPool) submit(reader io.Reader, size int64, job layerJob) error {
+	if p.cache != nil && job.uncompressed {
+		digest := sha256.New()
+		spool, err := spoolLayer(io.TeeReader(reader, digest), size)
+		if err != nil {
+			return err
+		}
+		job.diffID = "sha256:" + hex.EncodeToString(digest.Sum(nil))
+		job.verified = true
+		if tree, cached := p.cache.Load(job.diffID, p.digests); cached {
+			if err := spool.Close(); err != nil {
+				logrus.Debugf("unable to remove layer spool: %v", err)
+			}
+			return p.add(job, tree)
+		}
+		return p.start(job, func() (io.ReadCloser, error) {
+			return spool, nil
+		})
+	}
+
+	if p.sequential() {
+		return p.start(job, func() (io.ReadCloser, error) {
+			return io.NopCloser(reader), nil
+		})
+	}
+
+	spool, err := spoolLayer(reader, size)
+	if err != nil {
+		return err
+	}
+	return p.start(job, func() (io.ReadCloser, error) {
+		return spool, nil
+	})
+}
+
+// submitBlob parses the layer opened with the given function with the given job, which is opened once a worker is
+// free (unless the layer is cached by the DiffID of the job). The error of the first failed layer is returned once any
+// layer has failed.
+func (p *layerPool) submitBlob(open func() (io.ReadCloser, error), job layerJob) error {
+	if p.cache != nil && job.diffID != "" {
+		if tree, cached := p.cache.Load(job.diffID, p.digests); cached {
+			p.progress.BytesSkipped(job.size)
+			return p.add(job, tree)
+		}
+	}
+	return p.start(job, open)
+}
+
+// add records the tree of the given job (loaded from the layer cache) as parsed.
+func (p *layerPool) add(job layerJob, tree *filetree.FileTree) error {
+	tree.Name = job.name
+	p.record(&layerResult{job: job, tree: tree})
+	p.progress.LayerParsed()
+	return p.check()
+}
+
+func (p *layerPool) record(result *layerResult) {
+	p.lock.Lock()
+	p.results = append(p.results, result)
+	p.lock.Unlock()
+}
+
+// check returns the error of the first failed layer once any layer has failed.
+func (p *layerPool) check() error {
+	p.lock.Lock()
+	failed := p.failed
+	p.lock.Unlock()
+	if failed {
+		return p.wait()
+	}
+	return nil
+}
+
+func (p *layerPool) start(job layerJob, open func() (io.ReadCloser, error)) error {
+	result := &layerResult{job: job}
+	p.record(result)
+
+	p.workers <- struct{}{}
+	p.wg.Add(1)
+	run := func() {
+		defer func() {
+			<-p.workers
+			p.wg.Done()
+		}()
+		p.parse(result, open)
+	}
+	if p.sequential() {
+		run()
+	} else {
+		go run()
+	}
+	return p.check()
+}
+
+func (p *layerPool) parse(result *layerResult, open func() (io.ReadCloser, error)) {
+	job := result.job
+	reader, err := open()
+	if err == nil {
+		var layerReader io.Reader = contextReader{ctx: p.ctx, reader: reader}
+		var digest hash.Hash
+		if p.cache != nil && job.diffID != "" && !job.verified {
+			// the layer is only cached by the given DiffID if the contents actually match it
+			digest = sha256.New()
+			layerReader = io.TeeReader(layerReader, digest)
+		}
+
+		result.tree, err = job.parse(layerReader)
+		if err == nil && p.cache != nil && job.diffID != "" {
+			p.store(job, result.tree, layerReader, digest)
+		}
+		if closeErr := reader.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	result.err = err
+
+	if err != nil {
+		if !result.job.optional {
+			p.lock.Lock()
+			p.failed = true
+			p.lock.Unlock()
+		}
+		return
+	}
+	p.progress.LayerParsed()
+}
+
+// store adds the tree parsed from the given (partially read) layer to the layer cache, if the layer contents match the
+// DiffID of the job (as hashed by the given digest, unless the DiffID of the job has been verified already). Failing to
+// cache a layer does not fail the layer.
+func (p *layerPool) store(job layerJob, tree *filetree.FileTree, remainder io.Reader, digest hash.Hash) {
+	if digest != nil {
+		// the layer tar may be followed by padding that was not read while parsing
+		if _, err := io.Copy(io.Discard, remainder); err != nil {
+			return
+		}
+		if actual := "sha256:" + hex.EncodeToString(digest.Sum(nil)); actual != job.diffID {
+			logrus.Debugf("not caching layer %s: contents have digest %s", job.diffID, actual)
+			return
+		}
+	}
+	if err := p.cache.Store(job.diffID, p.digests, tree); err != nil {
+		logrus.Warnf("unable to cache layer: %v", err)
+	}
+}
+
+// wait blocks until all submitted layers have been parsed, passing the parsed trees on in the order the layers were
+// submitted. The error of the first (submitted) layer that failed to parse is returned. Layers may not be submitted
+// once waited for.
+func (p *layerPool) wait() error {
+	p.wg.Wait()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.collected {
+		return p.err
+	}
+	p.collected = true
+
+	for _, result := range p.results {
+		if result.err != nil {
+			if result.job.optional {
+				continue
+			}
+			p.err = result.err
+			break
+		}
+		result.job.parsed(result.tree)
+	}
+	p.results = nil
+	return p.err
+}
+
+// close abandons any layers still being parsed (e.g. when reading the image failed), releasing their resources.
+func (p *layerPool) close() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// spooledLayer holds the contents of a layer read ahead of parsing, either in memory or in a temporary file (which is
+// removed on close).
+type spooledLayer struct {
+	io.Reader
+	file *os.File
+}
+
+// spoolLayer reads the layer (of the given size) from the given reader, so that it may be parsed later on.
+func spoolLayer(reader io.Reader, size int64) (*spooledLayer, error) {
+	if size <= layerSpoolMemoryLimit {
+		contents, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		return &spooledLayer{Reader: bytes.NewReader(contents)}, nil
+	}
+
+	file, err := os.CreateTemp("", "dive-layer-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	spool := &spooledLayer{Reader: file, file: file}
+	if _, err = io.Copy(file, reader); err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return nil, errors.Join(err, spool.Close())
+	}
+	return spool, nil
+}
+
+func (s *spooledLayer) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return errors.Join(s.file.Close(), os.Remove(s.file.Name()))
+}
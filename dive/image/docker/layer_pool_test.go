@@ -0,0 +1,270 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wagoodman/dive/dive/filetree"
+	"github.com/wagoodman/dive/dive/image"
+)
+
+func TestNewImageArchive_Jobs(t *testing.T) {
+	load := func(jobs int) (*image.Image, []string) {
+		f, err := os.Open("../../../.data/test-docker-image.tar")
+		if err != nil {
+			t.Fatalf("unable to open archive: %v", err)
+		}
+		defer f.Close()
+
+		archive, err := NewImageArchive(image.WithJobs(context.Background(), jobs), f)
+		if err != nil {
+			t.Fatalf("unable to read archive with %d jobs: %v", jobs, err)
+		}
+		img, err := archive.ToImage()
+		if err != nil {
+			t.Fatalf("unable to convert archive: %v", err)
+		}
+		var trees []string
+		for _, tree := range img.Trees {
+			trees = append(trees, tree.Name+"\n"+tree.String(true))
+		}
+		return img, trees
+	}
+
+	sequential, sequentialTrees := load(1)
+	parallel, parallelTrees := load(4)
+	if !reflect.DeepEqual(sequentialTrees, parallelTrees) {
+		t.Errorf("expected the same layer trees regardless of the number of jobs")
+	}
+	for idx := range sequential.Layers {
+		if sequential.Layers[idx].Size != parallel.Layers[idx].Size {
+			t.Errorf("layer %d: expected size %d, got %d", idx, sequential.Layers[idx].Size, parallel.Layers[idx].Size)
+		}
+	}
+}
+
+func TestLayerPool_Results(t *testing.T) {
+	errSlow := errors.New("slow layer is corrupt")
+	errFast := errors.New("fast layer is corrupt")
+
+	layer := func(name string, delay time.Duration, err error) func(io.Reader) (*filetree.FileTree, error) {
+		return func(io.Reader) (*filetree.FileTree, error) {
+			time.Sleep(delay)
+			if err != nil {
+				return nil, err
+			}
+			tree := filetree.NewFileTree()
+			tree.Name = name
+			return tree, nil
+		}
+	}
+
+	tests := map[string]struct {
+		layers   []layerJob
+		expected []string
+		err      error
+	}{
+		"in submitted order": {
+			layers: []layerJob{
+				{parse: layer("a", 30*time.Millisecond, nil)},
+				{parse: layer("b", 0, nil)},
+				{parse: layer("c", 10*time.Millisecond, nil)},
+			},
+			expected: []string{"a", "b", "c"},
+		},
+		"optional failures are skipped": {
+			layers: []layerJob{
+				{parse: layer("a", 0, nil)},
+				{parse: layer("b", 0, errFast), optional: true},
+				{parse: layer("c", 0, nil)},
+			},
+			expected: []string{"a", "c"},
+		},
+		"first submitted failure": {
+			layers: []layerJob{
+				{parse: layer("a", 0, nil)},
+				{parse: layer("b", 30*time.Millisecond, errSlow)},
+				{parse: layer("c", 0, errFast)},
+			},
+			err: errSlow,
+		},
+	}
+
+	for name, test := range tests {
+		for _, jobs := range []int{1, 4} {
+			var parsed []string
+			pool := newLayerPool(image.WithJobs(context.Background(), jobs))
+			for _, job := range test.layers {
+				job.parsed = func(tree *filetree.FileTree) {
+					parsed = append(parsed, tree.Name)
+				}
+				if err := pool.submit(strings.NewReader(""), 0, job); err != nil {
+					break
+				}
+			}
+			err := pool.wait()
+			pool.close()
+
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Errorf("%s (%d jobs): expected error %v, got %v", name, jobs, test.err, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s (%d jobs): unexpected error: %v", name, jobs, err)
+			}
+			if !reflect.DeepEqual(test.expected, parsed) {
+				t.Errorf("%s (%d jobs): expected layers %v, got %v", name, jobs, test.expected, parsed)
+			}
+		}
+	}
+}
+
+func TestSpoolLayer(t *testing.T) {
+	for name, size := range map[string]int64{"memory": 5, "file": layerSpoolMemoryLimit + 1} {
+		spool, err := spoolLayer(strings.NewReader("layer"), size)
+		if err != nil {
+			t.Fatalf("%s: unable to spool layer: %v", name, err)
+		}
+		contents, err := io.ReadAll(spool)
+		if err != nil || string(contents) != "layer" {
+			t.Errorf("%s: expected the spooled contents, got %q (%v)", name, contents, err)
+		}
+		if err := spool.Close(); err != nil {
+			t.Errorf("%s: unable to close spool: %v", name, err)
+		}
+		if spool.file != nil {
+			if _, err := os.Stat(spool.file.Name()); !os.IsNotExist(err) {
+				t.Errorf("%s: expected the spool file to be removed, got %v", name, err)
+			}
+		}
+	}
+}
+
+func TestNewImageArchive_LayerCache(t *testing.T) {
+	cache := image.NewLayerCache(t.TempDir())
+	load := func(ctx context.Context) []string {
+		f, err := os.Open("../../../.data/test-docker-image.tar")
+		if err != nil {
+			t.Fatalf("unable to open archive: %v", err)
+		}
+		defer f.Close()
+
+		archive, err := NewImageArchive(ctx, f)
+		if err != nil {
+			t.Fatalf("unable to read archive: %v", err)
+		}
+		img, err := archive.ToImage()
+		if err != nil {
+			t.Fatalf("unable to convert archive: %v", err)
+		}
+		var trees []string
+		for _, tree := range img.Trees {
+			trees = append(trees, tree.Name+"\n"+tree.String(true))
+		}
+		return trees
+	}
+
+	uncached := load(context.Background())
+	for _, jobs := range []int{1, 4} {
+		ctx := image.WithLayerCache(image.WithJobs(context.Background(), jobs), cache)
+		if trees := load(ctx); !reflect.DeepEqual(uncached, trees) {
+			t.Errorf("%d jobs: expected the same layer trees with the layer cache", jobs)
+		}
+	}
+
+	entries, err := cache.Entries()
+	if err != nil {
+		t.Fatalf("unable to list cache entries: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatalf("expected the layers to be cached")
+	}
+
+	// cached layers are no longer parsed
+	marker := filetree.NewFileTree()
+	if _, _, err := marker.AddPath("/cached", filetree.FileInfo{Path: "/cached"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Store(entries[0].DiffID, filetree.NoDigest, marker); err != nil {
+		t.Fatalf("unable to store tree: %v", err)
+	}
+	trees := load(image.WithLayerCache(context.Background(), cache))
+	if !strings.Contains(strings.Join(trees, "\n"), "cached") {
+		t.Errorf("expected a layer to be loaded from the cache")
+	}
+}
+
+func TestOciLayoutResolver_LayerCache(t *testing.T) {
+	root := testOciLayoutFromArchive(t, "../../../.data/test-docker-image.tar", "dive-test:latest")
+	ctx := image.WithLayerCache(context.Background(), image.NewLayerCache(t.TempDir()))
+
+	fetch := func() *image.AnalysisResult {
+		img, err := NewResolverFromOciLayout(image.ResolverOptions{}).Fetch(ctx, root)
+		if err != nil {
+			t.Fatalf("unable to fetch image: %v", err)
+		}
+		result, err := img.Analyze()
+		if err != nil {
+			t.Fatalf("unable to analyze: %v", err)
+		}
+		return result
+	}
+
+	expected := fetch()
+
+	// every layer is cached by the DiffID of the config, so the layer blobs are no longer read
+	m := ociLayoutManifest(t, root)
+	for _, layer := range m.Layers {
+		if err := os.Remove(ociBlobPath(root, layer.Digest)); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+	}
+
+	// the cached layers count towards the bytes read all the same
+	var progress image.Progress
+	ctx = image.WithProgressTracker(ctx, image.NewProgressTracker(func(p image.Progress) { progress = p }))
+	result := fetch()
+	if progress.BytesTotal == 0 || progress.BytesRead != progress.BytesTotal {
+		t.Errorf("expected every byte to be accounted for, got %d of %d", progress.BytesRead, progress.BytesTotal)
+	}
+	if result.SizeBytes != expected.SizeBytes || result.WastedBytes != expected.WastedBytes || len(result.Layers) != len(expected.Layers) {
+		t.Errorf("expected the same analysis from cached layers, got %d bytes (%d wasted) in %d layers",
+			result.SizeBytes, result.WastedBytes, len(result.Layers))
+	}
+}
+
+// ociLayoutManifest reads the manifest of the (single) image of the OCI image layout at the given root
+func ociLayoutManifest(t *testing.T, root string) ociManifest {
+	indexBytes, err := os.ReadFile(filepath.Join(root, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := newOciIndex(indexBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestBytes, err := os.ReadFile(ociBlobPath(root, index.Manifests[0].Digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := newOciManifest(manifestBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// ociBlobPath is the path of the blob with the given digest in the OCI image layout at the given root
+func ociBlobPath(root, digest string) string {
+	fields := strings.SplitN(digest, ":", 2)
+	return filepath.Join(root, "blobs", fields[0], fields[1])
+}
@@ -2,8 +2,10 @@ package docker
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 
-	"github.com/sirupsen/logrus"
+	"github.com/wagoodman/dive/dive/image"
 )
 
 type manifest struct {
@@ -12,11 +14,36 @@ type manifest struct {
 	LayerTarPaths []string `json:"Layers"`
 }
 
-func newManifest(manifestBytes []byte) manifest {
-	var manifest []manifest
-	err := json.Unmarshal(manifestBytes, &manifest)
+// newManifests parses a docker-archive manifest.json, which describes one entry per image saved in the archive.
+func newManifests(manifestBytes []byte) ([]manifest, error) {
+	var manifests []manifest
+	err := json.Unmarshal(manifestBytes, &manifests)
 	if err != nil {
-		logrus.Panic(err)
+		return nil, fmt.Errorf("%w: %w", image.ErrInvalidManifest, err)
 	}
-	return manifest[0]
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("%w: no images are described", image.ErrInvalidManifest)
+	}
+	return manifests, nil
+}
+
+// hasRepoTag indicates if the given reference names this image. References without a tag default to "latest" and
+// the implicit docker hub prefixes ("docker.io/", "docker.io/library/") are ignored.
+func (m manifest) hasRepoTag(ref string) bool {
+	ref = normalizeRepoTag(ref)
+	for _, tag := range m.RepoTags {
+		if normalizeRepoTag(tag) == ref {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeRepoTag(tag string) string {
+	tag = strings.TrimPrefix(tag, dockerHubRegistry+"/")
+	tag = strings.TrimPrefix(tag, "library/")
+	if !strings.Contains(tag[strings.LastIndex(tag, "/")+1:], ":") {
+		tag += ":latest"
+	}
+	return tag
 }
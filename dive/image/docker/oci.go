@@ -0,0 +1,313 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wagoodman/dive/dive/filetree"
+	"github.com/wagoodman/dive/dive/image"
+)
+
+const (
+	ociImageIndexMediaType      = "application/vnd.oci.image.index.v1+json"
+	dockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// ociDescriptor describes a content addressable blob (a manifest, config, or layer)
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *image.Platform   `json:"platform,omitempty"`
+}
+
+// ociIndex is an OCI image index (or a docker manifest list), which points to one or more manifests
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest is an OCI image manifest (or a docker v2 schema 2 manifest), which points to a config and layer blobs
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// blobOpener provides the contents of a blob given its digest
+type blobOpener func(digest string) (io.ReadCloser, error)
+
+func (d ociDescriptor) isIndex() bool {
+	return d.MediaType == ociImageIndexMediaType || d.MediaType == dockerManifestListMediaType
+}
+
+func newOciIndex(indexBytes []byte) (ociIndex, error) {
+	var index ociIndex
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return index, fmt.Errorf("unable to parse image index: %w", err)
+	}
+	return index, nil
+}
+
+func newOciManifest(manifestBytes []byte) (ociManifest, error) {
+	var m ociManifest
+	if err := json.Unmarshal(manifestBytes, &m); err != nil {
+		return m, fmt.Errorf("%w: %w", image.ErrInvalidManifest, err)
+	}
+	if m.Config.Digest == "" {
+		return m, fmt.Errorf("%w: no config descriptor", image.ErrInvalidManifest)
+	}
+	return m, nil
+}
+
+// validateDigest ensures the given digest is of the form "algorithm:encoded" and is safe to use as a path element.
+func validateDigest(digest string) error {
+	fields := strings.SplitN(digest, ":", 2)
+	if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+		return fmt.Errorf("invalid digest: %q", digest)
+	}
+	for _, field := range fields {
+		if strings.ContainsAny(field, `/\`) || strings.Contains(field, "..") {
+			return fmt.Errorf("invalid digest: %q", digest)
+		}
+	}
+	return nil
+}
+
+func readBlob(open blobOpener, digest string) ([]byte, error) {
+	reader, err := open(digest)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// resolveManifestDescriptor walks from the given index to a single image manifest descriptor, selecting entries by
+// reference name and platform and following any nested indexes (fetched by digest).
+func resolveManifestDescriptor(index ociIndex, ref string, platform *image.Platform, fetch func(digest string) ([]byte, error)) (ociDescriptor, error) {
+	descriptor, err := selectManifest(index, ref, platform)
+	if err != nil {
+		return descriptor, err
+	}
+
+	for descriptor.isIndex() {
+		content, err := fetch(descriptor.Digest)
+		if err != nil {
+			return descriptor, err
+		}
+		nestedIndex, err := newOciIndex(content)
+		if err != nil {
+			return descriptor, err
+		}
+		descriptor, err = selectManifest(nestedIndex, "", platform)
+		if err != nil {
+			return descriptor, err
+		}
+	}
+	return descriptor, nil
+}
+
+// selectManifest picks a manifest descriptor from the given index by reference name (if given) and then by platform
+// (the host platform if none is requested).
+func selectManifest(index ociIndex, ref string, platform *image.Platform) (ociDescriptor, error) {
+	if len(index.Manifests) == 0 {
+		return ociDescriptor{}, fmt.Errorf("image index has no manifests")
+	}
+
+	candidates := index.Manifests
+	if ref != "" {
+		candidates = nil
+		for _, descriptor := range index.Manifests {
+			name := descriptor.Annotations[ociRefNameAnnotation]
+			if name == ref || strings.HasSuffix(name, ":"+ref) {
+				candidates = append(candidates, descriptor)
+			}
+		}
+		if len(candidates) == 0 {
+			return ociDescriptor{}, fmt.Errorf("could not find image %q in index (available: %s)", ref, strings.Join(refNames(index), ", "))
+		}
+	}
+
+	if len(candidates) == 1 {
+		descriptor := candidates[0]
+		if platform != nil && descriptor.Platform != nil && !platform.Matches(*descriptor.Platform) {
+			return ociDescriptor{}, fmt.Errorf("no image found for platform %s (available: %s)", platform, descriptor.Platform)
+		}
+		return descriptor, nil
+	}
+
+	requested := image.DefaultPlatform()
+	if platform != nil {
+		requested = *platform
+	}
+
+	var available []string
+	for _, descriptor := range candidates {
+		if descriptor.Platform == nil {
+			continue
+		}
+		available = append(available, descriptor.Platform.String())
+		if requested.Matches(*descriptor.Platform) {
+			return descriptor, nil
+		}
+	}
+
+	if len(available) == 0 {
+		return ociDescriptor{}, fmt.Errorf("image index has %d manifests, select one with '#<ref>' (available: %s)", len(candidates), strings.Join(refNames(index), ", "))
+	}
+	return ociDescriptor{}, fmt.Errorf("no image found for platform %s (available: %s)", requested, strings.Join(available, ", "))
+}
+
+func refNames(index ociIndex) []string {
+	var names []string
+	for _, descriptor := range index.Manifests {
+		if name, exists := descriptor.Annotations[ociRefNameAnnotation]; exists {
+			names = append(names, name)
+		} else {
+			names = append(names, descriptor.Digest)
+		}
+	}
+	return names
+}
+
+// NewImageArchiveFromBlobs builds an ImageArchive from an image config and its uncompressed layer tarballs (from the
+// base layer up), each read by name with the given opener. This allows other image stores to reuse the docker
+// image handling.
+func NewImageArchiveFromBlobs(ctx context.Context, configName string, layerNames []string, open func(name string) (io.ReadCloser, error)) (*ImageArchive, error) {
+	m := ociManifest{
+		Config: ociDescriptor{Digest: configName},
+	}
+	for _, name := range layerNames {
+		m.Layers = append(m.Layers, ociDescriptor{Digest: name})
+	}
+	return newImageArchiveFromManifest(ctx, m, open)
+}
+
+// newImageArchiveFromManifest builds an ImageArchive by following the config and layer descriptors of the given
+// manifest, reading each blob by digest.
+func newImageArchiveFromManifest(ctx context.Context, m ociManifest, open blobOpener) (*ImageArchive, error) {
+	img := &ImageArchive{
+		configs:         make(map[string]config),
+		layerMap:        make(map[string]*filetree.FileTree),
+		compressedSizes: make(map[string]uint64),
+	}
+
+	configContent, err := readBlob(open, m.Config.Digest)
+	if err != nil {
+		return img, fmt.Errorf("%w: %w", image.ErrConfigNotFound, err)
+	}
+	img.config, err = newConfig(configContent)
+	if err != nil {
+		return img, err
+	}
+
+	progress := image.ProgressTrackerFrom(ctx)
+	progress.SetLayersTotal(len(m.Layers))
+	if total := layersSize(m); total > 0 {
+		progress.SetBytesTotal(total)
+	}
+
+	// the config describes the DiffIDs of the layers, which cached layers are found by (see image.LayerCache)
+	var diffIDs []string
+	if len(img.config.RootFs.DiffIds) == len(m.Layers) {
+		diffIDs = img.config.RootFs.DiffIds
+	}
+
+	// layers are parsed concurrently, but are added to the image in order
+	digests := image.FileDigestsFrom(ctx)
+	layers := newLayerPool(ctx)
+	defer layers.close()
+	for idx, descriptor := range m.Layers {
+		job := layerJob{
+			name: descriptor.Digest,
+			size: descriptor.Size,
+			parse: func(reader io.Reader) (*filetree.FileTree, error) {
+				return processLayerTar(descriptor.Digest, tar.NewReader(reader), digests)
+			},
+			parsed: func(tree *filetree.FileTree) {
+				img.layerMap[tree.Name] = tree
+				if descriptor.Size > 0 {
+					// the descriptor describes the blob as pulled (typically compressed)
+					img.compressedSizes[tree.Name] = uint64(descriptor.Size)
+				}
+				img.manifest.LayerTarPaths = append(img.manifest.LayerTarPaths, descriptor.Digest)
+			},
+		}
+		if diffIDs != nil {
+			job.diffID = diffIDs[idx]
+		}
+		err := layers.submitBlob(func() (io.ReadCloser, error) {
+			return openLayerBlob(ctx, descriptor, open)
+		}, job)
+		if err != nil {
+			return img, err
+		}
+	}
+	if err := layers.wait(); err != nil {
+		return img, err
+	}
+	img.manifest.ConfigPath = m.Config.Digest
+	img.manifests = []manifest{img.manifest}
+	img.configs[m.Config.Digest] = img.config
+
+	return img, nil
+}
+
+// layersSize is the total size of the layer blobs of the given manifest (zero if any layer size is unknown).
+func layersSize(m ociManifest) int64 {
+	var total int64
+	for _, descriptor := range m.Layers {
+		if descriptor.Size <= 0 {
+			return 0
+		}
+		total += descriptor.Size
+	}
+	return total
+}
+
+// openLayerBlob opens the (decompressed) contents of the layer blob with the given descriptor.
+func openLayerBlob(ctx context.Context, descriptor ociDescriptor, open blobOpener) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	reader, err := open(descriptor.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	c := uncompressed
+	switch {
+	case strings.HasSuffix(descriptor.MediaType, "gzip"):
+		c = gzipped
+	case strings.HasSuffix(descriptor.MediaType, "zstd"):
+		c = zstandard
+	}
+
+	layerReader, err := newDecompressor(c, contextReader{ctx: ctx, reader: image.ProgressTrackerFrom(ctx).Reader(reader)})
+	if err != nil {
+		reader.Close()
+		return nil, corruptLayer(descriptor.Digest, fmt.Errorf("unable to decompress layer: %w", err))
+	}
+	return layerBlobReader{ReadCloser: layerReader, blob: reader}, nil
+}
+
+// layerBlobReader reads the decompressed contents of a layer blob, closing the blob along with the decompressor.
+type layerBlobReader struct {
+	io.ReadCloser
+	blob io.Closer
+}
+
+func (r layerBlobReader) Close() error {
+	return errors.Join(r.ReadCloser.Close(), r.blob.Close())
+}
@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+type ociLayoutResolver struct {
+	options image.ResolverOptions
+}
+
+func NewResolverFromOciLayout(options image.ResolverOptions) *ociLayoutResolver {
+	return &ociLayoutResolver{
+		options: options,
+	}
+}
+
+// Fetch reads an OCI image layout directory (index.json + blobs/<alg>/<encoded>). An image within the layout may
+// be selected by its "org.opencontainers.image.ref.name" annotation by suffixing the path with "#<ref>", and a
+// multi-platform image is narrowed down by the requested platform.
+func (r *ociLayoutResolver) Fetch(ctx context.Context, id string) (*image.Image, error) {
+	root, ref := splitReference(id)
+
+	open := func(digest string) (io.ReadCloser, error) {
+		if err := validateDigest(digest); err != nil {
+			return nil, err
+		}
+		fields := strings.SplitN(digest, ":", 2)
+		return os.Open(filepath.Join(root, "blobs", fields[0], fields[1]))
+	}
+
+	indexContent, err := os.ReadFile(filepath.Join(root, "index.json"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read OCI layout index: %w", err)
+	}
+
+	index, err := newOciIndex(indexContent)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor, err := resolveManifestDescriptor(index, ref, r.options.Platform, func(digest string) ([]byte, error) {
+		return readBlob(open, digest)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	manifestContent, err := readBlob(open, descriptor.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("could not read image manifest: %w", err)
+	}
+
+	m, err := newOciManifest(manifestContent)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := newImageArchiveFromManifest(ctx, m, open)
+	if err != nil {
+		return nil, err
+	}
+	if err := img.CheckPlatform(r.options.Platform); err != nil {
+		return nil, err
+	}
+	return img.ToImage()
+}
+
+func (r *ociLayoutResolver) Build(ctx context.Context, args []string) (*image.Image, error) {
+	return nil, fmt.Errorf("build option not supported for OCI layout resolver")
+}
+
+// splitReference separates an optional "#<ref>" suffix from the given path.
+func splitReference(id string) (string, string) {
+	if idx := strings.LastIndex(id, "#"); idx >= 0 {
+		return id[:idx], id[idx+1:]
+	}
+	return id, ""
+}
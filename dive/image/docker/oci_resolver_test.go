@@ -0,0 +1,235 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+// writeOciBlob stores the given content under blobs/sha256 and returns a descriptor for it
+func writeOciBlob(t *testing.T, root, mediaType string, content []byte) ociDescriptor {
+	digest := fmt.Sprintf("%x", sha256.Sum256(content))
+	blobDir := filepath.Join(root, "blobs", "sha256")
+	if err := os.MkdirAll(blobDir, 0755); err != nil {
+		t.Fatalf("unable to create blob dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(blobDir, digest), content, 0644); err != nil {
+		t.Fatalf("unable to write blob: %v", err)
+	}
+	return ociDescriptor{
+		MediaType: mediaType,
+		Digest:    "sha256:" + digest,
+		Size:      int64(len(content)),
+	}
+}
+
+// testOciLayoutFromArchive converts a docker-archive tarball into an OCI image layout directory (with gzipped layers).
+func testOciLayoutFromArchive(t *testing.T, tarPath, refName string) string {
+	return testOciLayoutFromArchiveWithCompression(t, tarPath, refName, gzipped)
+}
+
+// testOciLayoutFromArchiveWithCompression converts a docker-archive tarball into an OCI image layout directory, with
+// layers compressed as given.
+func testOciLayoutFromArchiveWithCompression(t *testing.T, tarPath, refName string, c compression) string {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatalf("unable to open archive: %v", err)
+	}
+	defer f.Close()
+
+	files := make(map[string][]byte)
+	tarReader := tar.NewReader(f)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to read archive: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			t.Fatalf("unable to read archive entry: %v", err)
+		}
+		files[header.Name] = content
+	}
+
+	archiveManifests, err := newManifests(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("unable to parse manifest: %v", err)
+	}
+	archiveManifest := archiveManifests[0]
+
+	root := t.TempDir()
+	m := ociManifest{
+		SchemaVersion: 2,
+		Config:        writeOciBlob(t, root, "application/vnd.oci.image.config.v1+json", files[archiveManifest.ConfigPath]),
+	}
+
+	mediaType := "application/vnd.oci.image.layer.v1.tar"
+	if c != uncompressed {
+		mediaType += "+" + string(c)
+	}
+	for _, layerPath := range archiveManifest.LayerTarPaths {
+		m.Layers = append(m.Layers, writeOciBlob(t, root, mediaType, testCompress(t, c, files[layerPath])))
+	}
+
+	manifestBytes, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("unable to marshal manifest: %v", err)
+	}
+	manifestDescriptor := writeOciBlob(t, root, "application/vnd.oci.image.manifest.v1+json", manifestBytes)
+	manifestDescriptor.Annotations = map[string]string{ociRefNameAnnotation: refName}
+
+	indexBytes, err := json.Marshal(ociIndex{SchemaVersion: 2, Manifests: []ociDescriptor{manifestDescriptor}})
+	if err != nil {
+		t.Fatalf("unable to marshal index: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "index.json"), indexBytes, 0644); err != nil {
+		t.Fatalf("unable to write index: %v", err)
+	}
+
+	return root
+}
+
+func Test_OciLayoutResolver(t *testing.T) {
+	root := testOciLayoutFromArchive(t, "../../../.data/test-docker-image.tar", "dive-test:latest")
+
+	for _, id := range []string{root, root + "#latest", root + "#dive-test:latest"} {
+		img, err := NewResolverFromOciLayout(image.ResolverOptions{}).Fetch(context.Background(), id)
+		if err != nil {
+			t.Fatalf("%s: unable to fetch image: %v", id, err)
+		}
+
+		result, err := img.Analyze()
+		if err != nil {
+			t.Fatalf("%s: unable to analyze: %v", id, err)
+		}
+		TestCheckAnalysis(t, id, result)
+		if result.Layers[13].Command != "chmod +x /root/saved.txt" {
+			t.Errorf("%s: unexpected command for last layer: %q", id, result.Layers[13].Command)
+		}
+	}
+}
+
+func Test_OciLayoutResolver_LayerCompression(t *testing.T) {
+	for _, c := range []compression{uncompressed, gzipped, zstandard} {
+		root := testOciLayoutFromArchiveWithCompression(t, "../../../.data/test-docker-image.tar", "dive-test:latest", c)
+
+		img, err := NewResolverFromOciLayout(image.ResolverOptions{}).Fetch(context.Background(), root)
+		if err != nil {
+			t.Fatalf("%q: unable to fetch image: %v", c, err)
+		}
+
+		result, err := img.Analyze()
+		if err != nil {
+			t.Fatalf("%q: unable to analyze: %v", c, err)
+		}
+		TestCheckAnalysis(t, string(c), result)
+
+		// the compressed size is taken from the layer descriptors
+		for _, layer := range result.Layers {
+			if layer.CompressedSize == 0 {
+				t.Errorf("%q: expected a compressed size for layer %d", c, layer.Index)
+			}
+		}
+		if c != uncompressed && result.CompressedSizeBytes >= result.SizeBytes {
+			t.Errorf("%q: expected compressedSizeBytes=%d to be less than sizeBytes=%d", c, result.CompressedSizeBytes, result.SizeBytes)
+		}
+	}
+}
+
+func Test_OciLayoutResolver_UnknownRef(t *testing.T) {
+	root := testOciLayoutFromArchive(t, "../../../.data/test-docker-image.tar", "dive-test:latest")
+
+	_, err := NewResolverFromOciLayout(image.ResolverOptions{}).Fetch(context.Background(), root+"#nope")
+	if err == nil {
+		t.Fatalf("expected an error for an unknown reference")
+	}
+}
+
+func Test_ValidateDigest(t *testing.T) {
+	table := map[string]bool{
+		"sha256:abcdef":        true,
+		"sha256:":              false,
+		"abcdef":               false,
+		"sha256:../../etc":     false,
+		"sha256:abc/def":       false,
+		"../sha256:abcdef0123": false,
+	}
+
+	for digest, valid := range table {
+		err := validateDigest(digest)
+		if valid && err != nil {
+			t.Errorf("expected %q to be valid: %v", digest, err)
+		} else if !valid && err == nil {
+			t.Errorf("expected %q to be invalid", digest)
+		}
+	}
+}
+
+func Test_SelectManifest(t *testing.T) {
+	index := ociIndex{
+		Manifests: []ociDescriptor{
+			{Digest: "sha256:amd64", Platform: &image.Platform{OS: "linux", Architecture: "amd64"}},
+			{Digest: "sha256:armv6", Platform: &image.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}},
+			{Digest: "sha256:armv7", Platform: &image.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+			{Digest: "sha256:attestation", Platform: &image.Platform{OS: "unknown", Architecture: "unknown"}},
+		},
+	}
+
+	table := map[string]struct {
+		platform       image.Platform
+		expectedDigest string
+		expectedErr    string
+	}{
+		"exact":         {platform: image.Platform{OS: "linux", Architecture: "amd64"}, expectedDigest: "sha256:amd64"},
+		"variant":       {platform: image.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, expectedDigest: "sha256:armv7"},
+		"any-variant":   {platform: image.Platform{OS: "linux", Architecture: "arm"}, expectedDigest: "sha256:armv6"},
+		"no-match":      {platform: image.Platform{OS: "linux", Architecture: "riscv64"}, expectedErr: "no image found for platform linux/riscv64 (available: linux/amd64, linux/arm/v6, linux/arm/v7, unknown/unknown)"},
+		"wrong-variant": {platform: image.Platform{OS: "linux", Architecture: "arm", Variant: "v5"}, expectedErr: "no image found for platform linux/arm/v5"},
+	}
+
+	for name, test := range table {
+		platform := test.platform
+		descriptor, err := selectManifest(index, "", &platform)
+		if test.expectedErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("%s: expected error %q, got %v", name, test.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if descriptor.Digest != test.expectedDigest {
+			t.Errorf("%s: expected digest %q, got %q", name, test.expectedDigest, descriptor.Digest)
+		}
+	}
+}
+
+func Test_OciLayoutResolver_PlatformMismatch(t *testing.T) {
+	root := testOciLayoutFromArchive(t, "../../../.data/test-docker-image.tar", "dive-test:latest")
+
+	platform := image.Platform{OS: "windows", Architecture: "amd64"}
+	_, err := NewResolverFromOciLayout(image.ResolverOptions{Platform: &platform}).Fetch(context.Background(), root)
+	if err == nil {
+		t.Fatalf("expected an error for a platform mismatch")
+	}
+	if !strings.Contains(err.Error(), "does not match the requested platform windows/amd64") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
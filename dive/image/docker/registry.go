@@ -0,0 +1,415 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	dockerHubRegistry    = "docker.io"
+	dockerHubAPIRegistry = "registry-1.docker.io"
+
+	ociImageManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestMediaType   = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// manifestMediaTypes are the manifest formats dive understands, in order of preference
+var manifestMediaTypes = []string{
+	ociImageIndexMediaType,
+	dockerManifestListMediaType,
+	ociImageManifestMediaType,
+	dockerManifestMediaType,
+}
+
+// registryReference is a parsed image reference (e.g. "ghcr.io/org/app:1.2" or "alpine@sha256:...")
+type registryReference struct {
+	Registry   string
+	Repository string
+	// Reference is either a tag or a digest
+	Reference string
+}
+
+func parseRegistryReference(id string) (registryReference, error) {
+	ref := registryReference{}
+	name := id
+
+	if idx := strings.Index(name, "@"); idx >= 0 {
+		ref.Reference = name[idx+1:]
+		name = name[:idx]
+		if err := validateDigest(ref.Reference); err != nil {
+			return ref, err
+		}
+	} else if idx := strings.LastIndex(name, ":"); idx >= 0 && !strings.Contains(name[idx+1:], "/") {
+		ref.Reference = name[idx+1:]
+		name = name[:idx]
+	}
+	if ref.Reference == "" {
+		ref.Reference = "latest"
+	}
+
+	// the first path component is only a registry host if it looks like one
+	fields := strings.SplitN(name, "/", 2)
+	if len(fields) == 2 && (strings.ContainsAny(fields[0], ".:") || fields[0] == "localhost") {
+		ref.Registry, ref.Repository = fields[0], fields[1]
+	} else {
+		ref.Registry, ref.Repository = dockerHubRegistry, name
+	}
+
+	if ref.Registry == dockerHubRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+
+	if ref.Repository == "" {
+		return ref, fmt.Errorf("invalid image reference: %q", id)
+	}
+	return ref, nil
+}
+
+func (ref registryReference) String() string {
+	separator := ":"
+	if strings.Contains(ref.Reference, ":") {
+		separator = "@"
+	}
+	return ref.Registry + "/" + ref.Repository + separator + ref.Reference
+}
+
+// registryClient speaks the Docker Registry HTTP API v2 for a single repository
+type registryClient struct {
+	client      *http.Client
+	baseURL     string
+	repository  string
+	credentials registryCredentials
+
+	// token is shared by the requests made concurrently (e.g. while layers are fetched in parallel)
+	tokenLock sync.Mutex
+	token     string
+}
+
+func newRegistryClient(httpClient *http.Client, ref registryReference, credentials registryCredentials) *registryClient {
+	host := ref.Registry
+	if host == dockerHubRegistry {
+		host = dockerHubAPIRegistry
+	}
+
+	scheme := "https"
+	if isLoopbackHost(host) {
+		scheme = "http"
+	}
+
+	return &registryClient{
+		client:      httpClient,
+		baseURL:     scheme + "://" + host + "/v2/",
+		repository:  ref.Repository,
+		credentials: credentials,
+	}
+}
+
+// isLoopbackHost indicates registries that are reachable over plain HTTP (as with the docker daemon defaults)
+func isLoopbackHost(host string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(hostname)
+	return ip != nil && ip.IsLoopback()
+}
+
+// manifest fetches the raw manifest (or index) for the given tag or digest, returning the content and media type.
+func (c *registryClient) manifest(ctx context.Context, reference string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+c.repository+"/manifests/"+reference, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	if strings.Contains(reference, ":") {
+		// tags cannot hold a colon, so this is a digest the manifest must match
+		if body, err = newDigestReader(resp.Body, reference); err != nil {
+			return nil, "", err
+		}
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read manifest %s: %w", reference, err)
+	}
+
+	mediaType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	if mediaType == "" || mediaType == "application/json" {
+		// fall back to the media type declared within the document
+		var document struct {
+			MediaType string `json:"mediaType"`
+		}
+		if err := json.Unmarshal(content, &document); err == nil {
+			mediaType = document.MediaType
+		}
+	}
+
+	return content, mediaType, nil
+}
+
+// blob streams the blob with the given digest from the registry.
+func (c *registryClient) blob(ctx context.Context, digest string) (io.ReadCloser, error) {
+	if err := validateDigest(digest); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+c.repository+"/blobs/"+digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newDigestReader(resp.Body, digest)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// digestReader verifies that the content streamed from the registry matches the digest it was requested by. The
+// content is checked once read to the end, or when closed (reading whatever was left unread, as parsing a layer tar
+// stops short of any padding that follows it).
+type digestReader struct {
+	body      io.ReadCloser
+	digest    string
+	algorithm string
+	hash      hash.Hash
+	verified  bool
+}
+
+func newDigestReader(body io.ReadCloser, digest string) (*digestReader, error) {
+	var h hash.Hash
+	algorithm, _, _ := strings.Cut(digest, ":")
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm: %q", digest)
+	}
+	return &digestReader{body: body, digest: digest, algorithm: algorithm, hash: h}, nil
+}
+
+func (r *digestReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		if verifyErr := r.verify(); verifyErr != nil {
+			return n, verifyErr
+		}
+	}
+	return n, err
+}
+
+func (r *digestReader) Close() error {
+	if !r.verified {
+		if _, err := io.Copy(r.hash, r.body); err != nil {
+			r.body.Close()
+			return err
+		}
+	}
+	verifyErr := r.verify()
+	if err := r.body.Close(); verifyErr == nil {
+		return err
+	}
+	return verifyErr
+}
+
+func (r *digestReader) verify() error {
+	r.verified = true
+	if actual := fmt.Sprintf("%s:%x", r.algorithm, r.hash.Sum(nil)); actual != r.digest {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", r.digest, actual)
+	}
+	return nil
+}
+
+// do performs the request, authenticating against the registry (and retrying once) if challenged.
+func (c *registryClient) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		if err := c.authenticate(req.Context(), challenge); err != nil {
+			return nil, err
+		}
+
+		resp, err = c.send(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("registry request failed (%s %s): %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (c *registryClient) send(req *http.Request) (*http.Response, error) {
+	c.tokenLock.Lock()
+	token := c.token
+	c.tokenLock.Unlock()
+
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case c.credentials.Username != "" || c.credentials.Password != "":
+		req.SetBasicAuth(c.credentials.Username, c.credentials.Password)
+	}
+	return c.client.Do(req)
+}
+
+// authenticate satisfies the given WWW-Authenticate challenge, obtaining a bearer token when required.
+func (c *registryClient) authenticate(ctx context.Context, challenge string) error {
+	scheme, params := parseAuthChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		// any configured credentials are already sent on every request, so a challenge means they are missing or rejected
+		if c.credentials.isEmpty() {
+			return fmt.Errorf("registry requires credentials (use 'docker login')")
+		}
+		return fmt.Errorf("registry rejected the configured credentials")
+	case "bearer":
+		token, err := c.fetchToken(ctx, params)
+		if err != nil {
+			return err
+		}
+		c.tokenLock.Lock()
+		c.token = token
+		c.tokenLock.Unlock()
+		return nil
+	default:
+		return fmt.Errorf("unsupported registry auth challenge: %q", challenge)
+	}
+}
+
+func (c *registryClient) fetchToken(ctx context.Context, params map[string]string) (string, error) {
+	realm, exists := params["realm"]
+	if !exists {
+		return "", fmt.Errorf("registry auth challenge has no realm")
+	}
+
+	query := url.Values{}
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + c.repository + ":pull"
+	}
+	query.Set("scope", scope)
+
+	var req *http.Request
+	var err error
+	if c.credentials.IdentityToken != "" {
+		// identity tokens are exchanged via the OAuth2 refresh token flow
+		query.Set("grant_type", "refresh_token")
+		query.Set("refresh_token", c.credentials.IdentityToken)
+		query.Set("client_id", "dive")
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, realm, strings.NewReader(query.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		if c.credentials.Username != "" || c.credentials.Password != "" {
+			req.SetBasicAuth(c.credentials.Username, c.credentials.Password)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to fetch registry token: %s", resp.Status)
+	}
+
+	var response struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("unable to parse registry token: %w", err)
+	}
+	if response.Token != "" {
+		return response.Token, nil
+	}
+	if response.AccessToken != "" {
+		return response.AccessToken, nil
+	}
+	return "", fmt.Errorf("registry token response has no token")
+}
+
+// parseAuthChallenge splits a WWW-Authenticate header value (e.g. `Bearer realm="...",service="..."`) into the
+// scheme and its parameters.
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	fields := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(fields) < 2 {
+		return fields[0], params
+	}
+
+	rest := fields[1]
+	for len(rest) > 0 {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return fields[0], params
+}
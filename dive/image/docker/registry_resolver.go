@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+type registryResolver struct {
+	client  *http.Client
+	options image.ResolverOptions
+}
+
+func NewResolverFromRegistry(options image.ResolverOptions) *registryResolver {
+	return &registryResolver{
+		client:  http.DefaultClient,
+		options: options,
+	}
+}
+
+// Fetch pulls the image manifest, config, and layers directly from a registry over the Docker Registry HTTP API v2
+// (no container engine is needed). Credentials are taken from the docker CLI config (~/.docker/config.json).
+func (r *registryResolver) Fetch(ctx context.Context, id string) (*image.Image, error) {
+	ref, err := parseRegistryReference(id)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := loadDockerConfig()
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := cfg.credentialsFor(ref.Registry)
+	if err != nil {
+		return nil, err
+	}
+
+	client := newRegistryClient(r.client, ref, credentials)
+
+	content, mediaType, err := client.manifest(ctx, ref.Reference)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch manifest for %s: %w", ref, err)
+	}
+
+	if (ociDescriptor{MediaType: mediaType}).isIndex() {
+		index, err := newOciIndex(content)
+		if err != nil {
+			return nil, err
+		}
+		descriptor, err := resolveManifestDescriptor(index, "", r.options.Platform, func(digest string) ([]byte, error) {
+			content, _, err := client.manifest(ctx, digest)
+			return content, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ref, err)
+		}
+		content, _, err = client.manifest(ctx, descriptor.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch manifest for %s: %w", ref, err)
+		}
+	}
+
+	m, err := newOciManifest(content)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := newImageArchiveFromManifest(ctx, m, func(digest string) (io.ReadCloser, error) {
+		return client.blob(ctx, digest)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := img.CheckPlatform(r.options.Platform); err != nil {
+		return nil, err
+	}
+	return img.ToImage()
+}
+
+func (r *registryResolver) Build(ctx context.Context, args []string) (*image.Image, error) {
+	return nil, fmt.Errorf("build option not supported for registry resolver")
+}
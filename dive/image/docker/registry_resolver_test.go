@@ -0,0 +1,276 @@
+package docker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+// newTestRegistry serves the given OCI layout over the registry API as repository "dive/test", requiring a bearer
+// token that is only issued for the given username and password.
+func newTestRegistry(t *testing.T, layoutRoot, username, password string) *httptest.Server {
+	indexContent, err := os.ReadFile(filepath.Join(layoutRoot, "index.json"))
+	if err != nil {
+		t.Fatalf("unable to read index: %v", err)
+	}
+	layoutIndex, err := newOciIndex(indexContent)
+	if err != nil {
+		t.Fatalf("unable to parse index: %v", err)
+	}
+
+	// publish the image as a multi-platform index, only one entry of which exists
+	platformManifest := layoutIndex.Manifests[0]
+	platformManifest.Annotations = nil
+	platformManifest.Platform = &image.Platform{OS: "linux", Architecture: runtime.GOARCH}
+	otherManifest := ociDescriptor{
+		MediaType: platformManifest.MediaType,
+		Digest:    "sha256:0000000000000000000000000000000000000000000000000000000000000000",
+		Platform:  &image.Platform{OS: "windows", Architecture: "amd64"},
+	}
+	registryIndex, err := json.Marshal(ociIndex{
+		SchemaVersion: 2,
+		MediaType:     ociImageIndexMediaType,
+		Manifests:     []ociDescriptor{otherManifest, platformManifest},
+	})
+	if err != nil {
+		t.Fatalf("unable to marshal index: %v", err)
+	}
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != username || pass != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("scope") != "repository:dive/test:pull" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token": "test-token"}`))
+	})
+	mux.HandleFunc("/v2/dive/test/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test-registry",scope="repository:dive/test:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, "/v2/dive/test/")
+		switch {
+		case rest == "manifests/latest":
+			if !strings.Contains(r.Header.Get("Accept"), ociImageIndexMediaType) {
+				w.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+			w.Header().Set("Content-Type", ociImageIndexMediaType)
+			_, _ = w.Write(registryIndex)
+		case strings.HasPrefix(rest, "manifests/sha256:"), strings.HasPrefix(rest, "blobs/sha256:"):
+			digest := strings.TrimPrefix(rest[strings.Index(rest, "/")+1:], "sha256:")
+			content, err := os.ReadFile(filepath.Join(layoutRoot, "blobs", "sha256", digest))
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(content)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func writeTestDockerConfig(t *testing.T, registry, username, password string) {
+	dir := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	content := `{"auths": {"` + registry + `": {"auth": "` + auth + `"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(content), 0600); err != nil {
+		t.Fatalf("unable to write docker config: %v", err)
+	}
+	t.Setenv("DOCKER_CONFIG", dir)
+}
+
+func Test_RegistryResolver(t *testing.T) {
+	layoutRoot := testOciLayoutFromArchive(t, "../../../.data/test-docker-image.tar", "dive-test:latest")
+	server := newTestRegistry(t, layoutRoot, "dive", "secret")
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	writeTestDockerConfig(t, host, "dive", "secret")
+
+	img, err := NewResolverFromRegistry(image.ResolverOptions{}).Fetch(context.Background(), host+"/dive/test:latest")
+	if err != nil {
+		t.Fatalf("unable to fetch image: %v", err)
+	}
+
+	result, err := img.Analyze()
+	if err != nil {
+		t.Fatalf("unable to analyze: %v", err)
+	}
+	TestCheckAnalysis(t, "", result)
+}
+
+func Test_RegistryResolver_BadCredentials(t *testing.T) {
+	layoutRoot := testOciLayoutFromArchive(t, "../../../.data/test-docker-image.tar", "dive-test:latest")
+	server := newTestRegistry(t, layoutRoot, "dive", "secret")
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	writeTestDockerConfig(t, host, "dive", "wrong")
+
+	_, err := NewResolverFromRegistry(image.ResolverOptions{}).Fetch(context.Background(), host+"/dive/test:latest")
+	if err == nil {
+		t.Fatalf("expected an error with bad credentials")
+	}
+}
+
+func Test_ParseRegistryReference(t *testing.T) {
+	table := map[string]registryReference{
+		"alpine":                      {Registry: "docker.io", Repository: "library/alpine", Reference: "latest"},
+		"alpine:3.18":                 {Registry: "docker.io", Repository: "library/alpine", Reference: "3.18"},
+		"wagoodman/dive:v0.11":        {Registry: "docker.io", Repository: "wagoodman/dive", Reference: "v0.11"},
+		"ghcr.io/org/app":             {Registry: "ghcr.io", Repository: "org/app", Reference: "latest"},
+		"localhost:5000/app:1.2":      {Registry: "localhost:5000", Repository: "app", Reference: "1.2"},
+		"quay.io/org/app@sha256:abcd": {Registry: "quay.io", Repository: "org/app", Reference: "sha256:abcd"},
+	}
+
+	for id, expected := range table {
+		actual, err := parseRegistryReference(id)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", id, err)
+			continue
+		}
+		if actual != expected {
+			t.Errorf("%s: expected %+v, got %+v", id, expected, actual)
+		}
+	}
+}
+
+func Test_ParseAuthChallenge(t *testing.T) {
+	scheme, params := parseAuthChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull"`)
+	if scheme != "Bearer" {
+		t.Errorf("expected Bearer scheme, got %q", scheme)
+	}
+	expected := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/alpine:pull",
+	}
+	for key, value := range expected {
+		if params[key] != value {
+			t.Errorf("expected %s=%q, got %q", key, value, params[key])
+		}
+	}
+}
+
+func Test_RegistryResolver_DigestMismatch(t *testing.T) {
+	tamper := map[string]func(t *testing.T, layoutRoot string){
+		// a layer served with the (valid) contents of another layer
+		"layer": func(t *testing.T, layoutRoot string) {
+			m := ociLayoutManifest(t, layoutRoot)
+			content, err := os.ReadFile(ociBlobPath(layoutRoot, m.Layers[1].Digest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(ociBlobPath(layoutRoot, m.Layers[2].Digest), content, 0644); err != nil {
+				t.Fatal(err)
+			}
+		},
+		// a manifest fetched by digest with altered (yet still valid) contents
+		"manifest": func(t *testing.T, layoutRoot string) {
+			indexContent, err := os.ReadFile(filepath.Join(layoutRoot, "index.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			index, err := newOciIndex(indexContent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := ociBlobPath(layoutRoot, index.Manifests[0].Digest)
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+
+	for name, alter := range tamper {
+		t.Run(name, func(t *testing.T) {
+			layoutRoot := testOciLayoutFromArchive(t, "../../../.data/test-docker-image.tar", "dive-test:latest")
+			server := newTestRegistry(t, layoutRoot, "dive", "secret")
+			host := strings.TrimPrefix(server.URL, "http://")
+			writeTestDockerConfig(t, host, "dive", "secret")
+			alter(t, layoutRoot)
+
+			_, err := NewResolverFromRegistry(image.ResolverOptions{}).Fetch(context.Background(), host+"/dive/test:latest")
+			if err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+				t.Errorf("expected a digest mismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func Test_DigestReader(t *testing.T) {
+	content := "dive\n"
+	digest := "sha256:2b25a828e41ea177224ae2dee24977e93f8f4953964a38e5dbf11742c5a0ef8f"
+
+	reader, err := newDigestReader(io.NopCloser(strings.NewReader(content)), digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := io.ReadAll(reader); err != nil || string(actual) != content {
+		t.Errorf("expected the content, got %q (%v)", actual, err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Errorf("unable to close: %v", err)
+	}
+
+	// unread content is checked when closed
+	reader, err = newDigestReader(io.NopCloser(strings.NewReader("altered")), digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Read(make([]byte, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Close(); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("expected a digest mismatch when closed, got %v", err)
+	}
+
+	if _, err := newDigestReader(io.NopCloser(strings.NewReader(content)), "md5:abc"); err == nil {
+		t.Errorf("expected an unsupported digest algorithm error")
+	}
+}
+
+func Test_RegistryResolver_UnknownPlatform(t *testing.T) {
+	layoutRoot := testOciLayoutFromArchive(t, "../../../.data/test-docker-image.tar", "dive-test:latest")
+	server := newTestRegistry(t, layoutRoot, "dive", "secret")
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	writeTestDockerConfig(t, host, "dive", "secret")
+
+	platform := image.Platform{OS: "linux", Architecture: "s390x"}
+	_, err := NewResolverFromRegistry(image.ResolverOptions{Platform: &platform}).Fetch(context.Background(), host+"/dive/test:latest")
+	if err == nil {
+		t.Fatalf("expected an error for an unavailable platform")
+	}
+	expected := "no image found for platform linux/s390x (available: windows/amd64, linux/" + runtime.GOARCH + ")"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error to contain %q, got %q", expected, err.Error())
+	}
+}
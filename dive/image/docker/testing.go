@@ -1,7 +1,11 @@
 package docker
 
 import (
+	"archive/tar"
+	"context"
+	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/wagoodman/dive/dive/image"
@@ -14,7 +18,7 @@ func TestLoadArchive(tarPath string) (*ImageArchive, error) {
 	}
 	defer f.Close()
 
-	return NewImageArchive(f)
+	return NewImageArchive(context.Background(), f)
 }
 
 func TestAnalysisFromArchive(t *testing.T, path string) *image.AnalysisResult {
@@ -34,3 +38,64 @@ func TestAnalysisFromArchive(t *testing.T, path string) *image.AnalysisResult {
 	}
 	return result
 }
+
+// TestCheckAnalysis checks the analysis of the test image (.data/test-docker-image.tar), whichever source the image was
+// read from, prefixing any failure with the given name (if any).
+func TestCheckAnalysis(t *testing.T, name string, result *image.AnalysisResult) {
+	t.Helper()
+	if name != "" {
+		name += ": "
+	}
+	if len(result.Layers) != 14 {
+		t.Errorf("%sexpected 14 layers, got %d", name, len(result.Layers))
+	}
+	if result.SizeBytes != 1220598 {
+		t.Errorf("%sexpected sizeBytes=1220598, got %v", name, result.SizeBytes)
+	}
+	if result.WastedBytes != 32025 {
+		t.Errorf("%sexpected wastedBytes=32025, got %v", name, result.WastedBytes)
+	}
+}
+
+// TestExtractTar unpacks the given tarball into the given directory. The optional extract function may extract an entry
+// itself (e.g. a whiteout as a device), returning false to have the entry extracted as is.
+func TestExtractTar(t *testing.T, reader io.Reader, dest string, extract func(header *tar.Header, target string) bool) {
+	t.Helper()
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("unable to read tar: %v", err)
+		}
+
+		target := filepath.Join(dest, header.Name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatalf("unable to create dir: %v", err)
+		}
+		if extract != nil && extract(header, target) {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, header.FileInfo().Mode().Perm())
+		case tar.TypeSymlink:
+			err = os.Symlink(header.Linkname, target)
+		case tar.TypeLink:
+			err = os.Link(filepath.Join(dest, header.Linkname), target)
+		case tar.TypeReg:
+			var f *os.File
+			f, err = os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, header.FileInfo().Mode().Perm())
+			if err == nil {
+				_, err = io.Copy(f, tarReader)
+				f.Close()
+			}
+		}
+		if err != nil {
+			t.Fatalf("unable to extract %s: %v", header.Name, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned (wrapped) by resolvers when an image cannot be parsed, which can be matched with errors.Is.
+var (
+	// ErrManifestNotFound indicates the image has no manifest (e.g. an archive without a manifest.json)
+	ErrManifestNotFound = errors.New("could not find image manifest")
+	// ErrInvalidManifest indicates the image manifest could not be parsed
+	ErrInvalidManifest = errors.New("invalid image manifest")
+	// ErrConfigNotFound indicates the image config named by the manifest is missing
+	ErrConfigNotFound = errors.New("could not find image config")
+	// ErrInvalidConfig indicates the image config could not be parsed
+	ErrInvalidConfig = errors.New("invalid image config")
+	// ErrLayerNotFound indicates a layer named by the manifest is missing
+	ErrLayerNotFound = errors.New("could not find image layer")
+	// ErrCorruptLayer indicates a layer could not be read (see CorruptLayerError for the layer in question)
+	ErrCorruptLayer = errors.New("corrupt image layer")
+)
+
+// CorruptLayerError describes a layer that could not be read (e.g. a truncated or malformed tar). It matches
+// ErrCorruptLayer with errors.Is.
+type CorruptLayerError struct {
+	// Path is the layer path within the image (e.g. the layer tar path within a docker-archive, or the layer digest)
+	Path string
+	Err  error
+}
+
+func (e *CorruptLayerError) Error() string {
+	return fmt.Sprintf("corrupt image layer '%s': %v", e.Path, e.Err)
+}
+
+func (e *CorruptLayerError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CorruptLayerError) Is(target error) bool {
+	return target == ErrCorruptLayer
+}
@@ -7,17 +7,26 @@ import (
 type Image struct {
 	Trees  []*filetree.FileTree
 	Layers []*Layer
+	// RepoTags are the names the image is known by within its source (may be empty)
+	RepoTags []string
 }
 
 func (img *Image) Analyze() (*AnalysisResult, error) {
 	efficiency, inefficiencies := filetree.Efficiency(img.Trees)
-	var sizeBytes, userSizeBytes uint64
+	var sizeBytes, userSizeBytes, compressedSizeBytes uint64
+	compressedSizeKnown := len(img.Layers) > 0
 
 	for i, v := range img.Layers {
 		sizeBytes += v.Size
 		if i != 0 {
 			userSizeBytes += v.Size
 		}
+		compressedSizeBytes += v.CompressedSize
+		compressedSizeKnown = compressedSizeKnown && v.CompressedSize > 0
+	}
+	if !compressedSizeKnown {
+		// a partial total would understate the size of the image
+		compressedSizeBytes = 0
 	}
 
 	var wastedBytes uint64
@@ -26,13 +35,14 @@ func (img *Image) Analyze() (*AnalysisResult, error) {
 	}
 
 	return &AnalysisResult{
-		Layers:            img.Layers,
-		RefTrees:          img.Trees,
-		Efficiency:        efficiency,
-		UserSizeByes:      userSizeBytes,
-		SizeBytes:         sizeBytes,
-		WastedBytes:       wastedBytes,
-		WastedUserPercent: float64(wastedBytes) / float64(userSizeBytes),
-		Inefficiencies:    inefficiencies,
+		Layers:              img.Layers,
+		RefTrees:            img.Trees,
+		Efficiency:          efficiency,
+		UserSizeByes:        userSizeBytes,
+		SizeBytes:           sizeBytes,
+		CompressedSizeBytes: compressedSizeBytes,
+		WastedBytes:         wastedBytes,
+		WastedUserPercent:   float64(wastedBytes) / float64(userSizeBytes),
+		Inefficiencies:      inefficiencies,
 	}, nil
 }
@@ -0,0 +1,23 @@
+package image
+
+import (
+	"context"
+	"runtime"
+)
+
+type jobsKey struct{}
+
+// WithJobs bounds the number of layers that resolvers fetching with the returned context parse (and hash)
+// concurrently. A value below one uses one job per CPU.
+func WithJobs(ctx context.Context, jobs int) context.Context {
+	return context.WithValue(ctx, jobsKey{}, jobs)
+}
+
+// JobsFrom returns the number of layers to parse concurrently with the context (one per CPU when not given).
+func JobsFrom(ctx context.Context) int {
+	jobs, _ := ctx.Value(jobsKey{}).(int)
+	if jobs < 1 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return jobs
+}
@@ -10,7 +10,7 @@ import (
 )
 
 const (
-	LayerFormat = "%7s  %s"
+	LayerFormat = "%7s  %10s  %s"
 )
 
 type Layer struct {
@@ -18,9 +18,12 @@ type Layer struct {
 	Index   int
 	Command string
 	Size    uint64
-	Tree    *filetree.FileTree
-	Names   []string
-	Digest  string
+	// CompressedSize is the size of the layer blob as stored in a registry and pulled (zero when unknown, e.g. for
+	// the uncompressed layers of a docker-archive)
+	CompressedSize uint64
+	Tree           *filetree.FileTree
+	Names          []string
+	Digest         string
 }
 
 func (l *Layer) ShortId() string {
@@ -40,13 +43,23 @@ func (l *Layer) commandPreview() string {
 	return strings.Replace(l.Command, "\n", "↵", -1)
 }
 
+// CompressedSizeString is the compressed size of the layer for display ("-" when unknown).
+func (l *Layer) CompressedSizeString() string {
+	if l.CompressedSize == 0 {
+		return "-"
+	}
+	return humanize.Bytes(l.CompressedSize)
+}
+
 func (l *Layer) String() string {
 	if l.Index == 0 {
 		return fmt.Sprintf(LayerFormat,
 			humanize.Bytes(l.Size),
+			l.CompressedSizeString(),
 			"FROM "+l.ShortId())
 	}
 	return fmt.Sprintf(LayerFormat,
 		humanize.Bytes(l.Size),
+		l.CompressedSizeString(),
 		l.commandPreview())
 }
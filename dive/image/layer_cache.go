@@ -0,0 +1,327 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wagoodman/dive/dive/filetree"
+)
+
+// layerCacheNoDigests names the cache partition of trees parsed without file digests
+const layerCacheNoDigests = "none"
+
+// LayerCache stores the parsed file trees of layers on disk, keyed by the layer DiffID (the digest of the uncompressed
+// layer tar), so that layers seen before are not read and parsed again. Trees are stored by the filetree encoding
+// version and by the file digests computed while parsing, so trees parsed differently are never mixed up:
+//
+//	<dir>/v<encoding version>/<file digests>/<diff id algorithm>/<diff id>
+type LayerCache struct {
+	dir string
+}
+
+// LayerCacheEntry describes a single layer tree held by the cache.
+type LayerCacheEntry struct {
+	DiffID string
+	// Digests is the file digest algorithm the tree was parsed with
+	Digests filetree.DigestAlgorithm
+	// Version is the filetree encoding version of the entry, entries of other versions than the current one are Stale
+	// (these are never used, and are always removed when pruning)
+	Version  int
+	Stale    bool
+	Size     int64
+	LastUsed time.Time
+	Path     string
+}
+
+type layerCacheKey struct{}
+
+// NewLayerCache creates a cache stored in the given directory (which is created as needed).
+func NewLayerCache(dir string) *LayerCache {
+	return &LayerCache{dir: dir}
+}
+
+// DefaultLayerCacheDir is the cache directory used when none is configured (within the user cache directory, e.g.
+// $XDG_CACHE_HOME/dive/layers).
+func DefaultLayerCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine the cache directory: %w", err)
+	}
+	return filepath.Join(dir, "dive", "layers"), nil
+}
+
+// WithLayerCache requests the resolvers fetching with the returned context to load (and store) the parsed layer
+// trees from the given cache.
+func WithLayerCache(ctx context.Context, cache *LayerCache) context.Context {
+	return context.WithValue(ctx, layerCacheKey{}, cache)
+}
+
+// LayerCacheFrom returns the layer cache attached to the context (nil when layers should not be cached).
+func LayerCacheFrom(ctx context.Context) *LayerCache {
+	cache, _ := ctx.Value(layerCacheKey{}).(*LayerCache)
+	return cache
+}
+
+// Dir is the directory the cache is stored in.
+func (c *LayerCache) Dir() string {
+	return c.dir
+}
+
+func (c *LayerCache) versionDir() string {
+	return filepath.Join(c.dir, "v"+strconv.Itoa(filetree.EncodingVersion))
+}
+
+func (c *LayerCache) path(diffID string, digests filetree.DigestAlgorithm) (string, error) {
+	fields := strings.SplitN(diffID, ":", 2)
+	if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+		return "", fmt.Errorf("invalid diff id: %q", diffID)
+	}
+	for _, field := range fields {
+		if strings.ContainsAny(field, `/\.`) {
+			return "", fmt.Errorf("invalid diff id: %q", diffID)
+		}
+	}
+	return filepath.Join(c.versionDir(), layerCachePartition(digests), fields[0], fields[1]), nil
+}
+
+// layerCachePartition names the directory of the entries parsed with the given file digests.
+func layerCachePartition(digests filetree.DigestAlgorithm) string {
+	if digests == filetree.NoDigest {
+		return layerCacheNoDigests
+	}
+	return string(digests)
+}
+
+// Load returns the cached tree of the layer with the given DiffID (parsed with the given file digests), if any.
+// Unreadable entries are removed and reported as missing.
+func (c *LayerCache) Load(diffID string, digests filetree.DigestAlgorithm) (*filetree.FileTree, bool) {
+	if c == nil {
+		return nil, false
+	}
+	path, err := c.path(diffID, digests)
+	if err != nil {
+		return nil, false
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+
+	tree, err := filetree.DecodeFileTree(file)
+	if err != nil {
+		logrus.Warnf("removing unreadable layer cache entry %s: %v", path, err)
+		if err := os.Remove(path); err != nil {
+			logrus.Debugf("unable to remove layer cache entry %s: %v", path, err)
+		}
+		return nil, false
+	}
+
+	// the modification time records when the entry was last used (see Prune)
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		logrus.Debugf("unable to touch layer cache entry %s: %v", path, err)
+	}
+	return tree, true
+}
+
+// Store adds the given tree of the layer with the given DiffID (parsed with the given file digests) to the cache.
+func (c *LayerCache) Store(diffID string, digests filetree.DigestAlgorithm, tree *filetree.FileTree) error {
+	if c == nil {
+		return nil
+	}
+	path, err := c.path(diffID, digests)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("unable to create layer cache directory: %w", err)
+	}
+
+	// write to a temporary file first, so that concurrent runs never read a partially written entry
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("unable to store layer %s: %w", diffID, err)
+	}
+	err = tree.Encode(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		return errors.Join(fmt.Errorf("unable to store layer %s: %w", diffID, err), os.Remove(file.Name()))
+	}
+	return nil
+}
+
+// Entries lists every layer tree held by the cache (of any encoding version), most recently used first.
+func (c *LayerCache) Entries() ([]LayerCacheEntry, error) {
+	versions, err := os.ReadDir(c.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read layer cache: %w", err)
+	}
+
+	var entries []LayerCacheEntry
+	for _, versionEntry := range versions {
+		version, ok := layerCacheVersion(versionEntry)
+		if !ok {
+			continue
+		}
+
+		// <digests>/<algorithm>/<encoded>
+		versionDir := filepath.Join(c.dir, versionEntry.Name())
+		matches, err := filepath.Glob(filepath.Join(versionDir, "*", "*", "*"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read layer cache: %w", err)
+		}
+		for _, match := range matches {
+			rel, err := filepath.Rel(versionDir, match)
+			if err != nil {
+				continue
+			}
+			fields := strings.Split(filepath.ToSlash(rel), "/")
+			if strings.HasPrefix(fields[2], ".") {
+				// an entry that is still being written
+				continue
+			}
+			info, err := os.Stat(match)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+
+			digests := filetree.DigestAlgorithm(fields[0])
+			if fields[0] == layerCacheNoDigests {
+				digests = filetree.NoDigest
+			}
+			entries = append(entries, LayerCacheEntry{
+				DiffID:   fields[1] + ":" + fields[2],
+				Digests:  digests,
+				Version:  version,
+				Stale:    version != filetree.EncodingVersion,
+				Size:     info.Size(),
+				LastUsed: info.ModTime(),
+				Path:     match,
+			})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// Prune removes the entries that have not been used within the given duration (every entry when zero), along with
+// every entry of another encoding version than the current one. The removed entries are returned.
+func (c *LayerCache) Prune(olderThan time.Duration) ([]LayerCacheEntry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var removed []LayerCacheEntry
+	var errs []error
+	for _, entry := range entries {
+		if !entry.Stale && olderThan > 0 && entry.LastUsed.After(cutoff) {
+			continue
+		}
+		if err := os.Remove(entry.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, entry)
+	}
+
+	// directories of other versions are no longer of any use (including any partially written entries). The cache
+	// directory is configurable, so only the directories holding nothing but cache entries are removed.
+	versions, err := os.ReadDir(c.dir)
+	if err == nil {
+		for _, versionEntry := range versions {
+			version, ok := layerCacheVersion(versionEntry)
+			if !ok || version == filetree.EncodingVersion {
+				continue
+			}
+			versionDir := filepath.Join(c.dir, versionEntry.Name())
+			if !isLayerCacheVersionDir(versionDir) {
+				logrus.Debugf("not removing %s from the layer cache: it holds more than layer cache entries", versionDir)
+				continue
+			}
+			if err := os.RemoveAll(versionDir); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return removed, fmt.Errorf("unable to prune layer cache: %w", err)
+	}
+	return removed, nil
+}
+
+// layerCacheVersionPattern matches the names of the encoding version directories of the cache (e.g. "v1")
+var layerCacheVersionPattern = regexp.MustCompile(`^v[0-9]+$`)
+
+// layerCacheVersion returns the encoding version of the given directory entry of the cache directory, if it is an
+// encoding version directory.
+func layerCacheVersion(entry fs.DirEntry) (int, bool) {
+	if !entry.IsDir() || !layerCacheVersionPattern.MatchString(entry.Name()) {
+		return 0, false
+	}
+	version, err := strconv.Atoi(entry.Name()[1:])
+	return version, err == nil
+}
+
+// isLayerCacheVersionDir indicates if the given directory holds nothing but the <file digests>/<diff id algorithm>/
+// <diff id> layout of cache entries.
+func isLayerCacheVersionDir(dir string) bool {
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		fields := strings.Split(filepath.ToSlash(rel), "/")
+		switch len(fields) {
+		case 1:
+			digests, err := filetree.ParseDigestAlgorithm(fields[0])
+			if err != nil || layerCachePartition(digests) != fields[0] || !entry.IsDir() {
+				return fs.ErrInvalid
+			}
+		case 2:
+			if !entry.IsDir() {
+				return fs.ErrInvalid
+			}
+		case 3:
+			if !entry.Type().IsRegular() {
+				return fs.ErrInvalid
+			}
+		default:
+			return fs.ErrInvalid
+		}
+		return nil
+	})
+	return err == nil
+}
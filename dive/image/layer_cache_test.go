@@ -0,0 +1,209 @@
+package image
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wagoodman/dive/dive/filetree"
+)
+
+const testDiffID = "sha256:2b25a828e41ea177224ae2dee24977e93f8f4953964a38e5dbf11742c5a0ef8f"
+
+func testLayerTree(t *testing.T) *filetree.FileTree {
+	tree := filetree.NewFileTree()
+	tree.Name = "layer.tar"
+	if _, _, err := tree.AddPath("/etc/motd", filetree.FileInfo{Path: "/etc/motd", Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	tree.FileSize = 5
+	return tree
+}
+
+func TestLayerCache_StoreLoad(t *testing.T) {
+	cache := NewLayerCache(t.TempDir())
+	tree := testLayerTree(t)
+
+	if _, cached := cache.Load(testDiffID, filetree.NoDigest); cached {
+		t.Fatalf("expected an empty cache")
+	}
+	if err := cache.Store(testDiffID, filetree.NoDigest, tree); err != nil {
+		t.Fatalf("unable to store tree: %v", err)
+	}
+
+	loaded, cached := cache.Load(testDiffID, filetree.NoDigest)
+	if !cached {
+		t.Fatalf("expected the stored tree")
+	}
+	if loaded.String(true) != tree.String(true) || loaded.FileSize != tree.FileSize {
+		t.Errorf("expected tree:\n%s\ngot:\n%s", tree.String(true), loaded.String(true))
+	}
+
+	// trees are stored by the file digests they were parsed with
+	if _, cached := cache.Load(testDiffID, filetree.DigestSHA256); cached {
+		t.Errorf("expected no tree parsed with sha256 file digests")
+	}
+
+	for _, diffID := range []string{"", "sha256", "sha256:../../etc", "sha256:a/b", ":abc"} {
+		if err := cache.Store(diffID, filetree.NoDigest, tree); err == nil {
+			t.Errorf("%q: expected an invalid diff id error", diffID)
+		}
+	}
+
+	var none *LayerCache
+	if _, cached := none.Load(testDiffID, filetree.NoDigest); cached {
+		t.Errorf("expected a nil cache to hold nothing")
+	}
+}
+
+func TestLayerCache_UnreadableEntry(t *testing.T) {
+	cache := NewLayerCache(t.TempDir())
+	if err := cache.Store(testDiffID, filetree.NoDigest, testLayerTree(t)); err != nil {
+		t.Fatalf("unable to store tree: %v", err)
+	}
+	entries, err := cache.Entries()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected a single entry, got %v (%v)", entries, err)
+	}
+	if err := os.WriteFile(entries[0].Path, []byte("corrupt"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, cached := cache.Load(testDiffID, filetree.NoDigest); cached {
+		t.Errorf("expected an unreadable entry to be ignored")
+	}
+	if _, err := os.Stat(entries[0].Path); !os.IsNotExist(err) {
+		t.Errorf("expected the unreadable entry to be removed, got %v", err)
+	}
+}
+
+func TestLayerCache_EntriesPrune(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewLayerCache(dir)
+	tree := testLayerTree(t)
+
+	recent := "sha256:1111"
+	old := "sha256:2222"
+	for _, diffID := range []string{recent, old} {
+		if err := cache.Store(diffID, filetree.DigestSHA256, tree); err != nil {
+			t.Fatalf("unable to store tree: %v", err)
+		}
+	}
+	if _, cached := cache.Load(recent, filetree.DigestSHA256); !cached {
+		t.Fatalf("expected the stored tree")
+	}
+
+	// an entry of a previous encoding version, and an entry that has not been used in a while
+	stale := filepath.Join(dir, "v0", "none", "sha256", "3333")
+	if err := os.MkdirAll(filepath.Dir(stale), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, []byte("old format"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := cache.Entries()
+	if err != nil {
+		t.Fatalf("unable to list entries: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.DiffID == old {
+			lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+			if err := os.Chtimes(entry.Path, lastWeek, lastWeek); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	entries, err = cache.Entries()
+	if err != nil {
+		t.Fatalf("unable to list entries: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", entries)
+	}
+	if entries[0].DiffID != recent || entries[0].Digests != filetree.DigestSHA256 || entries[0].Stale || entries[0].Size == 0 {
+		t.Errorf("expected the most recently used entry first, got %+v", entries[0])
+	}
+	if entries[1].DiffID != "sha256:3333" || entries[1].Digests != filetree.NoDigest || !entries[1].Stale || entries[1].Version != 0 {
+		t.Errorf("expected the stale entry, got %+v", entries[1])
+	}
+	if entries[2].DiffID != old {
+		t.Errorf("expected the least recently used entry last, got %+v", entries[2])
+	}
+
+	removed, err := cache.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("unable to prune: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("expected the old and stale entries to be removed, got %+v", removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "v0")); !os.IsNotExist(err) {
+		t.Errorf("expected the stale version to be removed, got %v", err)
+	}
+	if _, cached := cache.Load(recent, filetree.DigestSHA256); !cached {
+		t.Errorf("expected the recent entry to be kept")
+	}
+
+	if removed, err = cache.Prune(0); err != nil || len(removed) != 1 {
+		t.Errorf("expected every remaining entry to be removed, got %+v (%v)", removed, err)
+	}
+	if entries, err = cache.Entries(); err != nil || len(entries) != 0 {
+		t.Errorf("expected an empty cache, got %+v (%v)", entries, err)
+	}
+
+	if entries, err := NewLayerCache(filepath.Join(dir, "missing")).Entries(); err != nil || len(entries) != 0 {
+		t.Errorf("expected a missing cache to be empty, got %+v (%v)", entries, err)
+	}
+}
+
+func TestLayerCache_PruneKeepsUnrelatedDirs(t *testing.T) {
+	// the cache directory is configurable, and may hold directories that dive does not own
+	dir := t.TempDir()
+	cache := NewLayerCache(dir)
+	if err := cache.Store(testDiffID, filetree.NoDigest, testLayerTree(t)); err != nil {
+		t.Fatalf("unable to store tree: %v", err)
+	}
+	unrelated := []string{
+		filepath.Join(dir, "vendor", "modules.txt"),
+		filepath.Join(dir, "venv", "bin", "python", "activate"),
+		// a directory named like a version directory, with more than cache entries in it
+		filepath.Join(dir, "v2", "notes.txt"),
+		filepath.Join(dir, "v3", "none", "sha256", "3333", "nested"),
+	}
+	for _, path := range unrelated {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("keep"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := cache.Prune(0); err != nil {
+		t.Fatalf("unable to prune: %v", err)
+	}
+	for _, path := range unrelated {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to be kept, got %v", path, err)
+		}
+	}
+	if entries, err := cache.Entries(); err != nil || len(entries) != 0 {
+		t.Errorf("expected the cache entries to be removed, got %+v (%v)", entries, err)
+	}
+}
+
+func TestLayerCacheFrom(t *testing.T) {
+	if LayerCacheFrom(context.Background()) != nil {
+		t.Errorf("expected no cache by default")
+	}
+	if LayerCacheFrom(WithLayerCache(context.Background(), nil)) != nil {
+		t.Errorf("expected no cache")
+	}
+	cache := NewLayerCache(t.TempDir())
+	if LayerCacheFrom(WithLayerCache(context.Background(), cache)) != cache {
+		t.Errorf("expected the given cache")
+	}
+}
@@ -0,0 +1,55 @@
+package image
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Platform identifies the operating system and CPU architecture an image was built for.
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ParsePlatform parses a platform given as "os/arch[/variant]" (e.g. "linux/arm64/v8").
+func ParsePlatform(value string) (Platform, error) {
+	fields := strings.Split(value, "/")
+	if len(fields) < 2 || len(fields) > 3 {
+		return Platform{}, fmt.Errorf("invalid platform %q (expected os/arch[/variant])", value)
+	}
+	for _, field := range fields {
+		if field == "" {
+			return Platform{}, fmt.Errorf("invalid platform %q (expected os/arch[/variant])", value)
+		}
+	}
+
+	platform := Platform{
+		OS:           strings.ToLower(fields[0]),
+		Architecture: strings.ToLower(fields[1]),
+	}
+	if len(fields) == 3 {
+		platform.Variant = strings.ToLower(fields[2])
+	}
+	return platform, nil
+}
+
+// DefaultPlatform is the platform selected when none is requested: linux on the host CPU architecture.
+func DefaultPlatform() Platform {
+	return Platform{OS: "linux", Architecture: runtime.GOARCH}
+}
+
+func (p Platform) String() string {
+	if p.Variant != "" {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// Matches indicates if the given platform satisfies this (requested) platform. An empty variant matches any variant.
+func (p Platform) Matches(other Platform) bool {
+	return p.OS == other.OS &&
+		p.Architecture == other.Architecture &&
+		(p.Variant == "" || p.Variant == other.Variant)
+}
@@ -4,10 +4,11 @@
 package podman
 
 import (
+	"context"
 	"os"
 )
 
-func buildImageFromCli(buildArgs []string) (string, error) {
+func buildImageFromCli(ctx context.Context, buildArgs []string) (string, error) {
 	iidfile, err := os.CreateTemp("/tmp", "dive.*.iid")
 	if err != nil {
 		return "", err
@@ -15,7 +16,7 @@ func buildImageFromCli(buildArgs []string) (string, error) {
 	defer os.Remove(iidfile.Name())
 
 	allArgs := append([]string{"--iidfile", iidfile.Name()}, buildArgs...)
-	err = runPodmanCmd("build", allArgs...)
+	err = runPodmanCmd(ctx, "build", allArgs...)
 	if err != nil {
 		return "", err
 	}
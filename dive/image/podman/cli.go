@@ -4,6 +4,7 @@
 package podman
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -12,15 +13,15 @@ import (
 	"github.com/wagoodman/dive/utils"
 )
 
-// runPodmanCmd runs a given Podman command in the current tty
-func runPodmanCmd(cmdStr string, args ...string) error {
+// runPodmanCmd runs a given Podman command in the current tty (the command is killed if the context is done first)
+func runPodmanCmd(ctx context.Context, cmdStr string, args ...string) error {
 	if !isPodmanClientBinaryAvailable() {
 		return fmt.Errorf("cannot find podman client executable")
 	}
 
 	allArgs := utils.CleanArgs(append([]string{cmdStr}, args...))
 
-	cmd := exec.Command("podman", allArgs...)
+	cmd := exec.CommandContext(ctx, "podman", allArgs...)
 	cmd.Env = os.Environ()
 
 	cmd.Stdout = os.Stdout
@@ -30,24 +31,17 @@ func runPodmanCmd(cmdStr string, args ...string) error {
 	return cmd.Run()
 }
 
-func streamPodmanCmd(args ...string) (error, io.Reader) {
+// streamPodmanCmd runs a given Podman command, streaming its stdout. A failed command is reported as an error when
+// the stream is read to completion or closed.
+func streamPodmanCmd(ctx context.Context, args ...string) (io.ReadCloser, error) {
 	if !isPodmanClientBinaryAvailable() {
-		return fmt.Errorf("cannot find podman client executable"), nil
+		return nil, fmt.Errorf("cannot find podman client executable")
 	}
 
-	cmd := exec.Command("podman", utils.CleanArgs(args)...)
+	cmd := exec.CommandContext(ctx, "podman", utils.CleanArgs(args)...)
 	cmd.Env = os.Environ()
 
-	reader, writer, err := os.Pipe()
-	if err != nil {
-		return err, nil
-	}
-	defer writer.Close()
-
-	cmd.Stdout = writer
-	cmd.Stderr = os.Stderr
-
-	return cmd.Start(), reader
+	return utils.NewCommandReader(cmd)
 }
 
 func isPodmanClientBinaryAvailable() bool {
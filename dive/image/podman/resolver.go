@@ -4,6 +4,9 @@
 package podman
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 
@@ -11,40 +14,116 @@ import (
 	"github.com/wagoodman/dive/dive/image/docker"
 )
 
-type resolver struct{}
+type resolver struct {
+	options image.ResolverOptions
+}
 
-func NewResolverFromEngine() *resolver {
-	return &resolver{}
+func NewResolverFromEngine(options image.ResolverOptions) *resolver {
+	return &resolver{
+		options: options,
+	}
 }
 
-func (r *resolver) Build(args []string) (*image.Image, error) {
-	id, err := buildImageFromCli(args)
+func (r *resolver) Build(ctx context.Context, args []string) (*image.Image, error) {
+	id, err := buildImageFromCli(ctx, args)
 	if err != nil {
 		return nil, err
 	}
-	return r.Fetch(id)
+	return r.Fetch(ctx, id)
+}
+
+// Fetch reads the image directly from the containers-storage graph root, falling back to "podman image save" (e.g.
+// when the storage root cannot be read or a graph driver other than overlay is in use).
+func (r *resolver) Fetch(ctx context.Context, id string) (*image.Image, error) {
+	img, storageErr := r.resolveFromStorage(ctx, id)
+	if storageErr == nil {
+		return img, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("unable to resolve image '%s': %w", id, err)
+	}
+
+	if !isPodmanClientBinaryAvailable() {
+		return nil, fmt.Errorf("unable to resolve image '%s': %w", id, storageErr)
+	}
+
+	img, err := r.resolveFromDockerArchive(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve image '%s': %v (from containers-storage: %v)", id, err, storageErr)
+	}
+	return img, nil
 }
 
-func (r *resolver) Fetch(id string) (*image.Image, error) {
-	// todo: add podman fetch attempt via varlink first...
+func (r *resolver) resolveFromStorage(ctx context.Context, id string) (*image.Image, error) {
+	root := r.options.ContainersStorageRoot
+	if root == "" {
+		root = defaultStorageRoot()
+	}
+	storage := containersStorage{root: root}
+
+	storageImg, err := storage.image(id)
+	if err != nil {
+		return nil, err
+	}
+
+	layers, err := storage.layerChain(storageImg)
+	if err != nil {
+		return nil, err
+	}
+
+	configKey, err := storageConfigKey(storage, storageImg)
+	if err != nil {
+		return nil, err
+	}
 
-	img, err := r.resolveFromDockerArchive(id)
-	if err == nil {
-		return img, err
+	archive, err := docker.NewImageArchiveFromBlobs(ctx, configKey, layers, func(name string) (io.ReadCloser, error) {
+		if name == configKey {
+			content, err := storage.bigData(storageImg, configKey)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read image config: %w", err)
+			}
+			return io.NopCloser(bytes.NewReader(content)), nil
+		}
+		return storage.layerTar(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := archive.CheckPlatform(r.options.Platform); err != nil {
+		return nil, err
 	}
+	return archive.ToImage()
+}
 
-	return nil, fmt.Errorf("unable to resolve image '%s': %+v", id, err)
+// storageConfigKey returns the big data key of the image config, which is the config digest named by the image
+// manifest (for images that have been pulled or built, this is also the image ID).
+func storageConfigKey(storage containersStorage, img storageImage) (string, error) {
+	if content, err := storage.bigData(img, "manifest"); err == nil {
+		var m struct {
+			Config struct {
+				Digest string `json:"digest"`
+			} `json:"config"`
+		}
+		if err := json.Unmarshal(content, &m); err == nil && m.Config.Digest != "" {
+			return m.Config.Digest, nil
+		}
+	}
+	return "sha256:" + img.ID, nil
 }
 
-func (r *resolver) resolveFromDockerArchive(id string) (*image.Image, error) {
-	err, reader := streamPodmanCmd("image", "save", id)
+func (r *resolver) resolveFromDockerArchive(ctx context.Context, id string) (*image.Image, error) {
+	reader, err := streamPodmanCmd(ctx, "image", "save", id)
 	if err != nil {
 		return nil, err
 	}
+	defer reader.Close()
 
-	img, err := docker.NewImageArchive(io.NopCloser(reader))
+	img, err := docker.NewImageArchive(ctx, reader)
 	if err != nil {
 		return nil, err
 	}
+	if err := img.CheckPlatform(r.options.Platform); err != nil {
+		return nil, err
+	}
 	return img.ToImage()
 }
@@ -0,0 +1,435 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package podman
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// storageDriver is the only containers-storage graph driver supported (it is the default for podman)
+	storageDriver = "overlay"
+
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// storageImage is an entry of overlay-images/images.json
+type storageImage struct {
+	ID       string   `json:"id"`
+	Names    []string `json:"names,omitempty"`
+	TopLayer string   `json:"layer"`
+}
+
+// storageLayer is an entry of overlay-layers/layers.json
+type storageLayer struct {
+	ID     string `json:"id"`
+	Parent string `json:"parent,omitempty"`
+}
+
+// containersStorage reads images straight out of a containers-storage graph root (as used by podman, buildah, and
+// cri-o) without needing the podman binary or service.
+type containersStorage struct {
+	root string
+}
+
+// defaultStorageRoot returns the graph root configured in storage.conf, falling back to the podman defaults
+// (/var/lib/containers/storage for root, ~/.local/share/containers/storage for rootless users).
+func defaultStorageRoot() string {
+	rootless := os.Geteuid() != 0
+
+	var confPaths []string
+	if conf := os.Getenv("CONTAINERS_STORAGE_CONF"); conf != "" {
+		confPaths = append(confPaths, conf)
+	}
+	if rootless {
+		if configHome, err := os.UserConfigDir(); err == nil {
+			confPaths = append(confPaths, filepath.Join(configHome, "containers", "storage.conf"))
+		}
+	} else {
+		confPaths = append(confPaths, "/etc/containers/storage.conf", "/usr/share/containers/storage.conf")
+	}
+	for _, confPath := range confPaths {
+		if root := graphRootFromConf(confPath); root != "" {
+			return root
+		}
+	}
+
+	if !rootless {
+		return "/var/lib/containers/storage"
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, _ := os.UserHomeDir()
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "containers", "storage")
+}
+
+// graphRootFromConf returns the graphroot setting of the given storage.conf (if any)
+func graphRootFromConf(confPath string) string {
+	f, err := os.Open(confPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if found && strings.TrimSpace(key) == "graphroot" {
+			return os.ExpandEnv(strings.Trim(strings.TrimSpace(value), `"'`))
+		}
+	}
+	return ""
+}
+
+func (s containersStorage) readJSON(relPath string, v interface{}) error {
+	content, err := os.ReadFile(filepath.Join(s.root, relPath))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("unable to parse %s: %w", relPath, err)
+	}
+	return nil
+}
+
+// image finds an image by ID (or unique ID prefix) or by name. Names are matched as given and in their qualified forms,
+// as podman stores them (e.g. "alpine" is stored as "docker.io/library/alpine:latest", a local build of "app" as
+// "localhost/app:latest").
+func (s containersStorage) image(id string) (storageImage, error) {
+	var images []storageImage
+	if err := s.readJSON(filepath.Join(storageDriver+"-images", "images.json"), &images); err != nil {
+		return storageImage{}, fmt.Errorf("unable to read containers-storage images: %w", err)
+	}
+
+	candidates := storageImageNames(id)
+	for _, img := range images {
+		for _, name := range img.Names {
+			for _, candidate := range candidates {
+				if name == candidate {
+					return img, nil
+				}
+			}
+		}
+	}
+
+	var matches []storageImage
+	for _, img := range images {
+		if strings.HasPrefix(img.ID, strings.TrimPrefix(id, "sha256:")) {
+			matches = append(matches, img)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return storageImage{}, fmt.Errorf("could not find image %q in %s", id, s.root)
+	}
+	return storageImage{}, fmt.Errorf("image ID %q is ambiguous", id)
+}
+
+func storageImageNames(id string) []string {
+	name := id
+	if !strings.Contains(name[strings.LastIndex(name, "/")+1:], ":") && !strings.Contains(name, "@") {
+		name += ":latest"
+	}
+	names := []string{id, name}
+	if !strings.Contains(name, "/") {
+		names = append(names, "docker.io/library/"+name, "localhost/"+name)
+	} else if first := name[:strings.Index(name, "/")]; !strings.ContainsAny(first, ".:") && first != "localhost" {
+		names = append(names, "docker.io/"+name)
+	}
+	return names
+}
+
+// bigData reads a named blob stored alongside the image metadata (e.g. the manifest or config)
+func (s containersStorage) bigData(img storageImage, key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.root, storageDriver+"-images", img.ID, bigDataFileName(key)))
+}
+
+// bigDataFileName mirrors how containers-storage names big data files: keys with characters other than lowercase
+// letters, digits, and dots are base64 encoded (prefixed with "=").
+func bigDataFileName(key string) string {
+	for _, ch := range key {
+		if ch != '.' && !(ch >= '0' && ch <= '9') && !(ch >= 'a' && ch <= 'z') {
+			return "=" + base64.StdEncoding.EncodeToString([]byte(key))
+		}
+	}
+	return key
+}
+
+// layerChain returns the IDs of the layers of the given image, from the base layer up.
+func (s containersStorage) layerChain(img storageImage) ([]string, error) {
+	var layers []storageLayer
+	if err := s.readJSON(filepath.Join(storageDriver+"-layers", "layers.json"), &layers); err != nil {
+		return nil, fmt.Errorf("unable to read containers-storage layers: %w", err)
+	}
+
+	byID := make(map[string]storageLayer)
+	for _, layer := range layers {
+		byID[layer.ID] = layer
+	}
+
+	var chain []string
+	for id := img.TopLayer; id != ""; {
+		layer, exists := byID[id]
+		if !exists {
+			return nil, fmt.Errorf("could not find layer %q of image %q", id, img.ID)
+		}
+		if len(chain) > len(layers) {
+			return nil, fmt.Errorf("layers of image %q form a cycle", img.ID)
+		}
+		chain = append([]string{id}, chain...)
+		id = layer.Parent
+	}
+	return chain, nil
+}
+
+// layerTar streams the contents of the given layer (the overlay diff directory) as a tarball. The original tar headers
+// are used when containers-storage kept them (as tar-split data), otherwise the tarball is rebuilt from the directory,
+// converting overlay whiteouts (0/0 character devices and opaque directories) to their tar representation.
+func (s containersStorage) layerTar(id string) (io.ReadCloser, error) {
+	diffDir := filepath.Join(s.root, storageDriver, id, "diff")
+	if _, err := os.Stat(diffDir); err != nil {
+		return nil, fmt.Errorf("unable to read layer %q: %w", id, err)
+	}
+
+	tarSplit, err := os.Open(filepath.Join(s.root, storageDriver+"-layers", id+".tar-split.gz"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("unable to read layer %q: %w", id, err)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		if tarSplit == nil {
+			writer.CloseWithError(writeDirTar(diffDir, writer))
+			return
+		}
+		defer tarSplit.Close()
+		writer.CloseWithError(writeTarSplit(tarSplit, diffDir, writer))
+	}()
+	return reader, nil
+}
+
+// tarSplitEntry is an entry of the tar-split data of a layer: either a segment of the original tarball (the headers
+// and padding), or a file whose contents are within the diff directory.
+type tarSplitEntry struct {
+	Type    int    `json:"type"`
+	Name    string `json:"name,omitempty"`
+	NameRaw []byte `json:"name_raw,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	Payload []byte `json:"payload"`
+}
+
+const (
+	tarSplitFile = 1 + iota
+	tarSplitSegment
+)
+
+// writeTarSplit reassembles the original tarball of a layer from its (gzipped) tar-split data and diff directory.
+func writeTarSplit(r io.Reader, diffDir string, w io.Writer) error {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("unable to read tar-split data: %w", err)
+	}
+	defer gzipReader.Close()
+
+	decoder := json.NewDecoder(gzipReader)
+	for {
+		var entry tarSplitEntry
+		if err := decoder.Decode(&entry); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("unable to read tar-split data: %w", err)
+		}
+
+		switch entry.Type {
+		case tarSplitSegment:
+			if _, err := w.Write(entry.Payload); err != nil {
+				return err
+			}
+		case tarSplitFile:
+			if entry.Size == 0 {
+				continue
+			}
+			name := entry.Name
+			if entry.NameRaw != nil {
+				name = string(entry.NameRaw)
+			}
+			if err := copyDiffFile(diffDir, name, entry.Size, w); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected tar-split entry type %d", entry.Type)
+		}
+	}
+}
+
+// copyDiffFile writes the given number of bytes of the contents of the named file within the diff directory.
+func copyDiffFile(diffDir, name string, size int64, w io.Writer) error {
+	relPath := filepath.Clean(filepath.FromSlash(name))
+	if !filepath.IsLocal(relPath) {
+		return fmt.Errorf("tar-split entry %q is outside of the layer", name)
+	}
+	realPath := filepath.Join(diffDir, relPath)
+	f, err := os.Open(realPath)
+	if err != nil {
+		return fmt.Errorf("unable to read %s (rootless storage may need 'podman unshare'): %w", realPath, err)
+	}
+	defer f.Close()
+	if _, err := io.CopyN(w, f, size); err != nil {
+		return fmt.Errorf("unable to read %s: %w", realPath, err)
+	}
+	return nil
+}
+
+// inode identifies a file on disk (inode numbers are only unique within a device).
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+func writeDirTar(root string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	// hard links are written as links to the first path seen for the same inode
+	inodes := make(map[inode]string)
+
+	err := filepath.WalkDir(root, func(realPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, realPath)
+		if err != nil || relPath == "." {
+			return err
+		}
+		name := filepath.ToSlash(relPath)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		stat, _ := info.Sys().(*syscall.Stat_t)
+
+		if info.Mode()&fs.ModeCharDevice != 0 && stat != nil && stat.Rdev == 0 {
+			return tw.WriteHeader(&tar.Header{
+				Name:     path.Join(path.Dir(name), whiteoutPrefix+path.Base(name)),
+				Typeflag: tar.TypeReg,
+				Mode:     0600,
+			})
+		}
+
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(realPath); err != nil {
+				return err
+			}
+		}
+
+		// (the owner names are looked up on the host, as the diff directory does not record them)
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		addXattrs(header, realPath)
+
+		if info.Mode().IsRegular() && stat != nil && stat.Nlink > 1 {
+			key := inode{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}
+			if first, exists := inodes[key]; exists {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = first
+				header.Size = 0
+			} else {
+				inodes[key] = name
+			}
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if info.IsDir() && isOpaqueDir(realPath) {
+			return tw.WriteHeader(&tar.Header{
+				Name:     path.Join(name, opaqueWhiteout),
+				Typeflag: tar.TypeReg,
+				Mode:     0600,
+			})
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		f, err := os.Open(realPath)
+		if err != nil {
+			return fmt.Errorf("unable to read %s (rootless storage may need 'podman unshare'): %w", realPath, err)
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// addXattrs records the extended attributes of the given file in the PAX records of its header, leaving out the
+// attributes overlay keeps for itself (e.g. whether a directory is opaque).
+func addXattrs(header *tar.Header, realPath string) {
+	// (extended attributes may not be supported by the file system)
+	size, err := unix.Llistxattr(realPath, nil)
+	if err != nil || size == 0 {
+		return
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(realPath, buf); err != nil {
+		return
+	}
+
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		if name == "" || strings.HasPrefix(name, "trusted.overlay.") || strings.HasPrefix(name, "user.overlay.") {
+			continue
+		}
+		valueSize, err := unix.Lgetxattr(realPath, name, nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, valueSize)
+		if valueSize, err = unix.Lgetxattr(realPath, name, value); err != nil {
+			continue
+		}
+		if header.PAXRecords == nil {
+			header.PAXRecords = make(map[string]string)
+		}
+		header.PAXRecords["SCHILY.xattr."+name] = string(value[:valueSize])
+	}
+}
+
+// isOpaqueDir indicates if the given overlay directory hides the contents of the same directory in lower layers
+func isOpaqueDir(dirPath string) bool {
+	buf := make([]byte, 1)
+	for _, attr := range []string{"trusted.overlay.opaque", "user.overlay.opaque"} {
+		if n, err := unix.Getxattr(dirPath, attr, buf); err == nil && n == 1 && buf[0] == 'y' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,325 @@
+//go:build linux
+// +build linux
+
+package podman
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/wagoodman/dive/dive/image"
+	"github.com/wagoodman/dive/dive/image/docker"
+)
+
+// extractLayer unpacks a layer tarball as an overlay diff directory (whiteouts become 0/0 character devices when
+// permitted, otherwise they are left as ".wh." files)
+func extractLayer(t *testing.T, reader io.Reader, diffDir string) {
+	docker.TestExtractTar(t, reader, diffDir, func(header *tar.Header, target string) bool {
+		base := filepath.Base(header.Name)
+		if !strings.HasPrefix(base, whiteoutPrefix) || base == opaqueWhiteout {
+			return false
+		}
+		whiteout := filepath.Join(filepath.Dir(target), strings.TrimPrefix(base, whiteoutPrefix))
+		return unix.Mknod(whiteout, unix.S_IFCHR|0600, 0) == nil
+	})
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	reader io.Reader
+	count  int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += n
+	return n, err
+}
+
+// testTarSplit writes the tar-split data of the given layer tarball (as containers-storage keeps it).
+func testTarSplit(t *testing.T, layer []byte, target string) {
+	f, err := os.Create(target)
+	if err != nil {
+		t.Fatalf("unable to create tar-split data: %v", err)
+	}
+	defer f.Close()
+	gzipWriter := gzip.NewWriter(f)
+	encoder := json.NewEncoder(gzipWriter)
+
+	counter := &countingReader{reader: bytes.NewReader(layer)}
+	tarReader := tar.NewReader(counter)
+	position := 0
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to read layer: %v", err)
+		}
+		// the segment holds the padding of the previous file and the (possibly PAX extended) header
+		if err := encoder.Encode(tarSplitEntry{Type: tarSplitSegment, Payload: layer[position:counter.count]}); err != nil {
+			t.Fatalf("unable to write tar-split data: %v", err)
+		}
+		if err := encoder.Encode(tarSplitEntry{Type: tarSplitFile, Name: header.Name, Size: header.Size}); err != nil {
+			t.Fatalf("unable to write tar-split data: %v", err)
+		}
+		if _, err := io.Copy(io.Discard, tarReader); err != nil {
+			t.Fatalf("unable to read layer: %v", err)
+		}
+		position = counter.count
+	}
+	if err := encoder.Encode(tarSplitEntry{Type: tarSplitSegment, Payload: layer[position:]}); err != nil {
+		t.Fatalf("unable to write tar-split data: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("unable to write tar-split data: %v", err)
+	}
+}
+
+// testStorageFromArchive lays out a containers-storage graph root (overlay driver) holding the image of the given
+// docker-archive, named "localhost/dive-test:latest". The layers keep their tar-split data if requested.
+func testStorageFromArchive(t *testing.T, tarPath string, tarSplit bool) string {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "overlay-layers"), 0755); err != nil {
+		t.Fatalf("unable to create dir: %v", err)
+	}
+
+	f, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatalf("unable to open archive: %v", err)
+	}
+	defer f.Close()
+
+	var manifests []struct {
+		Config string
+		Layers []string
+	}
+	configs := make(map[string][]byte)
+	layerIDs := make(map[string]string)
+
+	tarReader := tar.NewReader(f)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to read archive: %v", err)
+		}
+		switch {
+		case strings.HasSuffix(header.Name, ".tar"):
+			id := fmt.Sprintf("%x", sha256.Sum256([]byte(header.Name)))
+			layerIDs[header.Name] = id
+			layer, err := io.ReadAll(tarReader)
+			if err != nil {
+				t.Fatalf("unable to read layer: %v", err)
+			}
+			extractLayer(t, bytes.NewReader(layer), filepath.Join(root, storageDriver, id, "diff"))
+			if tarSplit {
+				testTarSplit(t, layer, filepath.Join(root, "overlay-layers", id+".tar-split.gz"))
+			}
+		case header.Name == "manifest.json":
+			content, _ := io.ReadAll(tarReader)
+			if err := json.Unmarshal(content, &manifests); err != nil {
+				t.Fatalf("unable to parse manifest: %v", err)
+			}
+		case strings.HasSuffix(header.Name, ".json"):
+			configs[header.Name], _ = io.ReadAll(tarReader)
+		}
+	}
+
+	config := configs[manifests[0].Config]
+	imageID := fmt.Sprintf("%x", sha256.Sum256(config))
+
+	var layers []storageLayer
+	parent := ""
+	for _, layerPath := range manifests[0].Layers {
+		layers = append(layers, storageLayer{ID: layerIDs[layerPath], Parent: parent})
+		parent = layerIDs[layerPath]
+	}
+
+	writeJSON := func(relPath string, v interface{}) {
+		content, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("unable to marshal %s: %v", relPath, err)
+		}
+		target := filepath.Join(root, relPath)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatalf("unable to create dir: %v", err)
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			t.Fatalf("unable to write %s: %v", relPath, err)
+		}
+	}
+
+	writeJSON("overlay-layers/layers.json", layers)
+	writeJSON("overlay-images/images.json", []storageImage{{ID: imageID, Names: []string{"localhost/dive-test:latest"}, TopLayer: parent}})
+	writeJSON("overlay-images/"+imageID+"/manifest", map[string]interface{}{
+		"schemaVersion": 2,
+		"config":        map[string]string{"digest": "sha256:" + imageID},
+	})
+	configFile := "=" + base64.StdEncoding.EncodeToString([]byte("sha256:"+imageID))
+	if err := os.WriteFile(filepath.Join(root, "overlay-images", imageID, configFile), config, 0644); err != nil {
+		t.Fatalf("unable to write config: %v", err)
+	}
+
+	return root
+}
+
+func Test_ResolveFromStorage(t *testing.T) {
+	for _, tarSplit := range []bool{false, true} {
+		root := testStorageFromArchive(t, "../../../.data/test-docker-image.tar", tarSplit)
+		resolver := NewResolverFromEngine(image.ResolverOptions{ContainersStorageRoot: root})
+
+		for _, id := range []string{"dive-test", "localhost/dive-test:latest"} {
+			name := fmt.Sprintf("%s (tar-split=%v)", id, tarSplit)
+			img, err := resolver.resolveFromStorage(context.Background(), id)
+			if err != nil {
+				t.Fatalf("%s: unable to resolve image: %v", name, err)
+			}
+
+			result, err := img.Analyze()
+			if err != nil {
+				t.Fatalf("%s: unable to analyze: %v", name, err)
+			}
+			docker.TestCheckAnalysis(t, name, result)
+			if result.Layers[13].Command != "chmod +x /root/saved.txt" {
+				t.Errorf("%s: unexpected command for last layer: %q", name, result.Layers[13].Command)
+			}
+		}
+	}
+}
+
+func Test_LayerTar_TarSplit(t *testing.T) {
+	// the original headers (owner names, extended attributes) are only kept by the tar-split data
+	var layer bytes.Buffer
+	tw := tar.NewWriter(&layer)
+	for _, entry := range []struct {
+		header  *tar.Header
+		content string
+	}{
+		{header: &tar.Header{Name: "./etc/", Typeflag: tar.TypeDir, Mode: 0755, Uname: "root", Gname: "root"}},
+		{header: &tar.Header{Name: "./etc/app.conf", Typeflag: tar.TypeReg, Mode: 0644, Size: 5, Uid: 1000, Uname: "app", Gname: "app",
+			PAXRecords: map[string]string{"SCHILY.xattr.user.origin": "build"}}, content: "dive\n"},
+		{header: &tar.Header{Name: "./etc/app.link", Typeflag: tar.TypeLink, Linkname: "./etc/app.conf"}},
+		{header: &tar.Header{Name: "./etc/.wh.old.conf", Typeflag: tar.TypeReg, Mode: 0600}},
+	} {
+		if err := tw.WriteHeader(entry.header); err != nil {
+			t.Fatalf("unable to write layer: %v", err)
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("unable to write layer: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("unable to write layer: %v", err)
+	}
+
+	root := t.TempDir()
+	id := "layer"
+	extractLayer(t, bytes.NewReader(layer.Bytes()), filepath.Join(root, storageDriver, id, "diff"))
+	if err := os.MkdirAll(filepath.Join(root, "overlay-layers"), 0755); err != nil {
+		t.Fatalf("unable to create dir: %v", err)
+	}
+	testTarSplit(t, layer.Bytes(), filepath.Join(root, "overlay-layers", id+".tar-split.gz"))
+
+	reader, err := containersStorage{root: root}.layerTar(id)
+	if err != nil {
+		t.Fatalf("unable to read layer: %v", err)
+	}
+	defer reader.Close()
+	actual, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("unable to read layer: %v", err)
+	}
+	if !bytes.Equal(actual, layer.Bytes()) {
+		t.Errorf("expected the original layer tarball (%d bytes), got %d bytes", layer.Len(), len(actual))
+	}
+}
+
+func Test_WriteDirTar(t *testing.T) {
+	diffDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(diffDir, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(diffDir, "etc", "app.conf")
+	if err := os.WriteFile(conf, []byte("dive\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(conf, filepath.Join(diffDir, "etc", "app.link")); err != nil {
+		t.Fatal(err)
+	}
+	xattrs := unix.Setxattr(conf, "user.origin", []byte("build"), 0) == nil
+	overlayXattrs := unix.Setxattr(filepath.Join(diffDir, "etc"), "user.overlay.opaque", []byte("y"), 0) == nil
+
+	var layer bytes.Buffer
+	if err := writeDirTar(diffDir, &layer); err != nil {
+		t.Fatalf("unable to write layer: %v", err)
+	}
+	headers := make(map[string]*tar.Header)
+	tarReader := tar.NewReader(&layer)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to read layer: %v", err)
+		}
+		headers[header.Name] = header
+	}
+
+	if link := headers["etc/app.link"]; link == nil || link.Typeflag != tar.TypeLink || link.Linkname != "etc/app.conf" {
+		t.Errorf("expected a hard link to etc/app.conf, got %+v", link)
+	}
+	if !xattrs {
+		t.Skip("extended attributes are not supported by the file system")
+	}
+	if origin := headers["etc/app.conf"].PAXRecords["SCHILY.xattr.user.origin"]; origin != "build" {
+		t.Errorf("expected the extended attributes of the file, got %v", headers["etc/app.conf"].PAXRecords)
+	}
+	if overlayXattrs {
+		if _, exists := headers["etc"].PAXRecords["SCHILY.xattr.user.overlay.opaque"]; exists {
+			t.Errorf("expected the overlay attributes to be left out, got %v", headers["etc"].PAXRecords)
+		}
+		if headers["etc/"+opaqueWhiteout] == nil {
+			t.Errorf("expected an opaque whiteout for etc/")
+		}
+	}
+}
+
+func Test_ResolveFromStorage_UnknownImage(t *testing.T) {
+	root := testStorageFromArchive(t, "../../../.data/test-docker-image.tar", false)
+
+	_, err := NewResolverFromEngine(image.ResolverOptions{ContainersStorageRoot: root}).resolveFromStorage(context.Background(), "nope")
+	if err == nil || !strings.Contains(err.Error(), `could not find image "nope"`) {
+		t.Errorf("expected an error for an unknown image, got %v", err)
+	}
+}
+
+func Test_BigDataFileName(t *testing.T) {
+	table := map[string]string{
+		"manifest":       "manifest",
+		"sha256:abc":     "=" + base64.StdEncoding.EncodeToString([]byte("sha256:abc")),
+		"signature-1.sh": "=" + base64.StdEncoding.EncodeToString([]byte("signature-1.sh")),
+	}
+	for key, expected := range table {
+		if actual := bigDataFileName(key); actual != expected {
+			t.Errorf("%s: expected %q, got %q", key, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package image
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Progress is a snapshot of how far along fetching and parsing an image is.
+type Progress struct {
+	// BytesRead is the number of image bytes read so far (as stored, e.g. compressed), out of BytesTotal (zero when
+	// the total is unknown)
+	BytesRead  int64
+	BytesTotal int64
+	// Layers is the number of layers parsed so far, out of LayersTotal (zero when the total is unknown)
+	Layers      int
+	LayersTotal int
+}
+
+// ProgressTracker collects the progress of a fetch, passing a snapshot to the report function on every update. A nil
+// tracker ignores all updates, so resolvers may report progress unconditionally.
+type ProgressTracker struct {
+	lock     sync.Mutex
+	progress Progress
+	report   func(Progress)
+}
+
+type progressTrackerKey struct{}
+
+func NewProgressTracker(report func(Progress)) *ProgressTracker {
+	return &ProgressTracker{
+		report: report,
+	}
+}
+
+// WithProgressTracker attaches the tracker to the context, so that resolvers fetching with the context report their
+// progress to it.
+func WithProgressTracker(ctx context.Context, tracker *ProgressTracker) context.Context {
+	return context.WithValue(ctx, progressTrackerKey{}, tracker)
+}
+
+// ProgressTrackerFrom returns the tracker attached to the context (nil when there is none).
+func ProgressTrackerFrom(ctx context.Context) *ProgressTracker {
+	tracker, _ := ctx.Value(progressTrackerKey{}).(*ProgressTracker)
+	return tracker
+}
+
+func (t *ProgressTracker) update(fn func(p *Progress)) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	fn(&t.progress)
+	snapshot := t.progress
+	t.lock.Unlock()
+
+	t.report(snapshot)
+}
+
+// SetBytesTotal records the number of bytes that will be read to fetch the image.
+func (t *ProgressTracker) SetBytesTotal(total int64) {
+	t.update(func(p *Progress) { p.BytesTotal = total })
+}
+
+// SetLayersTotal records the number of layers the image has.
+func (t *ProgressTracker) SetLayersTotal(total int) {
+	t.update(func(p *Progress) { p.LayersTotal = total })
+}
+
+// LayerParsed records that another layer has been parsed.
+func (t *ProgressTracker) LayerParsed() {
+	t.update(func(p *Progress) { p.Layers++ })
+}
+
+// BytesSkipped records that the given number of bytes will not be read after all (e.g. a layer blob that is found in
+// the layer cache), counting them as read.
+func (t *ProgressTracker) BytesSkipped(size int64) {
+	t.update(func(p *Progress) { p.BytesRead += size })
+}
+
+// Reader counts the bytes read through the given reader towards the progress.
+func (t *ProgressTracker) Reader(reader io.Reader) io.Reader {
+	if t == nil {
+		return reader
+	}
+	return progressReader{tracker: t, reader: reader}
+}
+
+type progressReader struct {
+	tracker *ProgressTracker
+	reader  io.Reader
+}
+
+func (r progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.tracker.update(func(p *Progress) { p.BytesRead += int64(n) })
+	}
+	return n, err
+}
@@ -1,6 +1,48 @@
 package image
 
+import (
+	"context"
+	"io"
+)
+
+// Resolver fetches (or builds) an image. Resolvers stop fetching and parsing the image as soon as the given context is
+// done, returning the context error (wrapped) in that case.
 type Resolver interface {
-	Fetch(id string) (*Image, error)
-	Build(options []string) (*Image, error)
+	Fetch(ctx context.Context, id string) (*Image, error)
+	Build(ctx context.Context, options []string) (*Image, error)
+}
+
+// MultiResolver is implemented by resolvers whose sources can hold several images (e.g. a "docker save" archive of
+// multiple images), allowing every image to be fetched at once.
+type MultiResolver interface {
+	FetchAll(ctx context.Context, id string) ([]*Image, error)
+}
+
+// ResolverOptions are the user-provided settings that affect how a Resolver fetches an image.
+type ResolverOptions struct {
+	// Platform selects an image from a multi-platform index (nil selects the host platform)
+	Platform *Platform
+	// ContainerdCtrAddress is the containerd socket the "ctr" CLI reads images through (empty uses the "ctr" default).
+	// Reading from a running containerd needs the "ctr" CLI.
+	ContainerdCtrAddress string
+	// ContainerdRoot reads the containerd content store from disk instead of through the "ctr" CLI (either the
+	// containerd root directory or its content directory)
+	ContainerdRoot string
+	// ContainersStorageRoot is the containers-storage graph root podman images are read from (empty uses the
+	// podman default for the current user)
+	ContainersStorageRoot string
+	// Output receives notices and the output of container engine commands run while fetching (e.g. "docker pull").
+	// Nil discards them.
+	Output io.Writer
+	// Interactive runs container engine commands in the current tty instead (e.g. to show the progress of "docker
+	// pull" as the docker CLI does), leaving only the notices to Output.
+	Interactive bool
+}
+
+// OutputOrDiscard returns the configured output, or a writer that discards everything when there is none.
+func (o ResolverOptions) OutputOrDiscard() io.Writer {
+	if o.Output == nil {
+		return io.Discard
+	}
+	return o.Output
 }
@@ -0,0 +1,229 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/afero"
+
+	"github.com/wagoodman/dive/dive"
+	"github.com/wagoodman/dive/dive/analysis"
+	"github.com/wagoodman/dive/dive/filetree"
+	"github.com/wagoodman/dive/dive/image"
+	"github.com/wagoodman/dive/runtime/export"
+	"github.com/wagoodman/dive/runtime/ui"
+	"github.com/wagoodman/dive/utils"
+)
+
+// DiffOptions are the settings for comparing two images, where Options describes the first image (and the settings
+// shared by both). The differences are written to Options.ExportFile (as JSON) when given, shown in the interactive
+// UI when Interactive is set, and otherwise printed.
+type DiffOptions struct {
+	Options
+	// OtherImage and OtherSource are the image compared against the first image, and its source
+	OtherImage  string
+	OtherSource dive.ImageSource
+	// Interactive shows the differences in the file tree view of the UI
+	Interactive bool
+}
+
+func runDiff(ctx context.Context, enableUi bool, options DiffOptions, resolver, otherResolver image.Resolver, events eventChannel, filesystem afero.Fs) {
+	defer close(events)
+
+	before := options.Source.String() + "://" + options.Image
+	after := options.OtherSource.String() + "://" + options.OtherImage
+
+	reporter := newProgressReporter(events, progressEventInterval)
+	fetch := func(resolver image.Resolver, ref, name string) (*image.Image, bool) {
+		events.message(utils.TitleFormat(fmt.Sprintf("Fetching image (%s)...", name)))
+		ctx := image.WithProgressTracker(ctx, image.NewProgressTracker(func(p image.Progress) {
+			reporter.report(newFetchProgress(p))
+		}))
+		ctx = image.WithFileDigests(ctx, options.FileDigests)
+		ctx = image.WithJobs(ctx, options.Jobs)
+		ctx = image.WithLayerCache(ctx, options.layerCache())
+		img, err := resolver.Fetch(ctx, ref)
+		if err != nil {
+			events.exitWithErrorMessage("cannot fetch image", interruption(ctx, options.Options, err))
+			return nil, false
+		}
+		return img, true
+	}
+
+	imgBefore, ok := fetch(resolver, options.Image, before)
+	if !ok {
+		return
+	}
+	imgAfter, ok := fetch(otherResolver, options.OtherImage, after)
+	if !ok {
+		return
+	}
+
+	events.message(utils.TitleFormat("Comparing images..."))
+	result, err := analysis.Diff(imgBefore, imgAfter)
+	if err != nil {
+		events.exitWithErrorMessage("cannot compare images", err)
+		return
+	}
+	if len(result.PathErrors) > 0 {
+		for _, pathError := range result.PathErrors {
+			events.message("  " + pathError.String())
+		}
+		if !options.IgnoreErrors {
+			events.exitWithError(fmt.Errorf("file tree has path errors (use '--ignore-errors' to attempt to continue)"))
+			return
+		}
+	}
+
+	if options.ExportFile != "" {
+		events.message(utils.TitleFormat(fmt.Sprintf("Exporting differences to '%s'...", options.ExportFile)))
+		writeExport(export.NewDiffExport(before, after, result).Marshal, options.ExportFile, events, filesystem)
+		return
+	}
+
+	if !options.Interactive {
+		events.message(diffReport(result))
+		return
+	}
+
+	analysisAfter, err := imgAfter.Analyze()
+	if err != nil {
+		events.exitWithErrorMessage("cannot analyze image", err)
+		return
+	}
+	diffAnalysis := newDiffAnalysis(before, after, result, analysisAfter)
+
+	events.message(utils.TitleFormat("Building cache..."))
+	treeStack := filetree.NewComparer(diffAnalysis.RefTrees)
+	errors := treeStack.BuildCache(ctx, func(built, total int) {
+		reporter.report(progress{item: "cache entries", done: built, total: total})
+	})
+	if ctx.Err() != nil {
+		events.exitWithErrorMessage("cannot build cache", interruption(ctx, options.Options, ctx.Err()))
+		return
+	}
+	if errors != nil {
+		for _, err := range errors {
+			events.message("  " + err.Error())
+		}
+		if !options.IgnoreErrors {
+			events.exitWithError(fmt.Errorf("file tree has path errors (use '--ignore-errors' to attempt to continue)"))
+			return
+		}
+	}
+
+	if enableUi {
+		// see run() for why the UI is not started immediately
+		time.Sleep(100 * time.Millisecond)
+
+		err = ui.Run(after, diffAnalysis, treeStack)
+		if err != nil {
+			events.exitWithError(err)
+			return
+		}
+	}
+}
+
+// newDiffAnalysis presents the differences between two images as an image of two layers for the UI: the first image
+// as the base layer, and the changes made by the second image as the layer above it. The image details are those of
+// the second image.
+func newDiffAnalysis(before, after string, result *analysis.DiffResult, analysisAfter *image.AnalysisResult) *image.AnalysisResult {
+	var sizeBefore, sizeChanged uint64
+	_ = result.Lower.VisitDepthChildFirst(func(node *filetree.FileNode) error {
+		sizeBefore += uint64(node.Data.FileInfo.Size)
+		return nil
+	}, nil)
+	for _, changes := range [][]analysis.FileChange{result.Added, result.Modified} {
+		for _, change := range changes {
+			sizeChanged += uint64(change.SizeAfter)
+		}
+	}
+
+	layers := []*image.Layer{
+		{Id: before, Index: 0, Command: before, Size: sizeBefore, Tree: result.Lower, Names: []string{before}},
+		{Id: after, Index: 1, Command: after, Size: sizeChanged, Tree: result.Upper, Names: []string{after}},
+	}
+
+	return &image.AnalysisResult{
+		Layers:            layers,
+		RefTrees:          []*filetree.FileTree{result.Lower, result.Upper},
+		Efficiency:        analysisAfter.Efficiency,
+		SizeBytes:         analysisAfter.SizeBytes,
+		UserSizeByes:      analysisAfter.UserSizeByes,
+		WastedUserPercent: analysisAfter.WastedUserPercent,
+		WastedBytes:       analysisAfter.WastedBytes,
+		Inefficiencies:    analysisAfter.Inefficiencies,
+	}
+}
+
+// diffReport lists the files added, removed, and modified by the second image along with the change in size.
+func diffReport(result *analysis.DiffResult) string {
+	var sb strings.Builder
+	template := "%10s  %10s  %11s  %-s\n"
+
+	for _, section := range []struct {
+		title   string
+		changes []analysis.FileChange
+	}{
+		{title: "Added Files:", changes: result.Added},
+		{title: "Removed Files:", changes: result.Removed},
+		{title: "Modified Files:", changes: result.Modified},
+	} {
+		fmt.Fprintln(&sb, utils.TitleFormat(section.title))
+		if len(section.changes) == 0 {
+			fmt.Fprintln(&sb, "None")
+			continue
+		}
+
+		fmt.Fprintf(&sb, template, "Before", "After", "Size Change", "File Path")
+		for _, change := range section.changes {
+			sizeBefore, sizeAfter := "-", "-"
+			if change.Change != filetree.Added {
+				sizeBefore = humanize.Bytes(uint64(change.SizeBefore))
+			}
+			if change.Change != filetree.Removed {
+				sizeAfter = humanize.Bytes(uint64(change.SizeAfter))
+			}
+			fmt.Fprintf(&sb, template, sizeBefore, sizeAfter, formatSizeDelta(change.SizeDelta()), change.Path)
+		}
+	}
+
+	fmt.Fprintln(&sb, utils.TitleFormat("Summary:"))
+	fmt.Fprintf(&sb, "  added: %d, removed: %d, modified: %d, size change: %s",
+		len(result.Added), len(result.Removed), len(result.Modified), formatSizeDelta(result.SizeDelta()))
+	return sb.String()
+}
+
+func formatSizeDelta(delta int64) string {
+	switch {
+	case delta > 0:
+		return "+" + humanize.Bytes(uint64(delta))
+	case delta < 0:
+		return "-" + humanize.Bytes(uint64(-delta))
+	}
+	return "0 B"
+}
+
+// RunDiff compares two images (see DiffOptions), exiting once done.
+func RunDiff(options DiffOptions) {
+	resolver, err := dive.GetImageResolver(options.Source, options.resolverOptions())
+	if err != nil {
+		exitWithResolverError(err)
+	}
+	otherResolver, err := dive.GetImageResolver(options.OtherSource, options.resolverOptions())
+	if err != nil {
+		exitWithResolverError(err)
+	}
+
+	ctx, cancel := newRunContext(options.Options)
+	defer cancel()
+
+	var events = make(eventChannel)
+	go runDiff(ctx, true, options, resolver, otherResolver, events, afero.NewOsFs())
+
+	os.Exit(renderEvents(events))
+}
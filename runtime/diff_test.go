@@ -0,0 +1,150 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/lunixbochs/vtclean"
+	"github.com/spf13/afero"
+
+	"github.com/wagoodman/dive/dive"
+	"github.com/wagoodman/dive/dive/image"
+)
+
+// baseResolver resolves the first layers of the test image, as the base image of the test image would be
+type baseResolver struct {
+	defaultResolver
+}
+
+func (r *baseResolver) Fetch(ctx context.Context, id string) (*image.Image, error) {
+	img, err := r.defaultResolver.Fetch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	img.Trees, img.Layers = img.Trees[:7], img.Layers[:7]
+	return img, nil
+}
+
+func TestRunDiff(t *testing.T) {
+	table := map[string]struct {
+		resolver image.Resolver
+		options  DiffOptions
+		events   []string
+		errMsg   string
+	}{
+		"text-case": {
+			resolver: &baseResolver{},
+			options:  DiffOptions{},
+			events: []string{
+				"Fetching image (docker://dive-example:1)...",
+				"Fetching image (docker-archive://dive-example-2.tar)...",
+				"Comparing images...",
+				"Added Files:",
+			},
+		},
+		"identical-case": {
+			resolver: &defaultResolver{},
+			options:  DiffOptions{},
+			events: []string{
+				"Fetching image (docker://dive-example:1)...",
+				"Fetching image (docker-archive://dive-example-2.tar)...",
+				"Comparing images...",
+				"Added Files:\nNone\nRemoved Files:\nNone\nModified Files:\nNone\nSummary:\n  added: 0, removed: 0, modified: 0, size change: 0 B",
+			},
+		},
+		"export-case": {
+			resolver: &baseResolver{},
+			options:  DiffOptions{Options: Options{ExportFile: "diff.json"}},
+			events: []string{
+				"Fetching image (docker://dive-example:1)...",
+				"Fetching image (docker-archive://dive-example-2.tar)...",
+				"Comparing images...",
+				"Exporting differences to 'diff.json'...",
+			},
+		},
+		"interactive-case": {
+			resolver: &baseResolver{},
+			options:  DiffOptions{Interactive: true},
+			events: []string{
+				"Fetching image (docker://dive-example:1)...",
+				"Fetching image (docker-archive://dive-example-2.tar)...",
+				"Comparing images...",
+				"Building cache...",
+			},
+		},
+		"failed-fetch": {
+			resolver: &failedFetchResolver{},
+			options:  DiffOptions{},
+			events: []string{
+				"Fetching image (docker://dive-example:1)...",
+			},
+			errMsg: "some fetch failure",
+		},
+	}
+
+	for name, test := range table {
+		var ec = make(eventChannel)
+		var filesystem = afero.NewMemMapFs()
+		var stdout []string
+		var errMsg string
+
+		options := test.options
+		options.Image, options.Source = "dive-example:1", dive.SourceDockerEngine
+		options.OtherImage, options.OtherSource = "dive-example-2.tar", dive.SourceDockerArchive
+
+		go runDiff(context.Background(), false, options, test.resolver, &defaultResolver{}, ec, filesystem)
+
+		for event := range ec {
+			if event.progress != nil {
+				continue
+			}
+			if event.stdout != "" {
+				stdout = append(stdout, vtclean.Clean(event.stdout, false))
+			}
+			if event.err != nil {
+				errMsg = event.err.Error()
+			}
+		}
+
+		if errMsg != test.errMsg {
+			t.Errorf("%s: expected error '%s', got '%s'", name, test.errMsg, errMsg)
+		}
+		if len(stdout) != len(test.events) {
+			t.Fatalf("%s: expected events %q, got %q", name, test.events, stdout)
+		}
+		for idx, expected := range test.events {
+			if !strings.HasPrefix(stdout[idx], expected) {
+				t.Errorf("%s: expected event %q, got %q", name, expected, stdout[idx])
+			}
+		}
+
+		if name == "text-case" {
+			report := stdout[len(stdout)-1]
+			for _, expected := range []string{"/root/saved.txt", "Summary:\n  added: "} {
+				if !strings.Contains(report, expected) {
+					t.Errorf("%s: expected the report to contain %q, got:\n%s", name, expected, report)
+				}
+			}
+		}
+
+		if test.options.ExportFile != "" {
+			contents, err := afero.ReadFile(filesystem, test.options.ExportFile)
+			if err != nil {
+				t.Fatalf("%s: expected an export file: %v", name, err)
+			}
+			var exported struct {
+				Before string            `json:"before"`
+				After  string            `json:"after"`
+				Added  []json.RawMessage `json:"added"`
+			}
+			if err := json.Unmarshal(contents, &exported); err != nil {
+				t.Fatalf("%s: unable to parse export: %v", name, err)
+			}
+			if exported.Before != "docker://dive-example:1" || exported.After != "docker-archive://dive-example-2.tar" || len(exported.Added) == 0 {
+				t.Errorf("%s: unexpected export: %s", name, contents)
+			}
+		}
+	}
+}
@@ -7,6 +7,7 @@ type event struct {
 	stderr      string
 	err         error
 	errorOnExit bool
+	progress    *progress
 }
 
 func (ec eventChannel) message(msg string) {
@@ -15,6 +16,12 @@ func (ec eventChannel) message(msg string) {
 	}
 }
 
+func (ec eventChannel) progress(p progress) {
+	ec <- event{
+		progress: &p,
+	}
+}
+
 func (ec eventChannel) exitWithError(err error) {
 	ec <- event{
 		err:         err,
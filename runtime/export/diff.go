@@ -0,0 +1,58 @@
+package export
+
+import (
+	"encoding/json"
+
+	"github.com/wagoodman/dive/dive/analysis"
+)
+
+type diffExport struct {
+	Before         string       `json:"before"`
+	After          string       `json:"after"`
+	SizeDeltaBytes int64        `json:"sizeDeltaBytes"`
+	Added          []fileChange `json:"added"`
+	Removed        []fileChange `json:"removed"`
+	Modified       []fileChange `json:"modified"`
+}
+
+type fileChange struct {
+	Path            string `json:"file"`
+	SizeBeforeBytes int64  `json:"sizeBeforeBytes"`
+	SizeAfterBytes  int64  `json:"sizeAfterBytes"`
+	SizeDeltaBytes  int64  `json:"sizeDeltaBytes"`
+	DigestBefore    string `json:"digestBefore,omitempty"`
+	DigestAfter     string `json:"digestAfter,omitempty"`
+}
+
+// NewDiffExport describes the files changed between the images before and after (e.g. "docker://app:1.4" and
+// "docker://app:1.5").
+func NewDiffExport(before, after string, result *analysis.DiffResult) *diffExport {
+	return &diffExport{
+		Before:         before,
+		After:          after,
+		SizeDeltaBytes: result.SizeDelta(),
+		Added:          newFileChanges(result.Added),
+		Removed:        newFileChanges(result.Removed),
+		Modified:       newFileChanges(result.Modified),
+	}
+}
+
+func newFileChanges(changes []analysis.FileChange) []fileChange {
+	// always export a list (rather than null) when nothing changed
+	exported := make([]fileChange, len(changes))
+	for idx, change := range changes {
+		exported[idx] = fileChange{
+			Path:            change.Path,
+			SizeBeforeBytes: change.SizeBefore,
+			SizeAfterBytes:  change.SizeAfter,
+			SizeDeltaBytes:  change.SizeDelta(),
+			DigestBefore:    change.DigestBefore,
+			DigestAfter:     change.DigestAfter,
+		}
+	}
+	return exported
+}
+
+func (exp *diffExport) Marshal() ([]byte, error) {
+	return json.MarshalIndent(&exp, "", "  ")
+}
@@ -0,0 +1,63 @@
+package export
+
+import (
+	"testing"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+
+	"github.com/wagoodman/dive/dive/analysis"
+	"github.com/wagoodman/dive/dive/filetree"
+)
+
+func Test_DiffExport(t *testing.T) {
+	result := &analysis.DiffResult{
+		Added:    []analysis.FileChange{{Path: "/app/share/readme", Change: filetree.Added, SizeAfter: 50}},
+		Modified: []analysis.FileChange{{Path: "/app/bin", Change: filetree.Modified, SizeBefore: 500, SizeAfter: 800}},
+	}
+
+	payload, err := NewDiffExport("docker://app:1.4", "docker://app:1.5", result).Marshal()
+	if err != nil {
+		t.Errorf("Test_DiffExport: unable to export differences: %v", err)
+	}
+
+	expectedResult := `{
+  "before": "docker://app:1.4",
+  "after": "docker://app:1.5",
+  "sizeDeltaBytes": 350,
+  "added": [
+    {
+      "file": "/app/share/readme",
+      "sizeBeforeBytes": 0,
+      "sizeAfterBytes": 50,
+      "sizeDeltaBytes": 50
+    }
+  ],
+  "removed": [],
+  "modified": [
+    {
+      "file": "/app/bin",
+      "sizeBeforeBytes": 500,
+      "sizeAfterBytes": 800,
+      "sizeDeltaBytes": 300
+    }
+  ]
+}`
+	actualResult := string(payload)
+	if expectedResult != actualResult {
+		dmp := diffmatchpatch.New()
+		diffs := dmp.DiffMain(expectedResult, actualResult, false)
+
+		t.Errorf("Test_DiffExport: unexpected export result:\n%v", dmp.DiffPrettyText(diffs))
+	}
+}
+
+func Test_DiffExportDigests(t *testing.T) {
+	result := &analysis.DiffResult{
+		Modified: []analysis.FileChange{{Path: "/app/bin", Change: filetree.Modified, SizeBefore: 500, SizeAfter: 500, DigestBefore: "sha256:aaaa", DigestAfter: "sha256:bbbb"}},
+	}
+
+	modified := NewDiffExport("docker://app:1.4", "docker://app:1.5", result).Modified
+	if len(modified) != 1 || modified[0].DigestBefore != "sha256:aaaa" || modified[0].DigestAfter != "sha256:bbbb" {
+		t.Errorf("expected the digests to be exported, got %+v", modified)
+	}
+}
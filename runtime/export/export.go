@@ -1,8 +1,10 @@
 package export
 
 import (
+	"archive/tar"
 	"encoding/json"
 
+	"github.com/wagoodman/dive/dive/filetree"
 	diveImage "github.com/wagoodman/dive/dive/image"
 )
 
@@ -15,21 +17,24 @@ func NewExport(analysis *diveImage.AnalysisResult) *export {
 	data := export{
 		Layer: make([]layer, len(analysis.Layers)),
 		Image: image{
-			InefficientFiles: make([]fileReference, len(analysis.Inefficiencies)),
-			SizeBytes:        analysis.SizeBytes,
-			EfficiencyScore:  analysis.Efficiency,
-			InefficientBytes: analysis.WastedBytes,
+			InefficientFiles:    make([]fileReference, len(analysis.Inefficiencies)),
+			SizeBytes:           analysis.SizeBytes,
+			CompressedSizeBytes: analysis.CompressedSizeBytes,
+			EfficiencyScore:     analysis.Efficiency,
+			InefficientBytes:    analysis.WastedBytes,
 		},
 	}
 
 	// export layers in order
 	for idx, curLayer := range analysis.Layers {
 		data.Layer[idx] = layer{
-			Index:     curLayer.Index,
-			ID:        curLayer.Id,
-			DigestID:  curLayer.Digest,
-			SizeBytes: curLayer.Size,
-			Command:   curLayer.Command,
+			Index:               curLayer.Index,
+			ID:                  curLayer.Id,
+			DigestID:            curLayer.Digest,
+			SizeBytes:           curLayer.Size,
+			CompressedSizeBytes: curLayer.CompressedSize,
+			Command:             curLayer.Command,
+			Files:               fileDigests(curLayer.Tree),
 		}
 	}
 
@@ -47,6 +52,29 @@ func NewExport(analysis *diveImage.AnalysisResult) *export {
 	return &data
 }
 
+// fileDigests lists the regular files of the given layer tree that have a digest (sorted by path).
+func fileDigests(tree *filetree.FileTree) []fileDigest {
+	if tree == nil {
+		return nil
+	}
+	var files []fileDigest
+	visitor := func(node *filetree.FileNode) error {
+		info := node.Data.FileInfo
+		if info.Digest != "" && info.TypeFlag == tar.TypeReg {
+			files = append(files, fileDigest{
+				Path:      node.Path(),
+				SizeBytes: uint64(info.Size),
+				Digest:    info.Digest,
+			})
+		}
+		return nil
+	}
+	if err := tree.VisitDepthParentFirst(visitor, nil); err != nil {
+		return nil
+	}
+	return files
+}
+
 func (exp *export) Marshal() ([]byte, error) {
 	return json.MarshalIndent(&exp, "", "  ")
 }
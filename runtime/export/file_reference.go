@@ -5,3 +5,9 @@ type fileReference struct {
 	SizeBytes  uint64 `json:"sizeBytes"`
 	Path       string `json:"file"`
 }
+
+type fileDigest struct {
+	Path      string `json:"file"`
+	SizeBytes uint64 `json:"sizeBytes"`
+	Digest    string `json:"digest"`
+}
@@ -1,8 +1,10 @@
 package export
 
 type image struct {
-	SizeBytes        uint64          `json:"sizeBytes"`
-	InefficientBytes uint64          `json:"inefficientBytes"`
-	EfficiencyScore  float64         `json:"efficiencyScore"`
-	InefficientFiles []fileReference `json:"fileReference"`
+	SizeBytes uint64 `json:"sizeBytes"`
+	// CompressedSizeBytes is zero when the compressed size of any layer is unknown
+	CompressedSizeBytes uint64          `json:"compressedSizeBytes"`
+	InefficientBytes    uint64          `json:"inefficientBytes"`
+	EfficiencyScore     float64         `json:"efficiencyScore"`
+	InefficientFiles    []fileReference `json:"fileReference"`
 }
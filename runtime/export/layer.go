@@ -5,5 +5,9 @@ type layer struct {
 	ID        string `json:"id"`
 	DigestID  string `json:"digestId"`
 	SizeBytes uint64 `json:"sizeBytes"`
-	Command   string `json:"command"`
+	// CompressedSizeBytes is zero when the compressed size is unknown
+	CompressedSizeBytes uint64 `json:"compressedSizeBytes"`
+	Command             string `json:"command"`
+	// Files lists the regular files of the layer with their digests (only when file digests are computed)
+	Files []fileDigest `json:"files,omitempty"`
 }
@@ -0,0 +1,70 @@
+package export
+
+import (
+	"encoding/json"
+
+	"github.com/wagoodman/dive/dive/analysis"
+)
+
+type sharingExport struct {
+	Images            []imageSharing `json:"images"`
+	Layers            []sharedLayer  `json:"layers"`
+	Base              []string       `json:"base"`
+	TotalBytes        uint64         `json:"totalBytes"`
+	UniqueBytes       uint64         `json:"uniqueBytes"`
+	DeduplicatedBytes uint64         `json:"deduplicatedBytes"`
+}
+
+type imageSharing struct {
+	Image       string `json:"image"`
+	Layers      int    `json:"layers"`
+	SizeBytes   uint64 `json:"sizeBytes"`
+	SharedBytes uint64 `json:"sharedBytes"`
+	BaseLayers  int    `json:"baseLayers"`
+	Diverged    bool   `json:"diverged"`
+}
+
+type sharedLayer struct {
+	Digest    string   `json:"digest"`
+	SizeBytes uint64   `json:"sizeBytes"`
+	Command   string   `json:"command"`
+	Images    []string `json:"images"`
+}
+
+// NewSharingExport describes the layers shared between several images.
+func NewSharingExport(result *analysis.SharingResult) *sharingExport {
+	data := sharingExport{
+		Images:            make([]imageSharing, len(result.Images)),
+		Layers:            make([]sharedLayer, len(result.Layers)),
+		Base:              append([]string{}, result.Base...),
+		TotalBytes:        result.TotalBytes,
+		UniqueBytes:       result.UniqueBytes,
+		DeduplicatedBytes: result.DeduplicatedBytes(),
+	}
+
+	for idx, img := range result.Images {
+		data.Images[idx] = imageSharing{
+			Image:       img.Name,
+			Layers:      img.Layers,
+			SizeBytes:   img.SizeBytes,
+			SharedBytes: img.SharedBytes,
+			BaseLayers:  img.BaseLayers,
+			Diverged:    img.Diverged,
+		}
+	}
+
+	for idx, layer := range result.Layers {
+		data.Layers[idx] = sharedLayer{
+			Digest:    layer.Digest,
+			SizeBytes: layer.Size,
+			Command:   layer.Command,
+			Images:    layer.Images,
+		}
+	}
+
+	return &data
+}
+
+func (exp *sharingExport) Marshal() ([]byte, error) {
+	return json.MarshalIndent(&exp, "", "  ")
+}
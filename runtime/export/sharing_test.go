@@ -0,0 +1,92 @@
+package export
+
+import (
+	"testing"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+
+	"github.com/wagoodman/dive/dive/analysis"
+)
+
+func Test_SharingExport(t *testing.T) {
+	result := &analysis.SharingResult{
+		Images: []analysis.ImageSharing{
+			{Name: "docker://svc-a:1.0", Layers: 2, SizeBytes: 1010, SharedBytes: 1000, BaseLayers: 1},
+			{Name: "docker://svc-b:1.0", Layers: 2, SizeBytes: 1020, SharedBytes: 1000, BaseLayers: 1},
+		},
+		Layers: []analysis.SharedLayer{
+			{Digest: "sha256:base", Size: 1000, Command: "ADD rootfs.tar /", Images: []string{"docker://svc-a:1.0", "docker://svc-b:1.0"}},
+			{Digest: "sha256:app-a", Size: 10, Command: "COPY app /", Images: []string{"docker://svc-a:1.0"}},
+			{Digest: "sha256:app-b", Size: 20, Command: "COPY app /", Images: []string{"docker://svc-b:1.0"}},
+		},
+		Base:        []string{"sha256:base"},
+		TotalBytes:  2030,
+		UniqueBytes: 1030,
+	}
+
+	payload, err := NewSharingExport(result).Marshal()
+	if err != nil {
+		t.Errorf("Test_SharingExport: unable to export sharing: %v", err)
+	}
+
+	expectedResult := `{
+  "images": [
+    {
+      "image": "docker://svc-a:1.0",
+      "layers": 2,
+      "sizeBytes": 1010,
+      "sharedBytes": 1000,
+      "baseLayers": 1,
+      "diverged": false
+    },
+    {
+      "image": "docker://svc-b:1.0",
+      "layers": 2,
+      "sizeBytes": 1020,
+      "sharedBytes": 1000,
+      "baseLayers": 1,
+      "diverged": false
+    }
+  ],
+  "layers": [
+    {
+      "digest": "sha256:base",
+      "sizeBytes": 1000,
+      "command": "ADD rootfs.tar /",
+      "images": [
+        "docker://svc-a:1.0",
+        "docker://svc-b:1.0"
+      ]
+    },
+    {
+      "digest": "sha256:app-a",
+      "sizeBytes": 10,
+      "command": "COPY app /",
+      "images": [
+        "docker://svc-a:1.0"
+      ]
+    },
+    {
+      "digest": "sha256:app-b",
+      "sizeBytes": 20,
+      "command": "COPY app /",
+      "images": [
+        "docker://svc-b:1.0"
+      ]
+    }
+  ],
+  "base": [
+    "sha256:base"
+  ],
+  "totalBytes": 2030,
+  "uniqueBytes": 1030,
+  "deduplicatedBytes": 1000
+}`
+	actualResult := string(payload)
+	if expectedResult != actualResult {
+		dmp := diffmatchpatch.New()
+		diffs := dmp.DiffMain(expectedResult, actualResult, false)
+
+		t.Errorf("Test_SharingExport: unexpected export result:\n%v", dmp.DiffPrettyText(diffs))
+	}
+}
@@ -1,9 +1,14 @@
 package runtime
 
 import (
+	"os"
+	"time"
+
 	"github.com/spf13/viper"
 
 	"github.com/wagoodman/dive/dive"
+	"github.com/wagoodman/dive/dive/filetree"
+	"github.com/wagoodman/dive/dive/image"
 )
 
 type Options struct {
@@ -14,4 +19,40 @@ type Options struct {
 	ExportFile   string
 	CiConfig     *viper.Viper
 	BuildArgs    []string
+	Platform     *image.Platform
+	// ContainerdCtrAddress and ContainerdRoot locate the containerd content store (for the containerd source)
+	ContainerdCtrAddress string
+	ContainerdRoot       string
+	// ContainersStorageRoot is the containers-storage graph root (for the podman source)
+	ContainersStorageRoot string
+	// AllImages evaluates every image held by the source in CI mode (e.g. a multi-image docker-archive)
+	AllImages bool
+	// Timeout bounds fetching and analyzing the image (zero means no timeout)
+	Timeout time.Duration
+	// FileDigests is the digest computed for every regular file of the image (none by default)
+	FileDigests filetree.DigestAlgorithm
+	// Jobs is the number of layers parsed concurrently (zero means one per CPU)
+	Jobs int
+	// CacheDir is the directory parsed layers are cached in (empty means layers are not cached)
+	CacheDir string
+}
+
+// layerCache is the cache of parsed layers to fetch images with (nil when layers are not cached).
+func (options Options) layerCache() *image.LayerCache {
+	if options.CacheDir == "" {
+		return nil
+	}
+	return image.NewLayerCache(options.CacheDir)
+}
+
+func (options Options) resolverOptions() image.ResolverOptions {
+	return image.ResolverOptions{
+		Platform:             options.Platform,
+		ContainerdCtrAddress: options.ContainerdCtrAddress,
+		ContainerdRoot:       options.ContainerdRoot,
+
+		ContainersStorageRoot: options.ContainersStorageRoot,
+		Output:                os.Stdout,
+		Interactive:           true,
+	}
 }
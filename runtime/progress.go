@@ -0,0 +1,146 @@
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+const (
+	// progressEventInterval limits how often progress events are sent while fetching or building the cache
+	progressEventInterval = 100 * time.Millisecond
+	// progressLogInterval limits how often progress is logged when the output is not a terminal (e.g. in CI)
+	progressLogInterval = 5 * time.Second
+)
+
+// progress describes how far along a long running step (fetching the image or building the cache) is.
+type progress struct {
+	bytesRead  int64
+	bytesTotal int64
+	// item names what is being counted (e.g. "layers"), of which done out of total (zero when unknown) are complete
+	item  string
+	done  int
+	total int
+}
+
+func newFetchProgress(p image.Progress) progress {
+	return progress{
+		bytesRead:  p.BytesRead,
+		bytesTotal: p.BytesTotal,
+		item:       "layers",
+		done:       p.Layers,
+		total:      p.LayersTotal,
+	}
+}
+
+func (p progress) complete() bool {
+	return p.total > 0 && p.done >= p.total
+}
+
+func (p progress) String() string {
+	var fields []string
+	if p.bytesRead > 0 {
+		read := humanize.Bytes(uint64(p.bytesRead))
+		if p.bytesTotal > 0 {
+			percent := p.bytesRead * 100 / p.bytesTotal
+			if percent > 100 {
+				percent = 100
+			}
+			read = fmt.Sprintf("%s / %s (%d%%)", read, humanize.Bytes(uint64(p.bytesTotal)), percent)
+		}
+		fields = append(fields, read)
+	}
+	if p.total > 0 {
+		fields = append(fields, fmt.Sprintf("%d/%d %s", p.done, p.total, p.item))
+	} else if p.done > 0 {
+		fields = append(fields, fmt.Sprintf("%d %s", p.done, p.item))
+	}
+	return strings.Join(fields, ", ")
+}
+
+// progressReporter sends progress events at most every interval (and always once a step is complete), since progress
+// is reported for every read of the image.
+type progressReporter struct {
+	lock     sync.Mutex
+	events   eventChannel
+	interval time.Duration
+	last     time.Time
+}
+
+func newProgressReporter(events eventChannel, interval time.Duration) *progressReporter {
+	return &progressReporter{
+		events:   events,
+		interval: interval,
+	}
+}
+
+func (r *progressReporter) report(p progress) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	if !p.complete() && now.Sub(r.last) < r.interval {
+		return
+	}
+	r.last = now
+	r.events.progress(p)
+}
+
+// progressRenderer shows progress as a single line that is rewritten in place on a terminal, otherwise (e.g. in CI)
+// as a log line every so often.
+type progressRenderer struct {
+	out      io.Writer
+	terminal bool
+	interval time.Duration
+	last     time.Time
+	// active indicates a progress line is being shown (on a terminal), which must be ended before other output
+	active bool
+}
+
+func newProgressRenderer(out *os.File) *progressRenderer {
+	return &progressRenderer{
+		out:      out,
+		terminal: isTerminal(out),
+		interval: progressLogInterval,
+	}
+}
+
+func (r *progressRenderer) render(p progress) {
+	line := p.String()
+	if line == "" {
+		return
+	}
+
+	if r.terminal {
+		fmt.Fprintf(r.out, "\r\033[K  %s", line)
+		r.active = true
+		return
+	}
+
+	now := time.Now()
+	if !p.complete() && now.Sub(r.last) < r.interval {
+		return
+	}
+	r.last = now
+	fmt.Fprintf(r.out, "  %s\n", line)
+}
+
+// finish ends the progress line (if any), leaving the last progress shown.
+func (r *progressRenderer) finish() {
+	if r.active {
+		fmt.Fprintln(r.out)
+		r.active = false
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,50 @@
+package runtime
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestProgress_String(t *testing.T) {
+	table := map[string]struct {
+		progress progress
+		expected string
+	}{
+		"nothing":        {progress: progress{item: "layers"}, expected: ""},
+		"bytes":          {progress: progress{bytesRead: 2000000, item: "layers"}, expected: "2.0 MB"},
+		"bytes-of-total": {progress: progress{bytesRead: 2000000, bytesTotal: 8000000, item: "layers", done: 3}, expected: "2.0 MB / 8.0 MB (25%), 3 layers"},
+		"over-total":     {progress: progress{bytesRead: 9000000, bytesTotal: 8000000}, expected: "9.0 MB / 8.0 MB (100%)"},
+		"items-of-total": {progress: progress{item: "cache entries", done: 4, total: 28}, expected: "4/28 cache entries"},
+	}
+
+	for name, test := range table {
+		if actual := test.progress.String(); actual != test.expected {
+			t.Errorf("%s: expected '%s', got '%s'", name, test.expected, actual)
+		}
+	}
+}
+
+func TestProgressRenderer(t *testing.T) {
+	var out bytes.Buffer
+	terminal := &progressRenderer{out: &out, terminal: true, interval: time.Hour}
+	terminal.render(progress{item: "layers", done: 1, total: 2})
+	terminal.render(progress{item: "layers", done: 2, total: 2})
+	terminal.finish()
+	terminal.finish()
+
+	if expected := "\r\033[K  1/2 layers\r\033[K  2/2 layers\n"; out.String() != expected {
+		t.Errorf("expected terminal output %q, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	log := &progressRenderer{out: &out, interval: time.Hour}
+	log.render(progress{item: "layers", done: 1, total: 3})
+	log.render(progress{item: "layers", done: 2, total: 3})
+	log.render(progress{item: "layers", done: 3, total: 3})
+	log.finish()
+
+	if expected := "  1/3 layers\n  3/3 layers\n"; out.String() != expected {
+		t.Errorf("expected log output %q, got %q", expected, out.String())
+	}
+}
@@ -1,8 +1,11 @@
 package runtime
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
@@ -18,7 +21,7 @@ import (
 	"github.com/wagoodman/dive/utils"
 )
 
-func run(enableUi bool, options Options, imageResolver image.Resolver, events eventChannel, filesystem afero.Fs) {
+func run(ctx context.Context, enableUi bool, options Options, imageResolver image.Resolver, events eventChannel, filesystem afero.Fs) {
 	var img *image.Image
 	var err error
 	defer close(events)
@@ -26,19 +29,31 @@ func run(enableUi bool, options Options, imageResolver image.Resolver, events ev
 	doExport := options.ExportFile != ""
 	doBuild := len(options.BuildArgs) > 0
 
+	reporter := newProgressReporter(events, progressEventInterval)
+	ctx = image.WithProgressTracker(ctx, image.NewProgressTracker(func(p image.Progress) {
+		reporter.report(newFetchProgress(p))
+	}))
+	ctx = image.WithFileDigests(ctx, options.FileDigests)
+	ctx = image.WithJobs(ctx, options.Jobs)
+	ctx = image.WithLayerCache(ctx, options.layerCache())
+
 	if doBuild {
 		events.message(utils.TitleFormat("Building image..."))
-		img, err = imageResolver.Build(options.BuildArgs)
+		img, err = imageResolver.Build(ctx, options.BuildArgs)
 		if err != nil {
-			events.exitWithErrorMessage("cannot build image", err)
+			events.exitWithErrorMessage("cannot build image", interruption(ctx, options, err))
 			return
 		}
+	} else if options.Ci && options.AllImages {
+		events.message(utils.TitleFormat("Image Source: ") + options.Source.String() + "://" + options.Image)
+		runCiForAllImages(ctx, options, imageResolver, events)
+		return
 	} else {
 		events.message(utils.TitleFormat("Image Source: ") + options.Source.String() + "://" + options.Image)
 		events.message(utils.TitleFormat("Fetching image...") + " (this can take a while for large images)")
-		img, err = imageResolver.Fetch(options.Image)
+		img, err = imageResolver.Fetch(ctx, options.Image)
 		if err != nil {
-			events.exitWithErrorMessage("cannot fetch image", err)
+			events.exitWithErrorMessage("cannot fetch image", interruption(ctx, options, err))
 			return
 		}
 	}
@@ -52,36 +67,12 @@ func run(enableUi bool, options Options, imageResolver image.Resolver, events ev
 
 	if doExport {
 		events.message(utils.TitleFormat(fmt.Sprintf("Exporting image to '%s'...", options.ExportFile)))
-		bytes, err := export.NewExport(analysis).Marshal()
-		if err != nil {
-			events.exitWithErrorMessage("cannot marshal export payload", err)
-			return
-		}
-
-		file, err := filesystem.OpenFile(options.ExportFile, os.O_RDWR|os.O_CREATE, 0644)
-		if err != nil {
-			events.exitWithErrorMessage("cannot open export file", err)
-			return
-		}
-		defer file.Close()
-
-		_, err = file.Write(bytes)
-		if err != nil {
-			events.exitWithErrorMessage("cannot write to export file", err)
-		}
+		writeExport(export.NewExport(analysis).Marshal, options.ExportFile, events, filesystem)
 		return
 	}
 
 	if options.Ci {
-		events.message(fmt.Sprintf("  efficiency: %2.4f %%", analysis.Efficiency*100))
-		events.message(fmt.Sprintf("  wastedBytes: %d bytes (%s)", analysis.WastedBytes, humanize.Bytes(analysis.WastedBytes)))
-		events.message(fmt.Sprintf("  userWastedPercent: %2.4f %%", analysis.WastedUserPercent*100))
-
-		evaluator := ci.NewCiEvaluator(options.CiConfig)
-		pass := evaluator.Evaluate(analysis)
-		events.message(evaluator.Report())
-
-		if !pass {
+		if !evaluateCi(analysis, options, events) {
 			events.exitWithError(nil)
 		}
 
@@ -89,7 +80,13 @@ func run(enableUi bool, options Options, imageResolver image.Resolver, events ev
 	} else {
 		events.message(utils.TitleFormat("Building cache..."))
 		treeStack := filetree.NewComparer(analysis.RefTrees)
-		errors := treeStack.BuildCache()
+		errors := treeStack.BuildCache(ctx, func(built, total int) {
+			reporter.report(progress{item: "cache entries", done: built, total: total})
+		})
+		if ctx.Err() != nil {
+			events.exitWithErrorMessage("cannot build cache", interruption(ctx, options, ctx.Err()))
+			return
+		}
 		if errors != nil {
 			for _, err := range errors {
 				events.message("  " + err.Error())
@@ -117,22 +114,146 @@ func run(enableUi bool, options Options, imageResolver image.Resolver, events ev
 	}
 }
 
-func Run(options Options) {
-	var exitCode int
-	var events = make(eventChannel)
+// writeExport writes the payload returned by marshal to the given export file (replacing any existing contents).
+func writeExport(marshal func() ([]byte, error), path string, events eventChannel, filesystem afero.Fs) {
+	bytes, err := marshal()
+	if err != nil {
+		events.exitWithErrorMessage("cannot marshal export payload", err)
+		return
+	}
+
+	file, err := filesystem.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		events.exitWithErrorMessage("cannot open export file", err)
+		return
+	}
+	defer file.Close()
 
-	imageResolver, err := dive.GetImageResolver(options.Source)
+	_, err = file.Write(bytes)
 	if err != nil {
-		message := "cannot determine image provider"
-		logrus.Error(message)
-		logrus.Error(err)
-		fmt.Fprintf(os.Stderr, "%s: %+v\n", message, err)
-		os.Exit(1)
+		events.exitWithErrorMessage("cannot write to export file", err)
 	}
+}
+
+// evaluateCi reports the analysis results and evaluates them against the configured CI rules
+func evaluateCi(analysis *image.AnalysisResult, options Options, events eventChannel) bool {
+	events.message(fmt.Sprintf("  efficiency: %2.4f %%", analysis.Efficiency*100))
+	events.message(fmt.Sprintf("  wastedBytes: %d bytes (%s)", analysis.WastedBytes, humanize.Bytes(analysis.WastedBytes)))
+	events.message(fmt.Sprintf("  userWastedPercent: %2.4f %%", analysis.WastedUserPercent*100))
 
-	go run(true, options, imageResolver, events, afero.NewOsFs())
+	evaluator := ci.NewCiEvaluator(options.CiConfig)
+	pass := evaluator.Evaluate(analysis)
+	events.message(evaluator.Report())
+	return pass
+}
 
+// runCiForAllImages evaluates the CI rules against every image held by the source (e.g. a multi-image
+// docker-archive), finishing with a combined result across all images.
+func runCiForAllImages(ctx context.Context, options Options, imageResolver image.Resolver, events eventChannel) {
+	multiResolver, ok := imageResolver.(image.MultiResolver)
+	if !ok {
+		events.exitWithError(fmt.Errorf("the '%s' source does not support evaluating all images", options.Source))
+		return
+	}
+
+	events.message(utils.TitleFormat("Fetching images...") + " (this can take a while for large images)")
+	images, err := multiResolver.FetchAll(ctx, options.Image)
+	if err != nil {
+		events.exitWithErrorMessage("cannot fetch images", interruption(ctx, options, err))
+		return
+	}
+
+	var failed []string
+	for idx, img := range images {
+		name := fmt.Sprintf("image %d", idx+1)
+		if len(img.RepoTags) > 0 {
+			name = strings.Join(img.RepoTags, ", ")
+		}
+
+		events.message(utils.TitleFormat(fmt.Sprintf("Analyzing image (%s)...", name)))
+		analysis, err := img.Analyze()
+		if err != nil {
+			events.exitWithErrorMessage("cannot analyze image", err)
+			return
+		}
+
+		if !evaluateCi(analysis, options, events) {
+			failed = append(failed, name)
+		}
+	}
+
+	summary := fmt.Sprintf("Images:%d [Passed:%d] [Failed:%d]", len(images), len(images)-len(failed), len(failed))
+	if len(failed) > 0 {
+		events.message(utils.TitleFormat("Combined Result:") + " FAIL " + summary + "\n  failed: " + strings.Join(failed, "; "))
+		events.exitWithError(nil)
+		return
+	}
+	events.message(utils.TitleFormat("Combined Result:") + " PASS " + summary)
+}
+
+// interruption explains an error caused by the run being cancelled (on SIGINT) or timing out, any other error is
+// returned as-is.
+func interruption(ctx context.Context, options Options, err error) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return fmt.Errorf("timed out after %s: %w", options.Timeout, err)
+	case context.Canceled:
+		return fmt.Errorf("interrupted: %w", err)
+	}
+	return err
+}
+
+func Run(options Options) {
+	imageResolver, err := dive.GetImageResolver(options.Source, options.resolverOptions())
+	if err != nil {
+		exitWithResolverError(err)
+	}
+
+	ctx, cancel := newRunContext(options)
+	defer cancel()
+
+	var events = make(eventChannel)
+	go run(ctx, true, options, imageResolver, events, afero.NewOsFs())
+
+	os.Exit(renderEvents(events))
+}
+
+func exitWithResolverError(err error) {
+	message := "cannot determine image provider"
+	logrus.Error(message)
+	logrus.Error(err)
+	fmt.Fprintf(os.Stderr, "%s: %+v\n", message, err)
+	os.Exit(1)
+}
+
+// newRunContext returns the context for fetching, parsing, and analyzing images, which is cancelled on SIGINT (or
+// once the timeout elapses). Note that the interactive UI reads ctrl+c as a key press, so this does not affect
+// quitting the UI.
+func newRunContext(options Options) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	// once cancelled, restore the default SIGINT handling so that a second SIGINT terminates dive immediately
+	context.AfterFunc(ctx, stop)
+	if options.Timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, options.Timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// renderEvents shows the events of a run as they are received, returning the exit code once the run is done.
+func renderEvents(events eventChannel) int {
+	var exitCode int
+	renderer := newProgressRenderer(os.Stdout)
 	for event := range events {
+		if event.progress != nil {
+			renderer.render(*event.progress)
+			continue
+		}
+		renderer.finish()
+
 		if event.stdout != "" {
 			fmt.Println(event.stdout)
 		}
@@ -156,5 +277,5 @@ func Run(options Options) {
 			exitCode = 1
 		}
 	}
-	os.Exit(exitCode)
+	return exitCode
 }
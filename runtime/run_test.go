@@ -1,9 +1,13 @@
 package runtime
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/lunixbochs/vtclean"
 	"github.com/spf13/afero"
@@ -16,7 +20,7 @@ import (
 
 type defaultResolver struct{}
 
-func (r *defaultResolver) Fetch(id string) (*image.Image, error) {
+func (r *defaultResolver) Fetch(ctx context.Context, id string) (*image.Image, error) {
 	archive, err := docker.TestLoadArchive("../.data/test-docker-image.tar")
 	if err != nil {
 		return nil, err
@@ -24,13 +28,13 @@ func (r *defaultResolver) Fetch(id string) (*image.Image, error) {
 	return archive.ToImage()
 }
 
-func (r *defaultResolver) Build(args []string) (*image.Image, error) {
-	return r.Fetch("")
+func (r *defaultResolver) Build(ctx context.Context, args []string) (*image.Image, error) {
+	return r.Fetch(ctx, "")
 }
 
 type failedBuildResolver struct{}
 
-func (r *failedBuildResolver) Fetch(id string) (*image.Image, error) {
+func (r *failedBuildResolver) Fetch(ctx context.Context, id string) (*image.Image, error) {
 	archive, err := docker.TestLoadArchive("../.data/test-docker-image.tar")
 	if err != nil {
 		return nil, err
@@ -38,20 +42,49 @@ func (r *failedBuildResolver) Fetch(id string) (*image.Image, error) {
 	return archive.ToImage()
 }
 
-func (r *failedBuildResolver) Build(args []string) (*image.Image, error) {
+func (r *failedBuildResolver) Build(ctx context.Context, args []string) (*image.Image, error) {
 	return nil, fmt.Errorf("some build failure")
 }
 
 type failedFetchResolver struct{}
 
-func (r *failedFetchResolver) Fetch(id string) (*image.Image, error) {
+func (r *failedFetchResolver) Fetch(ctx context.Context, id string) (*image.Image, error) {
 	return nil, fmt.Errorf("some fetch failure")
 }
 
-func (r *failedFetchResolver) Build(args []string) (*image.Image, error) {
+func (r *failedFetchResolver) Build(ctx context.Context, args []string) (*image.Image, error) {
 	return nil, fmt.Errorf("some build failure")
 }
 
+type multiImageResolver struct {
+	defaultResolver
+}
+
+func (r *multiImageResolver) FetchAll(ctx context.Context, id string) ([]*image.Image, error) {
+	var images []*image.Image
+	for _, tag := range []string{"dive-test:1", "dive-test:2"} {
+		img, err := r.Fetch(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		img.RepoTags = []string{tag}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// blockingResolver holds the fetch until the context is done, as a fetch of a very large image would
+type blockingResolver struct{}
+
+func (r *blockingResolver) Fetch(ctx context.Context, id string) (*image.Image, error) {
+	<-ctx.Done()
+	return nil, fmt.Errorf("could not read image archive: %w", ctx.Err())
+}
+
+func (r *blockingResolver) Build(ctx context.Context, args []string) (*image.Image, error) {
+	return r.Fetch(ctx, "")
+}
+
 // func showEvents(events []testEvent) {
 // 	for _, e := range events {
 // 		fmt.Printf("{stdout:\"%s\", stderr:\"%s\", errorOnExit: %v, errMessage: \"%s\"},\n",
@@ -198,6 +231,46 @@ func TestRun(t *testing.T) {
 				{stdout: "", stderr: "", errorOnExit: true, errMessage: ""},
 			},
 		},
+		"ci-all-images-case": {
+			resolver: &multiImageResolver{},
+			options: Options{
+				Ci:        true,
+				AllImages: true,
+				Image:     "bundle.tar",
+				Source:    dive.SourceDockerArchive,
+				CiConfig:  configureCi(),
+			},
+			events: []testEvent{
+				{stdout: "Image Source: docker-archive://bundle.tar", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "Fetching images... (this can take a while for large images)", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "Analyzing image (dive-test:1)...", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "  efficiency: 98.4421 %", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "  wastedBytes: 32025 bytes (32 kB)", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "  userWastedPercent: 48.3491 %", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "Inefficient Files:\nCount  Wasted Space  File Path\n    2         13 kB  /root/saved.txt\n    2         13 kB  /root/example/somefile1.txt\n    2        6.4 kB  /root/example/somefile3.txt\nResults:\n  FAIL: highestUserWastedPercent: too many bytes wasted, relative to the user bytes added (%-user-wasted-bytes=0.4834911001404049 > threshold=0.1)\n  FAIL: highestWastedBytes: too many bytes wasted (wasted-bytes=32025 > threshold=1000)\n  PASS: lowestEfficiency\nResult:FAIL [Total:3] [Passed:1] [Failed:2] [Warn:0] [Skipped:0]\n", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "Analyzing image (dive-test:2)...", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "  efficiency: 98.4421 %", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "  wastedBytes: 32025 bytes (32 kB)", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "  userWastedPercent: 48.3491 %", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "Inefficient Files:\nCount  Wasted Space  File Path\n    2         13 kB  /root/saved.txt\n    2         13 kB  /root/example/somefile1.txt\n    2        6.4 kB  /root/example/somefile3.txt\nResults:\n  FAIL: highestUserWastedPercent: too many bytes wasted, relative to the user bytes added (%-user-wasted-bytes=0.4834911001404049 > threshold=0.1)\n  FAIL: highestWastedBytes: too many bytes wasted (wasted-bytes=32025 > threshold=1000)\n  PASS: lowestEfficiency\nResult:FAIL [Total:3] [Passed:1] [Failed:2] [Warn:0] [Skipped:0]\n", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "Combined Result: FAIL Images:2 [Passed:0] [Failed:2]\n  failed: dive-test:1; dive-test:2", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "", stderr: "", errorOnExit: true, errMessage: ""},
+			},
+		},
+		"ci-all-images-unsupported-case": {
+			resolver: &defaultResolver{},
+			options: Options{
+				Ci:        true,
+				AllImages: true,
+				Image:     "dive-example",
+				Source:    dive.SourceDockerEngine,
+				CiConfig:  configureCi(),
+			},
+			events: []testEvent{
+				{stdout: "Image Source: docker://dive-example", stderr: "", errorOnExit: false, errMessage: ""},
+				{stdout: "", stderr: "", errorOnExit: true, errMessage: "the 'docker' source does not support evaluating all images"},
+			},
+		},
 		"empty-ci-config-case": {
 			resolver: &defaultResolver{},
 			options: Options{
@@ -241,9 +314,13 @@ func TestRun(t *testing.T) {
 		var events = make([]testEvent, 0)
 		var filesystem = afero.NewMemMapFs()
 
-		go run(false, test.options, test.resolver, ec, filesystem)
+		go run(context.Background(), false, test.options, test.resolver, ec, filesystem)
 
 		for event := range ec {
+			if event.progress != nil {
+				// progress is timing dependent (see TestRun_Progress)
+				continue
+			}
 			events = append(events, newTestEvent(event))
 		}
 
@@ -288,3 +365,106 @@ func TestRun(t *testing.T) {
 		}
 	}
 }
+
+func TestRun_ExportReplacesExistingFile(t *testing.T) {
+	filesystem := afero.NewMemMapFs()
+	// an existing export longer than the new one
+	stale := bytes.Repeat([]byte("stale"), 1024*1024)
+	if err := afero.WriteFile(filesystem, "some-file.json", stale, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	options := Options{
+		Image:      "doesn't-matter",
+		Source:     dive.SourceDockerArchive,
+		ExportFile: "some-file.json",
+	}
+	ec := make(eventChannel)
+	go run(context.Background(), false, options, &defaultResolver{}, ec, filesystem)
+	for event := range ec {
+		if event.err != nil || event.errorOnExit {
+			t.Fatalf("unexpected failure: %+v", event)
+		}
+	}
+
+	contents, err := afero.ReadFile(filesystem, "some-file.json")
+	if err != nil {
+		t.Fatalf("unable to read export: %v", err)
+	}
+	if len(contents) >= len(stale) {
+		t.Fatalf("expected the export to replace the existing file, got %d bytes", len(contents))
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(contents, &payload); err != nil {
+		t.Errorf("expected the export to be valid json: %v", err)
+	}
+}
+
+func TestRun_Cancelled(t *testing.T) {
+	timedOut, cancelTimeout := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelTimeout()
+
+	interrupted, interrupt := context.WithCancel(context.Background())
+	interrupt()
+
+	table := map[string]struct {
+		ctx      context.Context
+		timeout  time.Duration
+		expected string
+	}{
+		"timeout":   {ctx: timedOut, timeout: 10 * time.Millisecond, expected: "timed out after 10ms: could not read image archive: context deadline exceeded"},
+		"interrupt": {ctx: interrupted, expected: "interrupted: could not read image archive: context canceled"},
+	}
+
+	for name, test := range table {
+		var ec = make(eventChannel)
+		var events = make([]testEvent, 0)
+		options := Options{
+			Image:   "dive-example",
+			Source:  dive.SourceDockerEngine,
+			Timeout: test.timeout,
+		}
+
+		go run(test.ctx, false, options, &blockingResolver{}, ec, afero.NewMemMapFs())
+
+		for event := range ec {
+			events = append(events, newTestEvent(event))
+		}
+
+		last := events[len(events)-1]
+		if !last.errorOnExit {
+			t.Errorf("%s: expected a non-zero exit", name)
+		}
+		if last.stderr != "cannot fetch image" {
+			t.Errorf("%s: expected stderr='cannot fetch image', got '%s'", name, last.stderr)
+		}
+		if last.errMessage != test.expected {
+			t.Errorf("%s: expected error='%s', got '%s'", name, test.expected, last.errMessage)
+		}
+	}
+}
+
+func TestRun_Progress(t *testing.T) {
+	var ec = make(eventChannel)
+	options := Options{
+		Image:  "dive-example",
+		Source: dive.SourceDockerEngine,
+	}
+
+	go run(context.Background(), false, options, &defaultResolver{}, ec, afero.NewMemMapFs())
+
+	var last *progress
+	for event := range ec {
+		if event.progress != nil {
+			last = event.progress
+		}
+	}
+
+	if last == nil {
+		t.Fatal("expected progress events")
+	}
+	// building the cache is the last step, and complete progress is always reported
+	if actual := last.String(); actual != "28/28 cache entries" {
+		t.Errorf("expected final progress '28/28 cache entries', got '%s'", actual)
+	}
+}
@@ -0,0 +1,193 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/afero"
+
+	"github.com/wagoodman/dive/dive"
+	"github.com/wagoodman/dive/dive/analysis"
+	"github.com/wagoodman/dive/dive/image"
+	"github.com/wagoodman/dive/runtime/export"
+	"github.com/wagoodman/dive/utils"
+)
+
+// ImageReference is an image and the source to fetch it from.
+type ImageReference struct {
+	Source dive.ImageSource
+	Image  string
+}
+
+func (r ImageReference) String() string {
+	return r.Source.String() + "://" + r.Image
+}
+
+// SharingOptions are the settings for reporting the layers shared between several images, where Options holds the
+// settings shared by every image (its Image and Source are not used). The report is written to Options.ExportFile
+// (as JSON) when given, otherwise printed.
+type SharingOptions struct {
+	Options
+	Images []ImageReference
+	// Base is the image every image is expected to be built on (optional, by default the expected base is the longest
+	// layer prefix shared by a majority of the images)
+	Base *ImageReference
+}
+
+func runSharing(ctx context.Context, options SharingOptions, resolvers map[dive.ImageSource]image.Resolver, events eventChannel, filesystem afero.Fs) {
+	defer close(events)
+
+	reporter := newProgressReporter(events, progressEventInterval)
+	fetch := func(ref ImageReference) (*image.Image, bool) {
+		events.message(utils.TitleFormat(fmt.Sprintf("Fetching image (%s)...", ref)))
+		ctx := image.WithProgressTracker(ctx, image.NewProgressTracker(func(p image.Progress) {
+			reporter.report(newFetchProgress(p))
+		}))
+		ctx = image.WithJobs(ctx, options.Jobs)
+		ctx = image.WithLayerCache(ctx, options.layerCache())
+		img, err := resolvers[ref.Source].Fetch(ctx, ref.Image)
+		if err != nil {
+			events.exitWithErrorMessage("cannot fetch image", interruption(ctx, options.Options, err))
+			return nil, false
+		}
+		// only the layer metadata is needed, so let go of the file trees (there may be many images)
+		img.Trees = nil
+		for _, layer := range img.Layers {
+			layer.Tree = nil
+		}
+		return img, true
+	}
+
+	var names []string
+	var images []*image.Image
+	for _, ref := range options.Images {
+		img, ok := fetch(ref)
+		if !ok {
+			return
+		}
+		names = append(names, ref.String())
+		images = append(images, img)
+	}
+
+	var base *image.Image
+	if options.Base != nil {
+		var ok bool
+		if base, ok = fetch(*options.Base); !ok {
+			return
+		}
+	}
+
+	events.message(utils.TitleFormat("Comparing layers..."))
+	result, err := analysis.Sharing(names, images, base)
+	if err != nil {
+		events.exitWithErrorMessage("cannot compare layers", err)
+		return
+	}
+
+	if options.ExportFile != "" {
+		events.message(utils.TitleFormat(fmt.Sprintf("Exporting layer sharing to '%s'...", options.ExportFile)))
+		writeExport(export.NewSharingExport(result).Marshal, options.ExportFile, events, filesystem)
+		return
+	}
+
+	events.message(sharingReport(result))
+}
+
+// sharingReport lists each image with how much of it is shared, the layers shared between images, and the images
+// that diverge from the expected base.
+func sharingReport(result *analysis.SharingResult) string {
+	var sb strings.Builder
+
+	fmt.Fprintln(&sb, utils.TitleFormat("Images:"))
+	template := "%6s  %10s  %10s  %11s  %-s\n"
+	fmt.Fprintf(&sb, template, "Layers", "Size", "Shared", "Base Layers", "Image")
+	for _, img := range result.Images {
+		fmt.Fprintf(&sb, template, fmt.Sprint(img.Layers), humanize.Bytes(img.SizeBytes), humanize.Bytes(img.SharedBytes),
+			fmt.Sprintf("%d/%d", img.BaseLayers, len(result.Base)), img.Name)
+	}
+
+	fmt.Fprintln(&sb, utils.TitleFormat("Shared Layers:"))
+	var shared int
+	template = "%6s  %10s  %-19s  %-s\n"
+	for _, layer := range result.Layers {
+		if !layer.Shared() {
+			continue
+		}
+		if shared == 0 {
+			fmt.Fprintf(&sb, template, "Images", "Size", "Digest", "Command")
+		}
+		shared++
+		fmt.Fprintf(&sb, template, fmt.Sprintf("%d/%d", len(layer.Images), len(result.Images)), humanize.Bytes(layer.Size),
+			shortDigest(layer.Digest), commandPreview(layer.Command))
+	}
+	if shared == 0 {
+		fmt.Fprintln(&sb, "None")
+	}
+
+	fmt.Fprintln(&sb, utils.TitleFormat("Divergent Images:"))
+	divergent := result.Divergent()
+	switch {
+	case len(result.Base) == 0:
+		fmt.Fprintln(&sb, "None (no base layers are shared by most images)")
+	case len(divergent) == 0:
+		fmt.Fprintln(&sb, "None")
+	default:
+		for _, img := range divergent {
+			fmt.Fprintf(&sb, "  %s (starts with %d of %d base layers)\n", img.Name, img.BaseLayers, len(result.Base))
+		}
+	}
+
+	fmt.Fprintln(&sb, utils.TitleFormat("Summary:"))
+	fmt.Fprintf(&sb, "  images: %d, distinct layers: %d (shared: %d), total: %s, unique: %s, deduplicated: %s",
+		len(result.Images), len(result.Layers), shared, humanize.Bytes(result.TotalBytes),
+		humanize.Bytes(result.UniqueBytes), humanize.Bytes(result.DeduplicatedBytes()))
+	return sb.String()
+}
+
+// shortDigest abbreviates a digest (e.g. "sha256:" and the first 12 hex characters) for display.
+func shortDigest(digest string) string {
+	if len(digest) > 19 {
+		return digest[:19]
+	}
+	return digest
+}
+
+// commandPreview shows a layer command on a single line, abbreviating long commands.
+func commandPreview(command string) string {
+	command = strings.Replace(command, "\n", "↵", -1)
+	if runes := []rune(command); len(runes) > 60 {
+		return string(runes[:59]) + "…"
+	}
+	return command
+}
+
+// RunSharing reports the layers shared between several images (see SharingOptions), exiting once done.
+func RunSharing(options SharingOptions) {
+	refs := options.Images
+	if options.Base != nil {
+		refs = append(refs[:len(refs):len(refs)], *options.Base)
+	}
+
+	resolvers := make(map[dive.ImageSource]image.Resolver)
+	for _, ref := range refs {
+		if _, exists := resolvers[ref.Source]; exists {
+			continue
+		}
+		resolver, err := dive.GetImageResolver(ref.Source, options.resolverOptions())
+		if err != nil {
+			exitWithResolverError(err)
+		}
+		resolvers[ref.Source] = resolver
+	}
+
+	ctx, cancel := newRunContext(options.Options)
+	defer cancel()
+
+	var events = make(eventChannel)
+	go runSharing(ctx, options, resolvers, events, afero.NewOsFs())
+
+	os.Exit(renderEvents(events))
+}
@@ -0,0 +1,137 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/lunixbochs/vtclean"
+	"github.com/spf13/afero"
+
+	"github.com/wagoodman/dive/dive"
+	"github.com/wagoodman/dive/dive/image"
+)
+
+func TestRunSharing(t *testing.T) {
+	images := []ImageReference{
+		{Source: dive.SourceDockerEngine, Image: "dive-example:1"},
+		{Source: dive.SourceDockerArchive, Image: "dive-example-2.tar"},
+	}
+
+	table := map[string]struct {
+		options  SharingOptions
+		resolver image.Resolver
+		events   []string
+		report   []string
+		errMsg   string
+	}{
+		"text-case": {
+			options:  SharingOptions{Images: images},
+			resolver: &defaultResolver{},
+			events: []string{
+				"Fetching image (docker://dive-example:1)...",
+				"Fetching image (docker-archive://dive-example-2.tar)...",
+				"Comparing layers...",
+				"Images:",
+			},
+			report: []string{
+				"    14      1.2 MB      1.2 MB          7/7  docker://dive-example:1",
+				"   2/2      1.2 MB  sha256:23bc2b70b201  #(nop) ADD file:ce026b62356eec3ad1214f92be2c9dc063fe205bd5e…",
+				"Divergent Images:\nNone\n",
+			},
+		},
+		"base-case": {
+			options:  SharingOptions{Images: images, Base: &ImageReference{Source: dive.SourceDockerEngine, Image: "dive-example:base"}},
+			resolver: &defaultResolver{},
+			events: []string{
+				"Fetching image (docker://dive-example:1)...",
+				"Fetching image (docker-archive://dive-example-2.tar)...",
+				"Fetching image (docker://dive-example:base)...",
+				"Comparing layers...",
+				"Images:",
+			},
+			report: []string{
+				"Divergent Images:\n  docker-archive://dive-example-2.tar (starts with 7 of 14 base layers)\n",
+			},
+		},
+		"export-case": {
+			options:  SharingOptions{Options: Options{ExportFile: "sharing.json"}, Images: images},
+			resolver: &defaultResolver{},
+			events: []string{
+				"Fetching image (docker://dive-example:1)...",
+				"Fetching image (docker-archive://dive-example-2.tar)...",
+				"Comparing layers...",
+				"Exporting layer sharing to 'sharing.json'...",
+			},
+		},
+		"failed-fetch": {
+			options:  SharingOptions{Images: images},
+			resolver: &failedFetchResolver{},
+			events: []string{
+				"Fetching image (docker://dive-example:1)...",
+			},
+			errMsg: "some fetch failure",
+		},
+	}
+
+	for name, test := range table {
+		var ec = make(eventChannel)
+		var filesystem = afero.NewMemMapFs()
+		var stdout []string
+		var errMsg string
+
+		resolvers := map[dive.ImageSource]image.Resolver{
+			dive.SourceDockerEngine:  test.resolver,
+			dive.SourceDockerArchive: &baseResolver{},
+		}
+
+		go runSharing(context.Background(), test.options, resolvers, ec, filesystem)
+
+		for event := range ec {
+			if event.progress != nil {
+				continue
+			}
+			if event.stdout != "" {
+				stdout = append(stdout, vtclean.Clean(event.stdout, false))
+			}
+			if event.err != nil {
+				errMsg = event.err.Error()
+			}
+		}
+
+		if errMsg != test.errMsg {
+			t.Errorf("%s: expected error '%s', got '%s'", name, test.errMsg, errMsg)
+		}
+		if len(stdout) != len(test.events) {
+			t.Fatalf("%s: expected events %q, got %q", name, test.events, stdout)
+		}
+		for idx, expected := range test.events {
+			if !strings.HasPrefix(stdout[idx], expected) {
+				t.Errorf("%s: expected event %q, got %q", name, expected, stdout[idx])
+			}
+		}
+		for _, expected := range test.report {
+			if report := stdout[len(stdout)-1]; !strings.Contains(report, expected) {
+				t.Errorf("%s: expected the report to contain %q, got:\n%s", name, expected, report)
+			}
+		}
+
+		if test.options.ExportFile != "" {
+			contents, err := afero.ReadFile(filesystem, test.options.ExportFile)
+			if err != nil {
+				t.Fatalf("%s: expected an export file: %v", name, err)
+			}
+			var exported struct {
+				Base              []string `json:"base"`
+				DeduplicatedBytes uint64   `json:"deduplicatedBytes"`
+			}
+			if err := json.Unmarshal(contents, &exported); err != nil {
+				t.Fatalf("%s: unable to parse export: %v", name, err)
+			}
+			if len(exported.Base) != 7 || exported.DeduplicatedBytes == 0 {
+				t.Errorf("%s: unexpected export: %s", name, contents)
+			}
+		}
+	}
+}
@@ -42,6 +42,7 @@ func newApp(gui *gocui.Gui, imageName string, analysis *image.AnalysisResult, ca
 		lm := layout.NewManager()
 		lm.Add(controller.views.Status, layout.LocationFooter)
 		lm.Add(controller.views.Filter, layout.LocationFooter)
+		lm.Add(controller.views.FileDetails, layout.LocationFooter)
 		lm.Add(compound.NewLayerDetailsCompoundLayout(controller.views.Layer, controller.views.LayerDetails, controller.views.ImageDetails), layout.LocationColumn)
 		lm.Add(controller.views.Tree, layout.LocationColumn)
 
@@ -90,6 +91,12 @@ func newApp(gui *gocui.Gui, imageName string, analysis *image.AnalysisResult, ca
 				IsSelected: controller.views.Filter.IsVisible,
 				Display:    "Filter",
 			},
+			{
+				ConfigKeys: []string{"keybinding.toggle-file-details"},
+				OnAction:   controller.ToggleFileDetailsView,
+				IsSelected: controller.views.FileDetails.IsVisible,
+				Display:    "File details",
+			},
 		}
 
 		globalHelpKeys, err = key.GenerateBindings(gui, "", infos)
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"fmt"
 	"regexp"
 
 	"github.com/awesome-gocui/gocui"
@@ -34,6 +35,9 @@ func NewCollection(g *gocui.Gui, imageName string, analysis *image.AnalysisResul
 	// update the status pane when a filetree option is changed by the user
 	controller.views.Tree.AddViewOptionChangeListener(controller.onFileTreeViewOptionChange)
 
+	// update the file details as the user moves through the file tree
+	controller.views.Tree.AddNodeSelectionListener(controller.onFileTreeSelectionChange)
+
 	// update the tree view while the user types into the filter view
 	controller.views.Filter.AddFilterEditListener(controller.onFilterEdit)
 
@@ -61,6 +65,17 @@ func (c *Controller) onFileTreeViewOptionChange() error {
 	return c.views.Status.Render()
 }
 
+func (c *Controller) onFileTreeSelectionChange(*filetree.FileNode) error {
+	if !c.views.FileDetails.IsVisible() {
+		return nil
+	}
+	err := c.views.FileDetails.Update()
+	if err != nil {
+		return err
+	}
+	return c.views.FileDetails.Render()
+}
+
 func (c *Controller) onFilterEdit(filter string) error {
 	var filterRegex *regexp.Regexp
 	var err error
@@ -92,9 +107,12 @@ func (c *Controller) onLayerChange(selection viewmodel.LayerSelection) error {
 		return err
 	}
 
-	if c.views.Layer.CompareMode() == viewmodel.CompareAllLayers {
+	switch c.views.Layer.CompareMode() {
+	case viewmodel.CompareAllLayers:
 		c.views.Tree.SetTitle("Aggregated Layer Contents")
-	} else {
+	case viewmodel.CompareLayerRange:
+		c.views.Tree.SetTitle(fmt.Sprintf("Layer Range Contents (%d to %d)", selection.BottomTreeStop, selection.TopTreeStop))
+	default:
 		c.views.Tree.SetTitle("Current Layer Contents")
 	}
 
@@ -235,3 +253,9 @@ func (c *Controller) ToggleFilterView() error {
 
 	return c.UpdateAndRender()
 }
+
+// ToggleFileDetailsView shows/hides the details of the file selected in the file tree.
+func (c *Controller) ToggleFileDetailsView() error {
+	c.views.FileDetails.ToggleVisible()
+	return c.UpdateAndRender()
+}
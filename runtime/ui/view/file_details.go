@@ -0,0 +1,214 @@
+package view
+
+import (
+	"archive/tar"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+
+	"github.com/wagoodman/dive/dive/filetree"
+	"github.com/wagoodman/dive/runtime/ui/format"
+	"github.com/wagoodman/dive/utils"
+)
+
+// FileDetails holds the UI objects and data models for populating the pane beneath the file tree. Specifically the
+// pane that shows the metadata (and digest, when computed) of the file selected in the file tree.
+type FileDetails struct {
+	gui             *gocui.Gui
+	view            *gocui.View
+	hidden          bool
+	requestedHeight int
+
+	currentNode func() *filetree.FileNode
+	nodeSize    func(*filetree.FileNode) int64
+	node        *filetree.FileNode
+}
+
+// newFileDetailsView creates a new view object attached the the global [gocui] screen object, showing the node
+// selected by the given function (with the size given by the other function, since it depends on the tree shown).
+func newFileDetailsView(gui *gocui.Gui, currentNode func() *filetree.FileNode, nodeSize func(*filetree.FileNode) int64) (controller *FileDetails) {
+	controller = new(FileDetails)
+
+	// populate main fields
+	controller.gui = gui
+	controller.currentNode = currentNode
+	controller.nodeSize = nodeSize
+	controller.hidden = true
+
+	// header + path, attributes, extended attributes and digest
+	controller.requestedHeight = 5
+
+	return controller
+}
+
+func (v *FileDetails) Name() string {
+	return "fileDetails"
+}
+
+// Setup initializes the UI concerns within the context of a global [gocui] view object.
+func (v *FileDetails) Setup(view *gocui.View) error {
+	logrus.Tracef("view.Setup() %s", v.Name())
+
+	// set controller options
+	v.view = view
+	v.view.Editable = false
+	v.view.Wrap = false
+	v.view.Frame = false
+
+	return v.Render()
+}
+
+// ToggleVisible shows/hides the file details pane.
+func (v *FileDetails) ToggleVisible() {
+	v.hidden = !v.hidden
+}
+
+// IsVisible indicates if the file details pane is currently shown
+func (v *FileDetails) IsVisible() bool {
+	if v == nil {
+		return false
+	}
+	return !v.hidden
+}
+
+// Update refreshes the state objects for future rendering.
+func (v *FileDetails) Update() error {
+	if v.currentNode != nil {
+		v.node = v.currentNode()
+	}
+	return nil
+}
+
+// Render flushes the state objects to the screen. The details pane reports the selected file's:
+// 1. path
+// 2. type, size, mode, owner and modification time
+// 3. extended attribute names
+// 4. digest (when requested with --file-digests)
+func (v *FileDetails) Render() error {
+	logrus.Tracef("view.Render() %s", v.Name())
+
+	if v.view == nil || !v.IsVisible() {
+		return nil
+	}
+
+	lines := v.lines()
+	v.gui.Update(func(g *gocui.Gui) error {
+		v.view.Clear()
+		width, _ := g.Size()
+
+		_, err := fmt.Fprintln(v.view, format.RenderHeader("File Details", width, false))
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprint(v.view, strings.Join(lines, "\n")); err != nil {
+			logrus.Debug("unable to write to buffer: ", err)
+		}
+		return nil
+	})
+	return nil
+}
+
+func (v *FileDetails) lines() []string {
+	if v.node == nil {
+		return []string{format.Header("Path:     ") + "(none)"}
+	}
+
+	info := v.node.Data.FileInfo
+
+	owner := fmt.Sprintf("%d:%d", info.Uid, info.Gid)
+	if info.Uname != "" || info.Gname != "" {
+		owner += fmt.Sprintf(" (%s:%s)", info.Uname, info.Gname)
+	}
+	modified := "-"
+	if !info.ModTime.IsZero() {
+		modified = info.ModTime.UTC().Format("2006-01-02 15:04:05")
+	}
+
+	xattrs := "(none)"
+	if len(info.Xattrs) > 0 {
+		names := make([]string, 0, len(info.Xattrs))
+		for name := range info.Xattrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		xattrs = strings.Join(names, ", ")
+	}
+
+	digest := info.Digest
+	switch {
+	case digest != "":
+	case info.TypeFlag != tar.TypeReg && info.TypeFlag != tar.TypeLink:
+		digest = "(not a regular file)"
+	default:
+		digest = "(not computed, use --file-digests sha256)"
+	}
+
+	return []string{
+		format.Header("Path:     ") + v.node.Path(),
+		format.Header("Type:     ") + fileType(info) +
+			format.Header("   Size: ") + humanize.Bytes(uint64(v.nodeSize(v.node))) +
+			format.Header("   Mode: ") + info.Mode.String() +
+			format.Header("   Owner: ") + owner +
+			format.Header("   Modified: ") + modified,
+		format.Header("Xattrs:   ") + xattrs,
+		format.Header("Digest:   ") + digest,
+	}
+}
+
+// fileType describes the type of the given file as shown in the details pane.
+func fileType(info filetree.FileInfo) string {
+	switch info.TypeFlag {
+	case tar.TypeDir:
+		return "directory"
+	case tar.TypeSymlink:
+		return "symlink → " + info.Linkname
+	case tar.TypeLink:
+		return "hard link → " + info.Linkname
+	case tar.TypeChar:
+		return "character device"
+	case tar.TypeBlock:
+		return "block device"
+	case tar.TypeFifo:
+		return "fifo"
+	}
+	if info.IsDir {
+		return "directory"
+	}
+	return "regular file"
+}
+
+// KeyHelp indicates all the possible actions a user can take while the current pane is selected (currently does nothing).
+func (v *FileDetails) KeyHelp() string {
+	return ""
+}
+
+// OnLayoutChange is called whenever the screen dimensions are changed
+func (v *FileDetails) OnLayoutChange() error {
+	err := v.Update()
+	if err != nil {
+		return err
+	}
+	return v.Render()
+}
+
+func (v *FileDetails) Layout(g *gocui.Gui, minX, minY, maxX, maxY int) error {
+	logrus.Tracef("view.Layout(minX: %d, minY: %d, maxX: %d, maxY: %d) %s", minX, minY, maxX, maxY, v.Name())
+
+	view, viewErr := g.SetView(v.Name(), minX, minY, maxX, maxY, 0)
+	if utils.IsNewView(viewErr) {
+		err := v.Setup(view)
+		if err != nil {
+			logrus.Error("unable to setup file details controller", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *FileDetails) RequestedSize(available int) *int {
+	return &v.requestedHeight
+}
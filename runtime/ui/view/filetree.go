@@ -17,6 +17,8 @@ import (
 
 type ViewOptionChangeListener func() error
 
+type NodeSelectionListener func(*filetree.FileNode) error
+
 // FileTree holds the UI objects and data models for populating the right pane. Specifically the pane that
 // shows selected layer or aggregate file ASCII tree.
 type FileTree struct {
@@ -29,6 +31,7 @@ type FileTree struct {
 
 	filterRegex         *regexp.Regexp
 	listeners           []ViewOptionChangeListener
+	selectionListeners  []NodeSelectionListener
 	helpKeys            []*key.Binding
 	requestedWidthRatio float64
 }
@@ -60,6 +63,32 @@ func (v *FileTree) AddViewOptionChangeListener(listener ...ViewOptionChangeListe
 	v.listeners = append(v.listeners, listener...)
 }
 
+func (v *FileTree) AddNodeSelectionListener(listener ...NodeSelectionListener) {
+	v.selectionListeners = append(v.selectionListeners, listener...)
+}
+
+// CurrentNode returns the FileNode under the cursor (nil if the tree is empty).
+func (v *FileTree) CurrentNode() *filetree.FileNode {
+	return v.vm.CurrentNode(v.filterRegex)
+}
+
+// NodeSize returns the size of the given node of the shown tree (see filetree.FileTree.NodeSize).
+func (v *FileTree) NodeSize(node *filetree.FileNode) int64 {
+	return v.vm.ModelTree.NodeSize(node)
+}
+
+func (v *FileTree) notifyNodeSelectionListeners() error {
+	node := v.CurrentNode()
+	for _, listener := range v.selectionListeners {
+		err := listener(node)
+		if err != nil {
+			logrus.Errorf("notifyNodeSelectionListeners error: %+v", err)
+			return err
+		}
+	}
+	return nil
+}
+
 func (v *FileTree) SetTitle(title string) {
 	v.title = title
 }
@@ -211,7 +240,10 @@ func (v *FileTree) SetTree(bottomTreeStart, bottomTreeStop, topTreeStart, topTre
 // this range into the view buffer. This is much faster when tree sizes are large.
 func (v *FileTree) CursorDown() error {
 	if v.vm.CursorDown() {
-		return v.Render()
+		if err := v.Render(); err != nil {
+			return err
+		}
+		return v.notifyNodeSelectionListeners()
 	}
 	return nil
 }
@@ -222,7 +254,10 @@ func (v *FileTree) CursorDown() error {
 // this range into the view buffer. This is much faster when tree sizes are large.
 func (v *FileTree) CursorUp() error {
 	if v.vm.CursorUp() {
-		return v.Render()
+		if err := v.Render(); err != nil {
+			return err
+		}
+		return v.notifyNodeSelectionListeners()
 	}
 	return nil
 }
@@ -234,7 +269,10 @@ func (v *FileTree) CursorLeft() error {
 		return err
 	}
 	_ = v.Update()
-	return v.Render()
+	if err = v.Render(); err != nil {
+		return err
+	}
+	return v.notifyNodeSelectionListeners()
 }
 
 // CursorRight descends into directory expanding it if needed
@@ -244,7 +282,10 @@ func (v *FileTree) CursorRight() error {
 		return err
 	}
 	_ = v.Update()
-	return v.Render()
+	if err = v.Render(); err != nil {
+		return err
+	}
+	return v.notifyNodeSelectionListeners()
 }
 
 // PageDown moves to next page putting the cursor on top
@@ -253,7 +294,10 @@ func (v *FileTree) PageDown() error {
 	if err != nil {
 		return err
 	}
-	return v.Render()
+	if err = v.Render(); err != nil {
+		return err
+	}
+	return v.notifyNodeSelectionListeners()
 }
 
 // PageUp moves to previous page putting the cursor on top
@@ -262,7 +306,10 @@ func (v *FileTree) PageUp() error {
 	if err != nil {
 		return err
 	}
-	return v.Render()
+	if err = v.Render(); err != nil {
+		return err
+	}
+	return v.notifyNodeSelectionListeners()
 }
 
 // getAbsPositionNode determines the selected screen cursor's location in the file tree, returning the selected FileNode.
@@ -392,7 +439,7 @@ func (v *FileTree) Render() error {
 		width, _ := g.Size()
 		headerStr := format.RenderHeader(title, width, isSelected)
 		if v.vm.ShowAttributes {
-			headerStr += fmt.Sprintf(filetree.AttributeFormat+" %s", "P", "ermission", "UID:GID", "Size", "Filetree")
+			headerStr += fmt.Sprintf(filetree.AttributeFormat+" %s", "P", "ermission", "", "Owner", "Size", "Modified", "Filetree")
 		}
 		_, _ = fmt.Fprintln(v.header, headerStr)
 
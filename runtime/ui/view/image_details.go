@@ -20,6 +20,7 @@ type ImageDetails struct {
 	header         *gocui.View
 	imageName      string
 	imageSize      uint64
+	compressedSize uint64
 	efficiency     float64
 	inefficiencies filetree.EfficiencySlice
 }
@@ -88,6 +89,11 @@ func (v *ImageDetails) Render() error {
 
 	imageNameStr := fmt.Sprintf("%s %s", format.Header("Image name:"), v.imageName)
 	imageSizeStr := fmt.Sprintf("%s %s", format.Header("Total Image size:"), humanize.Bytes(v.imageSize))
+	compressedSize := "unknown"
+	if v.compressedSize > 0 {
+		compressedSize = humanize.Bytes(v.compressedSize)
+	}
+	compressedSizeStr := fmt.Sprintf("%s %s", format.Header("Compressed Image size:"), compressedSize)
 	efficiencyStr := fmt.Sprintf("%s %d %%", format.Header("Image efficiency score:"), int(100.0*v.efficiency))
 	wastedSpaceStr := fmt.Sprintf("%s %s", format.Header("Potential wasted space:"), humanize.Bytes(uint64(wastedSpace)))
 
@@ -105,6 +111,7 @@ func (v *ImageDetails) Render() error {
 		var lines = []string{
 			imageNameStr,
 			imageSizeStr,
+			compressedSizeStr,
 			wastedSpaceStr,
 			efficiencyStr,
 			" ", // to avoid an empty line so CursorDown can work as expected
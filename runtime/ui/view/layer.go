@@ -115,6 +115,12 @@ func (v *Layer) Setup(body *gocui.View, header *gocui.View) error {
 			IsSelected: func() bool { return v.vm.CompareMode == viewmodel.CompareAllLayers },
 			Display:    "Show aggregated changes",
 		},
+		{
+			ConfigKeys: []string{"keybinding.mark-layer"},
+			OnAction:   v.markLayer,
+			IsSelected: func() bool { return v.vm.CompareMode == viewmodel.CompareLayerRange },
+			Display:    "Compare marked layers",
+		},
 		{
 			Key:      gocui.KeyArrowDown,
 			Modifier: gocui.ModNone,
@@ -243,16 +249,30 @@ func (v *Layer) setCompareMode(compareMode viewmodel.LayerCompareMode) error {
 	return v.notifyLayerChangeListeners()
 }
 
-// renderCompareBar returns the formatted string for the given layer.
+// markLayer marks the selected layer as the bottom (or, once the bottom is marked, the top) of the layer range to compare.
+func (v *Layer) markLayer() error {
+	v.vm.MarkLayer()
+	err := v.notifyLayerChangeListeners()
+	if err != nil {
+		return err
+	}
+	return v.Render()
+}
+
+// renderCompareBar returns the formatted string for the given layer (indicating the marked ends of a layer range).
 func (v *Layer) renderCompareBar(layerIdx int) string {
 	bottomTreeStart, bottomTreeStop, topTreeStart, topTreeStop := v.vm.GetCompareIndexes()
-	result := "  "
+	bar := "  "
+	if v.vm.IsMarked(layerIdx) {
+		bar = "▸ "
+	}
+	result := bar
 
 	if layerIdx >= bottomTreeStart && layerIdx <= bottomTreeStop {
-		result = format.CompareBottom("  ")
+		result = format.CompareBottom(bar)
 	}
 	if layerIdx >= topTreeStart && layerIdx <= topTreeStop {
-		result = format.CompareTop("  ")
+		result = format.CompareTop(bar)
 	}
 
 	return result
@@ -310,7 +330,7 @@ func (v *Layer) Render() error {
 			}
 		} else {
 			headerStr := format.RenderHeader(title, width, isSelected)
-			headerStr += fmt.Sprintf("Cmp"+image.LayerFormat, "Size", "Command")
+			headerStr += fmt.Sprintf("Cmp"+image.LayerFormat, "Size", "Compressed", "Command")
 			_, err := fmt.Fprintln(v.header, headerStr)
 			if err != nil {
 				return err
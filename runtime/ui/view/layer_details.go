@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/awesome-gocui/gocui"
+	"github.com/dustin/go-humanize"
 	"github.com/sirupsen/logrus"
 
 	"github.com/wagoodman/dive/dive/image"
@@ -62,7 +63,8 @@ func (v *LayerDetails) Setup(body, header *gocui.View) error {
 // 1. tags
 // 2. ID
 // 3. digest
-// 4. command
+// 4. size (and compressed size)
+// 5. command
 func (v *LayerDetails) Render() error {
 	v.gui.Update(func(g *gocui.Gui) error {
 		v.header.Clear()
@@ -86,6 +88,7 @@ func (v *LayerDetails) Render() error {
 			format.Header("Tags:   ") + tags,
 			format.Header("Id:     ") + v.CurrentLayer.Id,
 			format.Header("Digest: ") + v.CurrentLayer.Digest,
+			format.Header("Size:   ") + fmt.Sprintf("%s (compressed: %s)", humanize.Bytes(v.CurrentLayer.Size), v.CurrentLayer.CompressedSizeString()),
 			format.Header("Command:"),
 			v.CurrentLayer.Command,
 		}...)
@@ -18,6 +18,7 @@ type Views struct {
 	Layer        *Layer
 	Status       *Status
 	Filter       *Filter
+	FileDetails  *FileDetails
 	LayerDetails *LayerDetails
 	ImageDetails *ImageDetails
 	Debug        *Debug
@@ -51,11 +52,14 @@ func NewViews(g *gocui.Gui, imageName string, analysis *image.AnalysisResult, ca
 
 	Filter := newFilterView(g)
 
+	FileDetails := newFileDetailsView(g, Tree.CurrentNode, Tree.NodeSize)
+
 	LayerDetails := &LayerDetails{gui: g}
 	ImageDetails := &ImageDetails{
 		gui:            g,
 		imageName:      imageName,
 		imageSize:      analysis.SizeBytes,
+		compressedSize: analysis.CompressedSizeBytes,
 		efficiency:     analysis.Efficiency,
 		inefficiencies: analysis.Inefficiencies,
 	}
@@ -67,6 +71,7 @@ func NewViews(g *gocui.Gui, imageName string, analysis *image.AnalysisResult, ca
 		Layer:        Layer,
 		Status:       Status,
 		Filter:       Filter,
+		FileDetails:  FileDetails,
 		ImageDetails: ImageDetails,
 		LayerDetails: LayerDetails,
 		Debug:        Debug,
@@ -79,6 +84,7 @@ func (views *Views) All() []Renderer {
 		views.Layer,
 		views.Status,
 		views.Filter,
+		views.FileDetails,
 		views.LayerDetails,
 		views.ImageDetails,
 	}
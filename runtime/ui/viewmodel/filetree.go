@@ -116,7 +116,7 @@ func (vm *FileTreeViewModel) SetTreeByLayer(bottomTreeStart, bottomTreeStop, top
 	visitor := func(node *filetree.FileNode) error {
 		newNode, err := newTree.GetNode(node.Path())
 		if err == nil {
-			newNode.Data.ViewInfo = node.Data.ViewInfo
+			newTree.SetViewInfo(newNode, vm.ModelTree.ViewInfo(node))
 		}
 		return nil
 	}
@@ -188,7 +188,8 @@ func (vm *FileTreeViewModel) CursorLeft(filterRegex *regexp.Regexp) error {
 			match := filterRegex.Find([]byte(curNode.Path()))
 			regexMatch = match != nil
 		}
-		return !curNode.Parent.Data.ViewInfo.Collapsed && !curNode.Data.ViewInfo.Hidden && regexMatch
+		parentCollapsed := curNode.Parent != nil && vm.ModelTree.ViewInfo(curNode.Parent).Collapsed
+		return !parentCollapsed && !vm.ModelTree.ViewInfo(curNode).Hidden && regexMatch
 	}
 
 	err := vm.ModelTree.VisitDepthParentFirst(visitor, evaluator)
@@ -227,8 +228,9 @@ func (vm *FileTreeViewModel) CursorRight(filterRegex *regexp.Regexp) error {
 		return nil
 	}
 
-	if node.Data.ViewInfo.Collapsed {
-		node.Data.ViewInfo.Collapsed = false
+	if view := vm.ModelTree.ViewInfo(node); view.Collapsed {
+		view.Collapsed = false
+		vm.ModelTree.SetViewInfo(node, view)
 	}
 
 	vm.TreeIndex++
@@ -295,6 +297,11 @@ func (vm *FileTreeViewModel) PageUp() error {
 	return nil
 }
 
+// CurrentNode returns the FileNode under the cursor (nil if the tree is empty).
+func (vm *FileTreeViewModel) CurrentNode(filterRegex *regexp.Regexp) *filetree.FileNode {
+	return vm.getAbsPositionNode(filterRegex)
+}
+
 // getAbsPositionNode determines the selected screen cursor's location in the file tree, returning the selected FileNode.
 func (vm *FileTreeViewModel) getAbsPositionNode(filterRegex *regexp.Regexp) (node *filetree.FileNode) {
 	var visitor func(*filetree.FileNode) error
@@ -315,7 +322,8 @@ func (vm *FileTreeViewModel) getAbsPositionNode(filterRegex *regexp.Regexp) (nod
 			match := filterRegex.Find([]byte(curNode.Path()))
 			regexMatch = match != nil
 		}
-		return !curNode.Parent.Data.ViewInfo.Collapsed && !curNode.Data.ViewInfo.Hidden && regexMatch
+		parentCollapsed := curNode.Parent != nil && vm.ModelTree.ViewInfo(curNode.Parent).Collapsed
+		return !parentCollapsed && !vm.ModelTree.ViewInfo(curNode).Hidden && regexMatch
 	}
 
 	err := vm.ModelTree.VisitDepthParentFirst(visitor, evaluator)
@@ -330,7 +338,9 @@ func (vm *FileTreeViewModel) getAbsPositionNode(filterRegex *regexp.Regexp) (nod
 func (vm *FileTreeViewModel) ToggleCollapse(filterRegex *regexp.Regexp) error {
 	node := vm.getAbsPositionNode(filterRegex)
 	if node != nil && node.Data.FileInfo.IsDir {
-		node.Data.ViewInfo.Collapsed = !node.Data.ViewInfo.Collapsed
+		view := vm.ModelTree.ViewInfo(node)
+		view.Collapsed = !view.Collapsed
+		vm.ModelTree.SetViewInfo(node, view)
 	}
 	return nil
 }
@@ -340,7 +350,9 @@ func (vm *FileTreeViewModel) ToggleCollapseAll() error {
 	vm.CollapseAll = !vm.CollapseAll
 
 	visitor := func(curNode *filetree.FileNode) error {
-		curNode.Data.ViewInfo.Collapsed = vm.CollapseAll
+		view := vm.ModelTree.ViewInfo(curNode)
+		view.Collapsed = vm.CollapseAll
+		vm.ModelTree.SetViewInfo(curNode, view)
 		return nil
 	}
 
@@ -402,19 +414,21 @@ func (vm *FileTreeViewModel) Update(filterRegex *regexp.Regexp, width, height in
 
 	// keep the vm selection in parity with the current DiffType selection
 	err := vm.ModelTree.VisitDepthChildFirst(func(node *filetree.FileNode) error {
-		node.Data.ViewInfo.Hidden = vm.HiddenDiffTypes[node.Data.DiffType]
+		view := vm.ModelTree.ViewInfo(node)
+		view.Hidden = vm.HiddenDiffTypes[vm.ModelTree.DiffType(node)]
 		visibleChild := false
 		for _, child := range node.Children {
-			if !child.Data.ViewInfo.Hidden {
+			if !vm.ModelTree.ViewInfo(child).Hidden {
 				visibleChild = true
-				node.Data.ViewInfo.Hidden = false
+				view.Hidden = false
 			}
 		}
 		// hide nodes that do not match the current file filter regex (also don't unhide nodes that are already hidden)
-		if filterRegex != nil && !visibleChild && !node.Data.ViewInfo.Hidden {
+		if filterRegex != nil && !visibleChild && !view.Hidden {
 			match := filterRegex.FindString(node.Path())
-			node.Data.ViewInfo.Hidden = len(match) == 0
+			view.Hidden = len(match) == 0
 		}
+		vm.ModelTree.SetViewInfo(node, view)
 		return nil
 	}, nil)
 
@@ -426,14 +440,17 @@ func (vm *FileTreeViewModel) Update(filterRegex *regexp.Regexp, width, height in
 	// make a new tree with only visible nodes
 	vm.ViewTree = vm.ModelTree.Copy()
 	err = vm.ViewTree.VisitDepthParentFirst(func(node *filetree.FileNode) error {
-		if node.Data.ViewInfo.Hidden {
+		if vm.ViewTree.ViewInfo(node).Hidden {
 			err1 := vm.ViewTree.RemovePath(node.Path())
 			if err1 != nil {
 				return err1
 			}
 		}
 		return nil
-	}, nil)
+	}, func(node *filetree.FileNode) bool {
+		// the nodes beneath a hidden node are hidden as well (and have been removed along with it)
+		return node.Parent == nil || !vm.ViewTree.ViewInfo(node.Parent).Hidden
+	})
 
 	if err != nil {
 		logrus.Errorf("unable to propagate vm view tree: %+v", err)
@@ -2,6 +2,7 @@ package viewmodel
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -77,7 +78,7 @@ func initializeTestViewModel(t *testing.T) *FileTreeViewModel {
 	result := docker.TestAnalysisFromArchive(t, "../../../.data/test-docker-image.tar")
 
 	cache := filetree.NewComparer(result.RefTrees)
-	errors := cache.BuildCache()
+	errors := cache.BuildCache(context.Background(), nil)
 	if len(errors) > 0 {
 		t.Fatalf("%s: unable to build cache: %d errors", t.Name(), len(errors))
 	}
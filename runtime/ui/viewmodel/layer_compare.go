@@ -3,6 +3,7 @@ package viewmodel
 const (
 	CompareSingleLayer LayerCompareMode = iota
 	CompareAllLayers
+	CompareLayerRange
 )
 
 type LayerCompareMode int
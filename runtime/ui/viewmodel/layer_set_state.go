@@ -7,26 +7,79 @@ type LayerSetState struct {
 	Layers            []*image.Layer
 	CompareMode       LayerCompareMode
 	CompareStartIndex int
+
+	// the layers marked as the bottom and top of the compared range (-1 when not marked)
+	RangeBottomIndex int
+	RangeTopIndex    int
 }
 
 func NewLayerSetState(layers []*image.Layer, compareMode LayerCompareMode) *LayerSetState {
 	return &LayerSetState{
-		Layers:      layers,
-		CompareMode: compareMode,
+		Layers:           layers,
+		CompareMode:      compareMode,
+		RangeBottomIndex: -1,
+		RangeTopIndex:    -1,
+	}
+}
+
+// MarkLayer marks the current layer as the bottom of the compared range (switching to the range compare mode), or as
+// the top of the range when only the bottom has been marked.
+func (state *LayerSetState) MarkLayer() {
+	if state.CompareMode != CompareLayerRange || state.RangeBottomIndex < 0 || state.RangeTopIndex >= 0 {
+		state.CompareMode = CompareLayerRange
+		state.RangeBottomIndex = state.LayerIndex
+		state.RangeTopIndex = -1
+		return
 	}
+	state.RangeTopIndex = state.LayerIndex
+}
+
+// IsMarked indicates if the given layer is marked as the bottom or top of the compared range.
+func (state *LayerSetState) IsMarked(layerIndex int) bool {
+	return state.CompareMode == CompareLayerRange && (layerIndex == state.RangeBottomIndex || layerIndex == state.RangeTopIndex)
+}
+
+// GetRangeIndexes returns the lower and upper layer of the compared range, where the current layer stands in for the
+// top of the range until it is marked.
+func (state *LayerSetState) GetRangeIndexes() (lower, upper int) {
+	lower, upper = state.RangeBottomIndex, state.RangeTopIndex
+	if upper < 0 {
+		upper = state.LayerIndex
+	}
+	if lower < 0 {
+		lower = upper
+	}
+	if lower > upper {
+		lower, upper = upper, lower
+	}
+	return lower, upper
 }
 
 // getCompareIndexes determines the layer boundaries to use for comparison (based on the current compare mode)
 func (state *LayerSetState) GetCompareIndexes() (bottomTreeStart, bottomTreeStop, topTreeStart, topTreeStop int) {
+	layerIndex := state.LayerIndex
+	compareMode := state.CompareMode
+
+	if compareMode == CompareLayerRange {
+		// the changes made after the lower layer up to (and including) the upper layer, or the changes of the
+		// layer alone when both ends of the range are the same layer
+		lower, upper := state.GetRangeIndexes()
+		if lower != upper {
+			return state.CompareStartIndex, lower, lower + 1, upper
+		}
+		layerIndex = lower
+		compareMode = CompareSingleLayer
+	}
+
 	bottomTreeStart = state.CompareStartIndex
-	topTreeStop = state.LayerIndex
-
-	if state.LayerIndex == state.CompareStartIndex {
-		bottomTreeStop = state.LayerIndex
-		topTreeStart = state.LayerIndex
-	} else if state.CompareMode == CompareSingleLayer {
-		bottomTreeStop = state.LayerIndex - 1
-		topTreeStart = state.LayerIndex
+	topTreeStop = layerIndex
+
+	if layerIndex == state.CompareStartIndex {
+		bottomTreeStop = layerIndex
+		topTreeStart = layerIndex
+	} else if compareMode == CompareSingleLayer {
+		bottomTreeStop = layerIndex - 1
+		topTreeStart = layerIndex
 	} else {
 		bottomTreeStop = state.CompareStartIndex
 		topTreeStart = state.CompareStartIndex + 1
@@ -0,0 +1,58 @@
+package viewmodel
+
+import (
+	"testing"
+
+	"github.com/wagoodman/dive/dive/image"
+)
+
+func TestLayerSetState_GetCompareIndexes(t *testing.T) {
+	layers := make([]*image.Layer, 10)
+
+	tests := []struct {
+		name     string
+		mode     LayerCompareMode
+		layer    int
+		marks    []int
+		expected [4]int
+	}{
+		{name: "single layer", mode: CompareSingleLayer, layer: 5, expected: [4]int{0, 4, 5, 5}},
+		{name: "single first layer", mode: CompareSingleLayer, layer: 0, expected: [4]int{0, 0, 0, 0}},
+		{name: "all layers", mode: CompareAllLayers, layer: 5, expected: [4]int{0, 0, 1, 5}},
+		// the top of the range follows the cursor until it is marked
+		{name: "bottom marked", mode: CompareSingleLayer, layer: 9, marks: []int{3}, expected: [4]int{0, 3, 4, 9}},
+		{name: "bottom and top marked", mode: CompareSingleLayer, layer: 1, marks: []int{3, 9}, expected: [4]int{0, 3, 4, 9}},
+		{name: "marked top to bottom", mode: CompareAllLayers, layer: 5, marks: []int{9, 3}, expected: [4]int{0, 3, 4, 9}},
+		{name: "same layer marked", mode: CompareAllLayers, layer: 5, marks: []int{4, 4}, expected: [4]int{0, 3, 4, 4}},
+		{name: "first layer marked", mode: CompareAllLayers, layer: 0, marks: []int{0}, expected: [4]int{0, 0, 0, 0}},
+		// marking again starts a new range
+		{name: "range remarked", mode: CompareSingleLayer, layer: 8, marks: []int{1, 2, 6}, expected: [4]int{0, 6, 7, 8}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := NewLayerSetState(layers, test.mode)
+			for _, mark := range test.marks {
+				state.LayerIndex = mark
+				state.MarkLayer()
+			}
+			state.LayerIndex = test.layer
+
+			bottomTreeStart, bottomTreeStop, topTreeStart, topTreeStop := state.GetCompareIndexes()
+			if actual := [4]int{bottomTreeStart, bottomTreeStop, topTreeStart, topTreeStop}; actual != test.expected {
+				t.Errorf("expected compare indexes %v, got %v", test.expected, actual)
+			}
+
+			if len(test.marks) > 0 {
+				if state.CompareMode != CompareLayerRange {
+					t.Errorf("expected the layer range compare mode, got %v", state.CompareMode)
+				}
+				if last := test.marks[len(test.marks)-1]; !state.IsMarked(last) {
+					t.Errorf("expected layer %d to be marked", last)
+				}
+			} else if state.IsMarked(test.layer) {
+				t.Errorf("expected no marked layers")
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CommandReader streams the stdout of a command, surfacing a failed command as a read error (rather than a short read).
+type CommandReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	done   bool
+}
+
+// NewCommandReader starts the given command, streaming its stdout. A failed command is reported (along with its
+// stderr) as an error when the stream is read to completion or closed.
+func NewCommandReader(cmd *exec.Cmd) (io.ReadCloser, error) {
+	reader := &CommandReader{cmd: cmd}
+	cmd.Stderr = &reader.stderr
+
+	var err error
+	reader.stdout, err = cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (r *CommandReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		if waitErr := r.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *CommandReader) Close() error {
+	r.stdout.Close()
+	return r.wait()
+}
+
+func (r *CommandReader) wait() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s: %s: %w", filepath.Base(r.cmd.Args[0]), strings.TrimSpace(r.stderr.String()), err)
+	}
+	return nil
+}
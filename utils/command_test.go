@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestCommandReader(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell available")
+	}
+
+	reader, err := NewCommandReader(exec.Command("sh", "-c", "printf hello"))
+	if err != nil {
+		t.Fatalf("unable to start command: %v", err)
+	}
+	out, err := io.ReadAll(reader)
+	if err != nil || string(out) != "hello" {
+		t.Errorf("expected the command output, got %q (%v)", out, err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Errorf("unable to close: %v", err)
+	}
+
+	// a failed command is a read error rather than a short read
+	reader, err = NewCommandReader(exec.Command("sh", "-c", "printf partial; echo broken >&2; exit 3"))
+	if err != nil {
+		t.Fatalf("unable to start command: %v", err)
+	}
+	out, err = io.ReadAll(reader)
+	if err == nil || !strings.Contains(err.Error(), "sh: broken") || string(out) != "partial" {
+		t.Errorf("expected the command error, got %q (%v)", out, err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Errorf("expected the error to be reported once, got %v", err)
+	}
+}